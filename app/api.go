@@ -0,0 +1,461 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+)
+
+const (
+	// API_TOKEN_FILE holds the token API requests authenticate with, it
+	// lives in DATA_DIR
+	API_TOKEN_FILE = "api-token"
+	// API_ADDR is the default address of the API
+	API_ADDR = "127.0.0.1:7891"
+	// API_UNIX_PREFIX starts addresses of Unix sockets
+	API_UNIX_PREFIX = "unix:"
+	// API_MAX_BODY is the largest request body the API reads
+	API_MAX_BODY = 16 << 20
+	// How often the event stream looks for changed notes
+	API_EVENTS_CHECK = time.Second
+)
+
+// Events of the event stream
+const (
+	API_EVENT_CREATED = "created"
+	API_EVENT_UPDATED = "updated"
+	API_EVENT_DELETED = "deleted"
+)
+
+// apiServer serves the notes of the app over HTTP to scripts and editor
+// integrations. Handlers hold a.mu while they use the notes, like windows.
+type apiServer struct {
+	a     *App
+	addr  string
+	token string
+	srv   *http.Server
+	// Event stream clients, and the notes as last reported to them
+	mu       sync.Mutex
+	clients  map[chan apiEvent]bool
+	reported map[string]store.Record
+	changed  chan struct{}
+	stop     chan struct{}
+}
+
+// apiEvent is a change of a note reported on the event stream.
+type apiEvent struct {
+	Type string        `json:"type"`
+	ID   string        `json:"id"`
+	Note *store.Record `json:"note,omitempty"`
+}
+
+// apiNote is a note as sent to the API to create or update it. Missing
+// fields are left unchanged by updates.
+type apiNote struct {
+	Title   *string   `json:"title"`
+	Content *string   `json:"content"`
+	Journal *string   `json:"journal"`
+	Folder  *string   `json:"folder"`
+	Tags    *[]string `json:"tags"`
+	Pinned  *bool     `json:"pinned"`
+}
+
+// applyAPI starts, restarts or stops the API to match the settings.
+func (a *App) applyAPI() {
+	addr := a.settings.APIAddr
+	if addr == "" {
+		addr = API_ADDR
+	}
+	if a.api != nil && (!a.settings.API || a.api.addr != addr) {
+		a.api.close()
+		a.api = nil
+	}
+	if a.settings.API && a.api == nil {
+		var err error
+		a.api, err = startAPI(a, addr)
+		a.toasts.showError("Couldn't start the API", err)
+	}
+}
+
+// startAPI serves the API of a at addr, a loopback address or a Unix socket.
+func startAPI(a *App, addr string) (*apiServer, error) {
+	token, err := apiToken()
+	if err != nil {
+		return nil, err
+	}
+	var ln net.Listener
+	if path, ok := strings.CutPrefix(addr, API_UNIX_PREFIX); ok {
+		// Remove the socket a previous run left
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		if ln, err = net.Listen("unix", path); err != nil {
+			return nil, err
+		}
+		os.Chmod(path, 0600)
+	} else {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			return nil, fmt.Errorf("the API only listens on 127.0.0.1, ::1 or a Unix socket, not %s", host)
+		}
+		if ln, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+	s := &apiServer{
+		a:        a,
+		addr:     addr,
+		token:    token,
+		clients:  map[chan apiEvent]bool{},
+		reported: map[string]store.Record{},
+		changed:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notes", s.auth(s.handleNotes))
+	mux.HandleFunc("/notes/", s.auth(s.handleNote))
+	mux.HandleFunc("/events", s.auth(s.handleEvents))
+	s.srv = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go s.srv.Serve(ln)
+	go s.watch()
+	return s, nil
+}
+
+// apiToken returns the token of API_TOKEN_FILE, creating it if needed.
+func apiToken() (string, error) {
+	path := filepath.Join(DATA_DIR, API_TOKEN_FILE)
+	if data, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.MkdirAll(DATA_DIR, os.ModePerm); err != nil {
+		return "", err
+	}
+	return token, os.WriteFile(path, []byte(token+"\n"), 0600)
+}
+
+// close stops the server. It doesn't wait for requests being handled, they
+// may be waiting for a.mu held by the caller.
+func (s *apiServer) close() {
+	close(s.stop)
+	s.srv.Close()
+}
+
+// auth only lets requests with the token through to h.
+func (s *apiServer) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			apiError(w, http.StatusUnauthorized, "missing or wrong token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func apiJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	apiJSON(w, status, map[string]string{"error": msg})
+}
+
+// handleNotes lists and searches the notes with GET, and creates one with
+// POST.
+func (s *apiServer) handleNotes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+		s.a.mu.Lock()
+		records := []store.Record{}
+		for _, n := range s.a.notes {
+			if rec := n.record(); rec.Matches(query) {
+				records = append(records, rec)
+			}
+		}
+		s.a.mu.Unlock()
+		apiJSON(w, http.StatusOK, records)
+	case http.MethodPost:
+		var in apiNote
+		if err := decodeNote(w, r, &in); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		unlock, err := s.lock()
+		if err != nil {
+			apiError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		n := note{id: store.NewID()}
+		in.apply(&n)
+		n.touch()
+		s.a.notes = append(s.a.notes, n)
+		err = s.a.notesChangedLocked(nil)
+		unlock()
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, "couldn't save the notes: "+err.Error())
+			return
+		}
+		s.notify()
+		apiJSON(w, http.StatusCreated, n.record())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		apiError(w, http.StatusMethodNotAllowed, "use GET or POST")
+	}
+}
+
+// handleNote reads, updates and deletes the note of the ID of the path.
+func (s *apiServer) handleNote(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/notes/")
+	var in apiNote
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+	case http.MethodPut, http.MethodPatch:
+		if err := decodeNote(w, r, &in); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		apiError(w, http.StatusMethodNotAllowed, "use GET, PUT, PATCH or DELETE")
+		return
+	}
+	// Reads don't need the notes lock
+	unlock := s.a.mu.Unlock
+	if r.Method == http.MethodGet {
+		s.a.mu.Lock()
+	} else {
+		var err error
+		if unlock, err = s.lock(); err != nil {
+			apiError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+	}
+	defer unlock()
+	i := s.a.editorPane.noteIndex(id)
+	if i < 0 {
+		apiError(w, http.StatusNotFound, "no note "+id)
+		return
+	}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		apiJSON(w, http.StatusOK, s.a.notes[i].record())
+		return
+	case http.MethodPut, http.MethodPatch:
+		in.apply(&s.a.notes[i])
+		s.a.notes[i].touch()
+		err = s.a.notesChangedLocked([]int{i})
+	case http.MethodDelete:
+		s.a.notes = slices.Delete(s.a.notes, i, i+1)
+		if k := s.a.editorPane.tabIndex(id); k >= 0 {
+			s.a.editorPane.closeTab(k)
+		}
+		s.a.notesPane.markSelected(s.a.editorPane.current())
+		err = s.a.notesChangedLocked(nil)
+	}
+	if err != nil {
+		apiError(w, http.StatusInternalServerError, "couldn't save the notes: "+err.Error())
+		return
+	}
+	s.notify()
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	apiJSON(w, http.StatusOK, s.a.notes[i].record())
+}
+
+// lock takes the notes lock and then the app mutex, and returns the function
+// releasing both. The changes of other processes are merged first, so that
+// requests change the notes as saved.
+func (s *apiServer) lock() (func(), error) {
+	unlock, err := s.a.lockStore()
+	if err != nil {
+		return nil, err
+	}
+	if s.a.store.Changed() {
+		if err := s.a.mergeExternal(); err != nil {
+			unlock()
+			return nil, err
+		}
+	}
+	return unlock, nil
+}
+
+// decodeNote reads the note of the body of r to in.
+func decodeNote(w http.ResponseWriter, r *http.Request, in *apiNote) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, API_MAX_BODY))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(in); err != nil {
+		return fmt.Errorf("invalid note: %w", err)
+	}
+	if in.Journal != nil && *in.Journal != "" {
+		if _, err := time.Parse(time.DateOnly, *in.Journal); err != nil {
+			return errors.New("invalid note: journal isn't a YYYY-MM-DD day")
+		}
+	}
+	return nil
+}
+
+// apply sets the fields of in on n.
+func (in apiNote) apply(n *note) {
+	if in.Title != nil {
+		n.title = *in.Title
+	}
+	if in.Content != nil {
+		n.content = *in.Content
+	}
+	if in.Journal != nil {
+		n.journal = *in.Journal
+	}
+	if in.Folder != nil {
+		n.folder = strings.TrimSpace(*in.Folder)
+	}
+	if in.Tags != nil {
+		n.tags = *in.Tags
+	}
+	if in.Pinned != nil {
+		n.isPinned = *in.Pinned
+	}
+}
+
+// handleEvents streams the changes of notes as server-sent events, whatever
+// made them: the window, the API or another process.
+func (s *apiServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apiError(w, http.StatusInternalServerError, "streaming isn't supported")
+		return
+	}
+	events := make(chan apiEvent, 64)
+	current, _ := s.snapshot()
+	s.mu.Lock()
+	if len(s.clients) == 0 {
+		// Changes are only tracked while clients listen
+		s.reported = current
+	}
+	s.clients[events] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, events)
+		s.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": keeper events\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case e := <-events:
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// notify makes the event stream look for changes right away.
+func (s *apiServer) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// watch reports the changes of notes to the event stream clients, every
+// API_EVENTS_CHECK or when notified.
+func (s *apiServer) watch() {
+	ticker := time.NewTicker(API_EVENTS_CHECK)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.changed:
+		}
+		s.mu.Lock()
+		listening := len(s.clients) > 0
+		s.mu.Unlock()
+		if listening {
+			s.report()
+		}
+	}
+}
+
+// snapshot returns the notes by ID, and their IDs in order.
+func (s *apiServer) snapshot() (map[string]store.Record, []string) {
+	s.a.mu.Lock()
+	defer s.a.mu.Unlock()
+	current := make(map[string]store.Record, len(s.a.notes))
+	var order []string
+	for _, n := range s.a.notes {
+		current[n.id] = n.record()
+		order = append(order, n.id)
+	}
+	return current, order
+}
+
+// report sends the events of the notes changed since the last report.
+func (s *apiServer) report() {
+	current, order := s.snapshot()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []apiEvent
+	for _, id := range order {
+		r := current[id]
+		old, ok := s.reported[id]
+		switch {
+		case !ok:
+			events = append(events, apiEvent{Type: API_EVENT_CREATED, ID: id, Note: &r})
+		case !old.Equal(r):
+			events = append(events, apiEvent{Type: API_EVENT_UPDATED, ID: id, Note: &r})
+		}
+	}
+	for id := range s.reported {
+		if _, ok := current[id]; !ok {
+			events = append(events, apiEvent{Type: API_EVENT_DELETED, ID: id})
+		}
+	}
+	s.reported = current
+	for _, e := range events {
+		for c := range s.clients {
+			select {
+			case c <- e:
+			default:
+				// The client is too slow, it misses the event
+			}
+		}
+	}
+}
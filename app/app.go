@@ -3,23 +3,29 @@ package app
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"image"
-	"image/color"
 	"image/png"
+	"io"
 	"math"
-	"math/rand"
 	"os"
 	"slices"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/deoxyimran/keeper/app/store"
 	"github.com/deoxyimran/keeper/app/utils/svgs"
 	"github.com/deoxyimran/keeper/res/images"
 
+	gioapp "gioui.org/app"
 	"gioui.org/font"
 	"gioui.org/font/gofont"
 	"gioui.org/io/event"
+	"gioui.org/io/key"
 	"gioui.org/io/pointer"
+	"gioui.org/io/transfer"
 	"gioui.org/layout"
 	"gioui.org/op"
 	"gioui.org/op/clip"
@@ -32,25 +38,80 @@ import (
 
 type App struct {
 	// Widgets
-	notesPane  notesPane
-	editorPane editorPane
-	notif      notification
-	prompt     msgPrompt
+	notesPane   notesPane
+	editorPane  editorPane
+	toasts      toasts
+	dialog      dialog
+	replaceDlg  replaceDialog
+	tmplDlg     templatesDialog
+	settingsDlg settingsDialog
+	cmdPalette  commandPalette
+	lock        lock
+	splitter    splitter
+	drawerBtn   button
+	settingsBtn button
 	// States
-	secret       string
-	scratchNotes []note
+	store        *store.Store
+	attachments  attachments
 	notes        []note
+	templates    []noteTemplate
 	selectedNote int
 	isEditorOpen bool
+	isDrawerOpen bool
+	state        uiState
+	settings     settings
+	themes       map[string]palette // User themes
+	commands     commands
+	focus        event.Tag // Gets the keyboard focus on the next frame
+	// Whether the notes list or its search bar have the keyboard focus
+	isListFocused bool
+	nextSave      time.Time
+	saved         []byte // Notes as of the last save
+	// Whether a save found the notes locked by another process
+	isSavePending bool
+	api           *apiServer
+	isSyncing     bool
+	syncPass      string // Passphrase of the sync folder, once it worked
+	// Windows, the main one and the notes popped out of it. They run in
+	// goroutines of their own and hold mu while using the state.
+	mu      sync.Mutex
+	window  *gioapp.Window
+	windows []*noteWindow
 	// Logo, theme, etc.
-	logo image.Image
-	th   *material.Theme
+	logo     image.Image
+	errorIco image.Image
+	th       *material.Theme
 }
 
 type note struct {
+	id             string // Stable across launches, unlike the index
 	title, content string
-	isSelected     bool
-	isHovered      bool
+	// Date of the day for journal notes, empty for regular notes
+	journal    string
+	folder     string
+	tags       []string
+	isPinned   bool
+	modified   time.Time
+	isSelected bool
+	isHovered  bool
+	// Cached by summary
+	preview, summaryOf string
+	words              int
+}
+
+func noteFromRecord(r store.Record) note {
+	return note{
+		id: r.ID, title: r.Title, content: r.Content, journal: r.Journal,
+		folder: r.Folder, tags: r.Tags, isPinned: r.Pinned, modified: r.Modified,
+	}
+}
+
+// record returns n as stored in the notes file.
+func (n note) record() store.Record {
+	return store.Record{
+		ID: n.id, Title: n.title, Content: n.content, Journal: n.journal,
+		Folder: n.folder, Tags: n.tags, Pinned: n.isPinned, Modified: n.modified,
+	}
 }
 
 type (
@@ -59,40 +120,85 @@ type (
 )
 
 const (
-	SECRET_FILE = "secret"
-	NOTES_FILE  = "notes.bin"
-	DATA_DIR    = "data"
-	IMG_PATH    = "res/images/"
+	DATA_DIR = store.DATA_DIR
+	IMG_PATH = "res/images/"
+	// How often the notes file is checked for changes of other processes,
+	// like the command line
+	EXTERNAL_CHECK = 2 * time.Second
 )
 
-func NewApp() *App {
-	app := &App{}
+func NewApp(window *gioapp.Window) *App {
+	app := &App{selectedNote: -1, window: window}
 
 	// Load saved notes, secret, config, etc. here
+	app.loadSettings()
 	app.load()
+	app.loadTemplates()
+	app.loadState()
+	app.themes = loadThemes(DATA_DIR + "/" + THEMES_DIR)
+	app.attachments = newAttachments(app.store)
+	app.collectGarbage()
 
 	// Load app logo and icons
 	app.logo, _ = png.Decode(bytes.NewReader(images.Logo))
 	noteIco, _ := svgs.LoadSvg(strings.NewReader(images.Note), image.Point{})
 	searchIco, _ := svgs.LoadSvg(strings.NewReader(images.Search), image.Point{})
 	trashIco, _ := svgs.LoadSvg(strings.NewReader(images.Trash), image.Point{})
-	errorIco, _ := svgs.LoadSvg(strings.NewReader(images.Error), image.Point{48, 48})
+	app.errorIco, _ = svgs.LoadSvg(strings.NewReader(images.Error), image.Point{48, 48})
 	xcircleIco, _ := svgs.LoadSvg(strings.NewReader(images.XCircle), image.Pt(18, 18))
 
 	th := material.NewTheme()
 	th.Shaper = text.NewShaper(text.WithCollection(gofont.Collection()))
-	th.Fg = color.NRGBA{250, 249, 246, 255}
 	app.th = th
+	app.applyTheme(app.settings.Theme)
+
+	// Init dialog
+	app.dialog = newDialog(th)
 
-	// Init prompt
-	app.prompt = newMsgPrompt(th, 350, 140, errorIco)
+	// Init toasts
+	app.toasts = newToasts(th, xcircleIco)
 
-	// Init notification
-	app.notif = newNotification(th, xcircleIco)
+	// Init global replace dialog
+	app.replaceDlg = newReplaceDialog(th, &app.notes, app.notesChanged)
+
+	// Init templates dialog
+	app.tmplDlg = newTemplatesDialog(th, &app.templates, func() {
+		app.toasts.showError("Couldn't save templates", app.saveTemplates())
+	})
+
+	// Init settings dialog
+	app.settingsDlg = newSettingsDialog(th, &app.settings, func() {
+		app.applyTheme(app.settings.Theme)
+		app.applyAPI()
+		app.toasts.showError("Couldn't save settings", app.saveSettings())
+		app.invalidateWindows()
+	}, app.setDataDir)
+
+	// Init lock screen
+	app.lock = newLock(th)
 
 	// Panes
-	app.notesPane = newNotesPane(th, searchIco, noteIco, &app.scratchNotes, &app.notes, &app.selectedNote, &app.isEditorOpen)
-	app.editorPane = newEditorPane(th, trashIco, &app.prompt, &app.notif)
+	app.notesPane = newNotesPane(th, searchIco, noteIco, &app.commands, &app.notes, &app.templates,
+		&app.selectedNote, app.openNote, app.openNoteInTab)
+	app.editorPane = newEditorPane(th, trashIco, &app.commands, &app.attachments,
+		&app.settings, &app.notes, &app.isEditorOpen, app.notesPane.markSelected, app.invalidateWindows)
+	app.editorPane.restoreTabs(app.state.Tabs, app.state.ActiveTab)
+	if window != nil {
+		go app.watchNotes()
+		app.applyAPI()
+	}
+
+	// Commands and their shortcuts
+	app.cmdPalette = newCommandPalette(th, &app.commands, &app.notes, func(id string) {
+		// The note may be gone since the palette opened
+		if i := app.editorPane.noteIndex(id); i >= 0 {
+			app.notesPane.jumpTo(i)
+		}
+	})
+	app.registerCommands()
+	app.commands.loadKeymap(DATA_DIR + "/" + KEYMAP_FILE)
+	app.drawerBtn = button{th: th, label: "☰ Notes", onClick: func() { app.isDrawerOpen = !app.isDrawerOpen }}
+	app.settingsBtn = button{th: th, label: "Settings", onClick: func() { app.commands.run(ACTION_SETTINGS) }}
 
 	return app
 
@@ -120,7 +226,7 @@ func (a *button) layout(gtx C) D {
 	dims := btn.Layout(gtx)
 	if a.isDisabled {
 		defer clip.UniformRRect(image.Rect(0, 0, dims.Size.X, dims.Size.Y), 3).Push(gtx.Ops).Pop()
-		paint.ColorOp{Color: color.NRGBA{B: 200, A: 190}}.Add(gtx.Ops)
+		paint.ColorOp{Color: pal.Disabled}.Add(gtx.Ops)
 		paint.PaintOp{}.Add(gtx.Ops)
 		event.Op(gtx.Ops, a)
 	}
@@ -138,9 +244,12 @@ type noteItem struct {
 	handleUnhover  func(i int)
 	handleSelect   func(i int)
 	handleUnselect func(i int)
+	handleOpenTab  func(i int)
+	handleToggle   func(i int)
+	handleRange    func(i int)
 }
 
-func (ni *noteItem) layout(gtx C, index int) D {
+func (ni *noteItem) layout(gtx C, index int, isFirst bool) D {
 	macro := op.Record(gtx.Ops)
 	f := func(gtx C) D {
 		return layout.Flex{
@@ -150,8 +259,9 @@ func (ni *noteItem) layout(gtx C, index int) D {
 			layout.Rigid(func(gtx C) D {
 				return widget.Image{Src: paint.NewImageOp(ni.ico)}.Layout(gtx)
 			}),
+			layout.Rigid(layout.Spacer{Width: unit.Dp(4)}.Layout),
 			layout.Flexed(0.5, func(gtx C) D {
-				return material.Label(ni.th, unit.Sp(13), ni.get(index).title).Layout(gtx)
+				return ni.layoutText(gtx, ni.get(index))
 			}),
 		)
 	}
@@ -163,7 +273,7 @@ func (ni *noteItem) layout(gtx C, index int) D {
 			func(gtx C) D {
 				x, y := gtx.Constraints.Min.X, gtx.Constraints.Min.Y
 				defer clip.UniformRRect(image.Rect(0, 0, x, y), 10).Push(gtx.Ops).Pop()
-				paint.ColorOp{Color: color.NRGBA{B: 155, A: 90}}.Add(gtx.Ops)
+				paint.ColorOp{Color: pal.Hovered}.Add(gtx.Ops)
 				paint.PaintOp{}.Add(gtx.Ops)
 				return D{Size: image.Pt(x, y)}
 			}, f,
@@ -174,7 +284,7 @@ func (ni *noteItem) layout(gtx C, index int) D {
 			func(gtx C) D {
 				x, y := gtx.Constraints.Min.X, gtx.Constraints.Min.Y
 				defer clip.UniformRRect(image.Rect(0, 0, x, y), 10).Push(gtx.Ops).Pop()
-				paint.ColorOp{Color: color.NRGBA{B: 155, A: 155}}.Add(gtx.Ops)
+				paint.ColorOp{Color: pal.Selected}.Add(gtx.Ops)
 				paint.PaintOp{}.Add(gtx.Ops)
 				return D{Size: image.Pt(x, y)}
 			}, f,
@@ -202,17 +312,27 @@ func (ni *noteItem) layout(gtx C, index int) D {
 			case pointer.Release:
 				ni.handleUnhover(index)
 			case pointer.Press:
-				ni.handleUnselect(ni.getSelectedInd())
-				ni.handleSelect(index)
+				switch {
+				case x.Buttons == pointer.ButtonTertiary:
+					// Middle click opens the note in a new tab
+					ni.handleOpenTab(index)
+				case x.Modifiers.Contain(key.ModShortcut):
+					ni.handleToggle(index)
+				case x.Modifiers.Contain(key.ModShift):
+					ni.handleRange(index)
+				default:
+					ni.handleUnselect(ni.getSelectedInd())
+					ni.handleSelect(index)
+				}
 				gtx.Execute(op.InvalidateCmd{})
 			}
 		}
 	}
 	stack.Pop()
 	call := macro.Stop()
-	// Extra space given to top (ignored for index 0)
+	// Extra space given to top (ignored for the first item)
 	offset := 0
-	if index != 0 {
+	if !isFirst {
 		offset = 7
 	}
 	defer op.Offset(image.Pt(0, offset)).Push(gtx.Ops).Pop()
@@ -220,36 +340,133 @@ func (ni *noteItem) layout(gtx C, index int) D {
 	return layout.Dimensions{Size: image.Pt(dims.Size.X, dims.Size.Y+offset)}
 }
 
+// layoutText lays out the title of n with a preview of its content, when
+// it was modified, its word count, folder and tags.
+func (ni *noteItem) layoutText(gtx C, n *note) D {
+	preview, words := n.summary()
+	meta := []string{relativeTime(n.modified, gtx.Now), plural(words, "word")}
+	if n.folder != "" {
+		meta = append(meta, "/"+n.folder)
+	}
+	for _, t := range n.tags {
+		meta = append(meta, "#"+t)
+	}
+	if meta[0] == "" {
+		meta = meta[1:]
+	}
+	return layout.Inset{Top: unit.Dp(3), Bottom: unit.Dp(3)}.Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			// Title and pin
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(1, func(gtx C) D {
+						title := n.title
+						if title == "" {
+							title = "Untitled"
+						}
+						lbl := material.Label(ni.th, unit.Sp(13), title)
+						lbl.MaxLines = 1
+						lbl.Font.Weight = font.Medium
+						return lbl.Layout(gtx)
+					}),
+					layout.Rigid(func(gtx C) D {
+						if !n.isPinned {
+							return D{}
+						}
+						lbl := material.Label(ni.th, unit.Sp(11), "Pinned")
+						lbl.Color = pal.Accent
+						lbl.Font.Weight = font.Bold
+						return layout.Inset{Left: unit.Dp(4), Right: unit.Dp(4)}.Layout(gtx, lbl.Layout)
+					}),
+				)
+			}),
+			// Preview
+			layout.Rigid(func(gtx C) D {
+				if preview == "" {
+					return D{}
+				}
+				lbl := material.Label(ni.th, unit.Sp(12), preview)
+				lbl.MaxLines = 2
+				lbl.Color.A = 170
+				return lbl.Layout(gtx)
+			}),
+			// Modified time, word count, folder and tags
+			layout.Rigid(func(gtx C) D {
+				lbl := material.Label(ni.th, unit.Sp(11), strings.Join(meta, " · "))
+				lbl.MaxLines = 1
+				lbl.Color.A = 130
+				return lbl.Layout(gtx)
+			}),
+		)
+	})
+}
+
 type notesPane struct {
 	// Widget
 	th         *material.Theme
 	searchIco  image.Image
 	addNoteBtn button
+	todayBtn   button
+	notesTab   widget.Clickable
+	journalTab widget.Clickable
+	calendar   calendar
+	tmplBtn    button
+	tmplItems  []widget.Clickable
+	manageBtn  widget.Clickable
+	replaceBtn button
+	bulkBtns   [5]button // Delete, move, tag, pin and export the selection
 	noteItem   noteItem
 	notesListW widget.List
 	searchBarW widget.Editor
+	// States
+	isTmplMenuOpen bool
+	showJournal    bool
+	lastSearch     string
+	visible        []int // Indices of the notes shown in the list
+	journalDays    map[string]bool
 	// States refs
-	scratchNotes *[]note
+	commands     *commands
 	notes        *[]note
+	templates    *[]noteTemplate
 	selectedNote *int
-	isEditorOpen *bool
+	// Callbacks
+	onSelect  func(i int)
+	onOpenTab func(i int)
 }
 
-func newNotesPane(th *material.Theme, searchIco image.Image, noteIco image.Image, scratchNotes *[]note,
-	notes *[]note, selectedNote *int, isEditorOpen *bool) notesPane {
+func newNotesPane(th *material.Theme, searchIco image.Image, noteIco image.Image, cmds *commands,
+	notes *[]note, templates *[]noteTemplate, selectedNote *int, onSelect, onOpenTab func(i int)) notesPane {
 
 	np := notesPane{
 		th:           th,
-		scratchNotes: scratchNotes,
+		commands:     cmds,
+		templates:    templates,
 		notes:        notes,
 		selectedNote: selectedNote,
-		isEditorOpen: isEditorOpen,
+		onSelect:     onSelect,
+		onOpenTab:    onOpenTab,
 		searchIco:    searchIco,
 		addNoteBtn: button{
 			th:         th,
 			label:      "Add Note",
 			isDisabled: false,
 		},
+		tmplBtn: button{
+			th:    th,
+			label: "▾",
+		},
+		todayBtn: button{
+			th:    th,
+			label: "Today",
+		},
+		calendar: newCalendar(th),
+		replaceBtn: button{
+			th:    th,
+			label: "Replace…",
+		},
+	}
+	for i, label := range []string{"Delete", "Move…", "Tag…", "Pin", "Export…"} {
+		np.bulkBtns[i] = button{th: th, label: label}
 	}
 	np.noteItem = noteItem{ // init note item
 		th:  th,
@@ -263,6 +480,9 @@ func newNotesPane(th *material.Theme, searchIco image.Image, noteIco image.Image
 		handleUnhover:  np.handleUnhoverNote,
 		handleSelect:   np.handleSelectNote,
 		handleUnselect: np.handleUnselectNote,
+		handleOpenTab:  np.handleOpenTab,
+		handleToggle:   np.handleToggleNote,
+		handleRange:    np.handleSelectRange,
 	}
 	return np
 }
@@ -294,67 +514,268 @@ func (np *notesPane) handleUnhoverNote(i int) {
 func (np *notesPane) handleSelectNote(i int) {
 	*np.selectedNote = i
 	(*np.notes)[i].isSelected = true
-	*np.isEditorOpen = true
+	if np.onSelect != nil {
+		np.onSelect(i)
+	}
 }
 
 func (np *notesPane) handleUnselectNote(i int) {
+	if i < 0 || i >= len(*np.notes) {
+		return
+	}
 	*np.selectedNote = -1
 	(*np.notes)[i].isSelected = false
-	*np.isEditorOpen = false
 }
 
-func (np *notesPane) searchNotes(query string) {
-	query = strings.ToLower(query)
-	*np.selectedNote = -1
-	if len(*np.notes) == 0 && len(*np.scratchNotes) == 0 {
+func (np *notesPane) handleOpenTab(i int) {
+	if np.onOpenTab != nil {
+		np.onOpenTab(i)
+	}
+}
+
+// handleToggleNote adds note i to the selection or removes it.
+func (np *notesPane) handleToggleNote(i int) {
+	(*np.notes)[i].isSelected = !(*np.notes)[i].isSelected
+}
+
+// handleSelectRange selects the notes of the list from the open one to
+// note i.
+func (np *notesPane) handleSelectRange(i int) {
+	from := slices.Index(np.visible, *np.selectedNote)
+	if from < 0 {
+		np.handleSelectNote(i)
 		return
 	}
-	var tempNotes []note
-	if np.scratchNotes == nil {
-		for _, v := range *np.notes {
-			if strings.Contains(strings.ToLower(v.title), query) {
-				tempNotes = append(tempNotes, v)
-			}
+	to := slices.Index(np.visible, i)
+	for p := min(from, to); p <= max(from, to); p++ {
+		(*np.notes)[np.visible[p]].isSelected = true
+	}
+}
+
+// selection returns the indices of the selected notes.
+func (np *notesPane) selection() []int {
+	var sel []int
+	for i, n := range *np.notes {
+		if n.isSelected {
+			sel = append(sel, i)
 		}
-		*np.scratchNotes = *np.notes
-	} else {
-		for _, v := range *np.scratchNotes {
-			if strings.Contains(strings.ToLower(v.title), query) {
-				tempNotes = append(tempNotes, v)
-			}
+	}
+	return sel
+}
+
+// markSelected highlights note i alone, or none if i is -1, without
+// opening it.
+func (np *notesPane) markSelected(i int) {
+	for k := range *np.notes {
+		(*np.notes)[k].isSelected = false
+	}
+	*np.selectedNote = -1
+	if i >= 0 && i < len(*np.notes) {
+		*np.selectedNote = i
+		(*np.notes)[i].isSelected = true
+	}
+}
+
+// addNote appends n to the notes and opens it in the editor.
+func (np *notesPane) addNote(n note) {
+	np.showJournal = n.journal != ""
+	if n.id == "" {
+		n.id = store.NewID()
+	}
+	n.touch()
+	*np.notes = append(*np.notes, n)
+	np.handleUnselectNote(*np.selectedNote)
+	np.handleSelectNote(len(*np.notes) - 1)
+}
+
+// layoutBulkActions lays out the actions on the selected notes while
+// several are selected.
+func (np *notesPane) layoutBulkActions(gtx C) D {
+	n := len(np.selection())
+	if n < 2 {
+		return D{}
+	}
+	actions := []string{ACTION_DELETE_NOTE, ACTION_MOVE_NOTES, ACTION_TAG_NOTES, ACTION_PIN_NOTES, ACTION_EXPORT_NOTES}
+	children := []layout.FlexChild{}
+	for i := range np.bulkBtns {
+		i, action := i, actions[i]
+		np.bulkBtns[i].onClick = func() { np.commands.run(action) }
+		children = append(children, layout.Rigid(func(gtx C) D {
+			return layout.Inset{Right: unit.Dp(4), Top: unit.Dp(4)}.Layout(gtx, np.bulkBtns[i].layout)
+		}))
+	}
+	return layout.Inset{Top: unit.Dp(7)}.Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(material.Body2(np.th, plural(n, "note")+" selected").Layout),
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+			}),
+		)
+	})
+}
+
+func (np *notesPane) layoutTemplateMenu(gtx C) D {
+	if len(np.tmplItems) != len(*np.templates) {
+		np.tmplItems = make([]widget.Clickable, len(*np.templates))
+	}
+	item := func(c *widget.Clickable, label string) layout.FlexChild {
+		return layout.Rigid(func(gtx C) D {
+			return material.Clickable(gtx, c, func(gtx C) D {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.UniformInset(unit.Dp(6)).Layout(gtx, material.Label(np.th, unit.Sp(13), label).Layout)
+			})
+		})
+	}
+	var children []layout.FlexChild
+	for i := range np.tmplItems {
+		if np.tmplItems[i].Clicked(gtx) {
+			np.isTmplMenuOpen = false
+			np.addNote(expandTemplate((*np.templates)[i], time.Now()))
 		}
+		children = append(children, item(&np.tmplItems[i], (*np.templates)[i].Name))
 	}
-	*np.notes = tempNotes
+	if np.manageBtn.Clicked(gtx) {
+		np.isTmplMenuOpen = false
+		np.commands.run(ACTION_TEMPLATES)
+	}
+	children = append(children, item(&np.manageBtn, "Manage templates…"))
+	return layout.Inset{Top: unit.Dp(7)}.Layout(gtx, func(gtx C) D {
+		return layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+				paint.ColorOp{Color: pal.Surface}.Add(gtx.Ops)
+				paint.PaintOp{}.Add(gtx.Ops)
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+			},
+		)
+	})
+}
+
+// searchNotes lists the notes of the current tab matching query, pinned
+// ones first. Notes match like on the command line and in the API, see
+// store.Record.Matches.
+func (np *notesPane) searchNotes(query string) {
+	query = strings.ToLower(query)
+	np.visible = np.visible[:0]
+	for i, v := range *np.notes {
+		if (v.journal != "") != np.showJournal {
+			continue
+		}
+		if v.record().Matches(query) {
+			np.visible = append(np.visible, i)
+		}
+	}
+	slices.SortStableFunc(np.visible, func(i, j int) int {
+		pi, pj := (*np.notes)[i].isPinned, (*np.notes)[j].isPinned
+		switch {
+		case pi && !pj:
+			return -1
+		case pj && !pi:
+			return 1
+		}
+		return 0
+	})
 }
 
 func (np *notesPane) updateNotes(gtx C) {
+	// Check tabs
+	if np.notesTab.Clicked(gtx) && np.showJournal {
+		np.showJournal = false
+		np.handleUnselectNote(*np.selectedNote)
+	}
+	if np.journalTab.Clicked(gtx) && !np.showJournal {
+		np.showJournal = true
+		np.handleUnselectNote(*np.selectedNote)
+	}
 	// Check search
-	prevSearch := np.searchBarW.Text()
-	if s := np.searchBarW.Text(); s != prevSearch {
-		if s == "" {
-			np.addNoteBtn.isDisabled = false
-			if np.scratchNotes != nil {
-				*np.notes = *np.scratchNotes
-				np.scratchNotes = nil
-			}
-		} else {
-			np.addNoteBtn.isDisabled = true
-			*np.isEditorOpen = false
-			if len(*np.notes) != 0 && *np.selectedNote != -1 {
-				(*np.notes)[*np.selectedNote].isSelected = false
-			}
-			np.searchNotes(s)
+	if s := np.searchBarW.Text(); s != np.lastSearch {
+		np.lastSearch = s
+		np.addNoteBtn.isDisabled = s != ""
+		if s != "" {
+			np.handleUnselectNote(*np.selectedNote)
 		}
 		gtx.Execute(op.InvalidateCmd{})
 	}
+	np.searchNotes(np.lastSearch)
+	// Collect the days with journal notes for the calendar
+	if np.showJournal {
+		clear(np.journalDays)
+		if np.journalDays == nil {
+			np.journalDays = map[string]bool{}
+		}
+		for _, n := range *np.notes {
+			if n.journal != "" {
+				np.journalDays[n.journal] = true
+			}
+		}
+	}
+}
+
+// processKeys focuses the notes list when it is clicked so it gets the
+// keys of the list commands.
+func (np *notesPane) processKeys(gtx C) {
+	tag := &np.notesListW
+	for {
+		ev, ok := gtx.Event(key.FocusFilter{Target: tag}, pointer.Filter{Target: tag, Kinds: pointer.Press})
+		if !ok {
+			break
+		}
+		if _, ok := ev.(pointer.Event); ok {
+			gtx.Execute(key.FocusCmd{Tag: tag})
+		}
+	}
+}
+
+// moveSelection selects the note dir places away from the selected one in
+// the list, or the first one if none is selected.
+func (np *notesPane) moveSelection(dir int) {
+	if len(np.visible) == 0 {
+		return
+	}
+	pos := slices.Index(np.visible, *np.selectedNote)
+	if pos < 0 {
+		pos = 0
+	} else {
+		pos = max(0, min(pos+dir, len(np.visible)-1))
+	}
+	np.handleUnselectNote(*np.selectedNote)
+	np.handleSelectNote(np.visible[pos])
+	// Keep the selected note in view
+	if p := np.notesListW.Position; pos < p.First || pos >= p.First+p.Count-1 {
+		np.notesListW.ScrollTo(max(0, pos-p.Count/2))
+	}
+}
+
+// jumpTo selects note i, switching tabs and clearing the search as needed
+// to show it.
+func (np *notesPane) jumpTo(i int) {
+	np.showJournal = (*np.notes)[i].journal != ""
+	np.clearSearch()
+	np.handleUnselectNote(*np.selectedNote)
+	np.handleSelectNote(i)
+}
+
+func (np *notesPane) clearSearch() {
+	np.searchBarW.SetText("")
+	np.lastSearch = ""
+	np.addNoteBtn.isDisabled = false
+}
+
+// hasJournal reports whether there is a journal note for date.
+func (np *notesPane) hasJournal(date string) bool {
+	return np.journalDays[date]
 }
 
 func (np *notesPane) layout(gtx C) D {
 	// Update notes
 	np.updateNotes(gtx)
+	np.processKeys(gtx)
 
-	w := 230
-	gtx.Constraints.Max.X, gtx.Constraints.Min.X = w, w // hardcode width
+	gtx.Constraints.Min.X = gtx.Constraints.Max.X
 
 	return layout.Flex{
 		Axis: layout.Vertical,
@@ -366,14 +787,14 @@ func (np *notesPane) layout(gtx C) D {
 				func(gtx C) D {
 					sz := gtx.Constraints.Min
 					defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
-					paint.ColorOp{Color: color.NRGBA{255, 255, 255, 20}}.Add(gtx.Ops)
+					paint.ColorOp{Color: pal.Hover}.Add(gtx.Ops)
 					paint.PaintOp{}.Add(gtx.Ops)
 					return layout.Dimensions{Size: sz}
 				},
 				// Layout content
 				func(gtx C) D {
 					return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx C) D {
-						edit := material.Editor(np.th, &np.searchBarW, "Search")
+						edit := material.Editor(np.th, &np.searchBarW, "Search, #tag or /folder")
 						edit.Font.Style = font.Italic
 						edit.TextSize = unit.Sp(14)
 						img := widget.Image{Src: paint.NewImageOp(np.searchIco)}
@@ -392,33 +813,89 @@ func (np *notesPane) layout(gtx C) D {
 		}),
 		// Layout spacer
 		layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout),
+		// Layout notes/journal tabs and 'Today' button
+		layout.Rigid(func(gtx C) D {
+			np.todayBtn.onClick = func() { np.commands.run(ACTION_TODAY) }
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					return layoutTab(gtx, np.th, &np.notesTab, "Notes", !np.showJournal)
+				}),
+				layout.Rigid(func(gtx C) D {
+					return layoutTab(gtx, np.th, &np.journalTab, "Journal", np.showJournal)
+				}),
+				layout.Flexed(1, func(gtx C) D {
+					return D{Size: image.Pt(gtx.Constraints.Max.X, 0)}
+				}),
+				layout.Rigid(np.todayBtn.layout),
+			)
+		}),
+		// Layout calendar for journal notes
+		layout.Rigid(func(gtx C) D {
+			if !np.showJournal {
+				return D{}
+			}
+			return layout.Inset{Top: unit.Dp(7)}.Layout(gtx, func(gtx C) D {
+				return np.calendar.layout(gtx, np.hasJournal, func(day time.Time) {
+					// Only today's note is created on click
+					today := day.Format(JOURNAL_DATE) == time.Now().Format(JOURNAL_DATE)
+					np.openJournal(day, today)
+				})
+			})
+		}),
+		// Layout spacer
+		layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout),
 		// Layout note items list widget
 		layout.Flexed(0.5, func(gtx C) D {
 			return layout.Background{}.Layout(gtx,
-				// Set background for list
+				// Set background for list, outlined while it has focus
 				func(gtx C) D {
 					sz := gtx.Constraints.Min
-					defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 7).Push(gtx.Ops).Pop()
-					paint.ColorOp{Color: color.NRGBA{27, 27, 30, 255}}.Add(gtx.Ops)
-					paint.PaintOp{}.Add(gtx.Ops)
+					rr := clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 7)
+					paint.FillShape(gtx.Ops, pal.Well, rr.Op(gtx.Ops))
+					if gtx.Focused(&np.notesListW) {
+						paint.FillShape(gtx.Ops, pal.Accent, clip.Stroke{Path: rr.Path(gtx.Ops), Width: float32(gtx.Dp(1))}.Op())
+					}
 					return layout.Dimensions{Size: sz}
 				},
 				// Layout the list
 				func(gtx C) D {
+					// Keys go to the list once it was clicked
+					defer clip.Rect{Max: gtx.Constraints.Max}.Push(gtx.Ops).Pop()
+					event.Op(gtx.Ops, &np.notesListW)
 					return layout.UniformInset(unit.Dp(4)).Layout(gtx, func(gtx C) D {
-						return material.List(np.th, &np.notesListW).Layout(gtx, len(*np.notes), np.noteItem.layout)
+						return material.List(np.th, &np.notesListW).Layout(gtx, len(np.visible), func(gtx C, i int) D {
+							return np.noteItem.layout(gtx, np.visible[i], i == 0)
+						})
 					})
 				},
 			)
 		}),
+		// Layout bulk actions of the selection
+		layout.Rigid(np.layoutBulkActions),
+		// Layout templates menu
+		layout.Rigid(func(gtx C) D {
+			if !np.isTmplMenuOpen {
+				return D{}
+			}
+			return np.layoutTemplateMenu(gtx)
+		}),
 		// Layout spacer
 		layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout),
-		// Layout 'Add Note' button
+		// Layout 'Add Note' split button and 'Replace' button
 		layout.Rigid(func(gtx C) D {
-			np.addNoteBtn.onClick = func() {
-				*np.notes = append(*np.notes, note{title: "Untitled"})
+			np.addNoteBtn.onClick = func() { np.commands.run(ACTION_NEW_NOTE) }
+			np.tmplBtn.onClick = func() {
+				np.isTmplMenuOpen = !np.isTmplMenuOpen
 			}
-			return np.addNoteBtn.layout(gtx)
+			np.tmplBtn.isDisabled = np.addNoteBtn.isDisabled
+			np.replaceBtn.onClick = func() { np.commands.run(ACTION_REPLACE_ALL) }
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Flexed(1, np.addNoteBtn.layout),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(1)}.Layout),
+				layout.Rigid(np.tmplBtn.layout),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout),
+				layout.Rigid(np.replaceBtn.layout),
+			)
 		}),
 	)
 }
@@ -458,37 +935,153 @@ func (i *icoButton) layout(gtx C) D {
 	return dims
 }
 
+// entry lays out a single line text entry with a rounded background.
+func entry(th *material.Theme, ed *widget.Editor, hint string) layout.Widget {
+	return func(gtx C) D {
+		return layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+				paint.ColorOp{Color: pal.Hover}.Add(gtx.Ops)
+				paint.PaintOp{}.Add(gtx.Ops)
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				edit := material.Editor(th, ed, hint)
+				edit.TextSize = unit.Sp(14)
+				return layout.UniformInset(unit.Dp(6)).Layout(gtx, edit.Layout)
+			},
+		)
+	}
+}
+
 type editorPane struct {
 	// Wigets
-	th          *material.Theme
-	prompt      *msgPrompt
-	notif       *notification
-	trashBtn    icoButton
-	titleEditor widget.Editor
-	noteEditor  widget.Editor
+	th         *material.Theme
+	trashBtn   icoButton
+	previewBtn button
+	detachBtn  button
+	tabsListW  layout.List
+	preview    notePreview
+	findBar    findBar
+	// States
+	isPreview bool
+	dropTag   bool // Target of files dropped on the note editor
+	tabs      []*noteTab
+	active    int     // Index of the active tab
+	noTab     noteTab // Stands in for the active tab while no note is open
 	// States refs
-	scratchNotes *[]note
+	commands     *commands
+	attachments  *attachments
+	settings     *settings
 	notes        *[]note
-	selectedNote *int
 	isEditorOpen *bool
+	// Callbacks
+	onActivate func(i int) // Gets the note of the active tab, -1 if none
+	onEdit     func()
 }
 
-func newEditorPane(th *material.Theme, trashIco image.Image, prompt *msgPrompt, notif *notification) editorPane {
+func newEditorPane(th *material.Theme, trashIco image.Image, cmds *commands,
+	attachments *attachments, settings *settings, notes *[]note, isEditorOpen *bool, onActivate func(i int), onEdit func()) editorPane {
 	e := editorPane{
-		th:     th,
-		prompt: prompt,
-		notif:  notif,
+		th: th,
 		trashBtn: icoButton{
 			ico: trashIco,
 		},
+		previewBtn: button{
+			th:    th,
+			label: "Preview",
+		},
+		detachBtn: button{
+			th:    th,
+			label: "Pop out",
+		},
+		preview:      newNotePreview(th, attachments, settings),
+		findBar:      newFindBar(th),
+		commands:     cmds,
+		attachments:  attachments,
+		settings:     settings,
+		notes:        notes,
+		isEditorOpen: isEditorOpen,
+		onActivate:   onActivate,
+		onEdit:       onEdit,
+		tabsListW:    layout.List{Axis: layout.Horizontal},
 	}
 	return e
 }
 
+// attachPasted turns pasted file URIs into attachments. It returns false
+// if the change from prev wasn't a paste of files.
+func (e *editorPane) attachPasted(prev, cur string) bool {
+	start, end := insertedText(prev, cur)
+	refs, ok := e.attachFiles(pastedFiles(cur[start:end]))
+	if !ok {
+		return false
+	}
+	// Replace the pasted URIs, keeping it undoable
+	runeStart := utf8.RuneCountInString(cur[:start])
+	ed := &e.tab().noteEditor
+	ed.SetCaret(runeStart, runeStart+utf8.RuneCountInString(cur[start:end]))
+	ed.Insert(refs)
+	return true
+}
+
+// processDrops attaches the files dropped on the note editor at the caret.
+func (e *editorPane) processDrops(gtx C) {
+	for {
+		ev, ok := gtx.Event(transfer.TargetFilter{Target: &e.dropTag, Type: "text/uri-list"})
+		if !ok {
+			break
+		}
+		de, ok := ev.(transfer.DataEvent)
+		if !ok {
+			continue
+		}
+		r := de.Open()
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || e.current() < 0 || e.isPreview {
+			continue
+		}
+		if refs, ok := e.attachFiles(pastedFiles(string(data))); ok {
+			e.tab().noteEditor.Insert(refs)
+		}
+	}
+}
+
+// attachFiles adds files as attachments and returns their references, one
+// per line.
+func (e *editorPane) attachFiles(files []string) (string, bool) {
+	if len(files) == 0 {
+		return "", false
+	}
+	var refs []string
+	for _, f := range files {
+		ref, err := e.attachments.add(f)
+		if err != nil {
+			return "", false
+		}
+		refs = append(refs, ref)
+	}
+	return strings.Join(refs, "\n"), true
+}
+
 func (e *editorPane) layout(gtx C) D {
+	// Handle find bar shortcuts
+	t := e.tab()
+	e.findBar.processKeys(gtx, &t.noteEditor)
+	// Pick up edits made in other windows
+	if i := e.current(); i >= 0 {
+		t.sync(&(*e.notes)[i])
+	}
+
 	return layout.Flex{
 		Axis: layout.Vertical,
 	}.Layout(gtx,
+		// Tabs
+		layout.Rigid(func(gtx C) D {
+			return layout.Inset{Bottom: unit.Dp(7)}.Layout(gtx, e.layoutTabs)
+		}),
 		// Top row
 		layout.Rigid(func(gtx C) D {
 			return layout.Flex{
@@ -498,9 +1091,9 @@ func (e *editorPane) layout(gtx C) D {
 				// Title entry
 				layout.Flexed(0.5, func(gtx C) D {
 					// Get the last title
-					prevTitle := e.titleEditor.Text()
+					prevTitle := t.titleEditor.Text()
 					// Layout everything
-					edit := material.Editor(e.th, &e.titleEditor, "Title")
+					edit := material.Editor(e.th, &t.titleEditor, "Title")
 					edit.Font.Style = font.Italic
 					edit.TextSize = unit.Sp(16)
 					dims := layout.Background{}.Layout(gtx,
@@ -508,7 +1101,7 @@ func (e *editorPane) layout(gtx C) D {
 						func(gtx C) D {
 							sz := gtx.Constraints.Min
 							defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
-							paint.ColorOp{Color: color.NRGBA{255, 255, 255, 20}}.Add(gtx.Ops)
+							paint.ColorOp{Color: pal.Hover}.Add(gtx.Ops)
 							paint.PaintOp{}.Add(gtx.Ops)
 							return layout.Dimensions{Size: sz}
 						},
@@ -518,67 +1111,97 @@ func (e *editorPane) layout(gtx C) D {
 						},
 					)
 					// Update states
-					if s := e.titleEditor.Text(); s != prevTitle {
-						(*e.notes)[*e.selectedNote].title = s
+					if i := e.current(); i >= 0 && t.titleEditor.Text() != prevTitle {
+						(*e.notes)[i].title = t.titleEditor.Text()
+						(*e.notes)[i].touch()
+						e.onEdit()
 						gtx.Execute(op.InvalidateCmd{})
 					}
 					return dims
 				}),
 				// Spacer
 				layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout),
-				// Trash button
+				// Preview toggle
 				layout.Rigid(func(gtx C) D {
-					e.trashBtn.onClick = func() {
-						e.prompt.onConfirm = func() {
-							// Delete note pointed to by currentInd
-							t := (*e.notes)[*e.selectedNote].title
-							c := (*e.notes)[*e.selectedNote].content
-							*e.notes = slices.Delete(*e.notes, *e.selectedNote, *e.selectedNote+1)
-							for i := range *e.scratchNotes {
-								b := strings.Contains((*e.scratchNotes)[i].title, t) &&
-									strings.Contains((*e.scratchNotes)[i].content, c)
-								if b {
-									*e.scratchNotes = slices.Delete(*e.scratchNotes, i, i+1)
-									break
-								}
-							}
-							*e.isEditorOpen = !*e.isEditorOpen
-							*e.selectedNote = -1
-							// e.prompt.resetOffset()
-							// e.prompt.isAnimating = true
-							// e.prompt.isPromptOpen = !e.prompt.isPromptOpen
-						}
+					e.previewBtn.onClick = func() { e.commands.run(ACTION_TOGGLE_PREVIEW) }
+					e.previewBtn.label = "Preview"
+					if e.isPreview {
+						e.previewBtn.label = "Edit"
 					}
+					return e.previewBtn.layout(gtx)
+				}),
+				// Spacer
+				layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout),
+				// Pop out button
+				layout.Rigid(func(gtx C) D {
+					e.detachBtn.onClick = func() { e.commands.run(ACTION_DETACH) }
+					return e.detachBtn.layout(gtx)
+				}),
+				// Spacer
+				layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout),
+				// Trash button
+				layout.Rigid(func(gtx C) D {
+					e.trashBtn.onClick = func() { e.commands.run(ACTION_DELETE_NOTE) }
 					return e.trashBtn.layout(gtx)
 				}),
 			)
 		}),
 		// Spacer
 		layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout),
+		// Find bar
+		layout.Rigid(func(gtx C) D {
+			if !e.findBar.isOpen {
+				return D{}
+			}
+			return layout.Inset{Bottom: unit.Dp(7)}.Layout(gtx, func(gtx C) D {
+				return e.findBar.layout(gtx, &t.noteEditor, t.noteEditor.Text())
+			})
+		}),
 		// Note editor
 		layout.Flexed(0.5, func(gtx C) D {
 			// Get the last note text
-			prevNote := e.noteEditor.Text()
+			prevNote := t.noteEditor.Text()
 			// Layout everything
-			edit := material.Editor(e.th, &e.noteEditor, "Write something...")
-			edit.TextSize = unit.Sp(14)
+			edit := material.Editor(e.th, &t.noteEditor, "Write something...")
+			edit.TextSize = unit.Sp(e.settings.FontSize)
+			edit.Font.Typeface = font.Typeface(e.settings.FontFamily)
+			content := func(gtx C) D {
+				dims := edit.Layout(gtx)
+				e.findBar.paintMatches(gtx, &t.noteEditor)
+				return dims
+			}
+			if e.isPreview {
+				content = func(gtx C) D {
+					return e.preview.layout(gtx, prevNote)
+				}
+			}
 			dims := layout.Background{}.Layout(gtx,
 				// Set a background
 				func(gtx C) D {
 					sz := gtx.Constraints.Min
 					defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
-					paint.ColorOp{Color: color.NRGBA{23, 23, 26, 255}}.Add(gtx.Ops)
+					paint.ColorOp{Color: pal.Editor}.Add(gtx.Ops)
 					paint.PaintOp{}.Add(gtx.Ops)
 					return layout.Dimensions{Size: sz}
 				},
 				// Layout the note editor
 				func(gtx C) D {
-					return layout.UniformInset(unit.Dp(8)).Layout(gtx, edit.Layout)
+					dims := layout.UniformInset(unit.Dp(8)).Layout(gtx, content)
+					defer clip.Rect{Max: dims.Size}.Push(gtx.Ops).Pop()
+					event.Op(gtx.Ops, &e.dropTag)
+					return dims
 				},
 			)
+			e.processDrops(gtx)
 			// Update states
-			if s := e.noteEditor.Text(); s != prevNote {
-				(*e.notes)[*e.selectedNote].content = s
+			if i := e.current(); i >= 0 && t.noteEditor.Text() != prevNote {
+				s := t.noteEditor.Text()
+				if e.attachPasted(prevNote, s) {
+					s = t.noteEditor.Text()
+				}
+				(*e.notes)[i].content = s
+				(*e.notes)[i].touch()
+				e.onEdit()
 				gtx.Execute(op.InvalidateCmd{})
 			}
 			return dims
@@ -586,225 +1209,41 @@ func (e *editorPane) layout(gtx C) D {
 	)
 }
 
-type notification struct {
-	th          *material.Theme
-	xcircleIco  image.Image
-	isAnimating bool
-	offsetY     float32
-}
-
-func newNotification(th *material.Theme, xcircleIco image.Image) notification {
-	return notification{
-		th:         th,
-		xcircleIco: xcircleIco,
-	}
-}
-
-func (nf *notification) layout(gtx C) D {
-	macro := op.Record(gtx.Ops)
-	dims := layout.Background{}.Layout(gtx,
-		func(gtx C) D {
-			sz := gtx.Constraints.Min
-			defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
-			paint.ColorOp{Color: color.NRGBA{70, 219, 88, 255}}.Add(gtx.Ops)
-			paint.PaintOp{}.Add(gtx.Ops)
-			return D{Size: sz}
-		},
-		func(gtx C) D {
-			return layout.Flex{
-				Axis:      layout.Horizontal,
-				Alignment: layout.Middle,
-			}.Layout(gtx,
-				// Message
-				layout.Flexed(0.5, func(gtx C) D {
-					cgtx := gtx
-					cgtx.Constraints.Min.Y = 14
-					th_ := *nf.th
-					th_.Fg = color.NRGBA{23, 27, 23, 255}
-					lbl := material.Label(&th_, unit.Sp(14), "Successfully deleted note!")
-					lbl.Font.Weight = font.ExtraBold
-					lbl.Alignment = text.Middle
-					return lbl.Layout(cgtx)
-				}),
-				// Cross button to hide notification from view
-				layout.Rigid(func(gtx C) D {
-					img := widget.Image{Src: paint.NewImageOp(nf.xcircleIco)}
-					img.Position = layout.Center
-					macro := op.Record(gtx.Ops)
-					dims := img.Layout(gtx)
-					call := macro.Stop()
-					// Tag event area
-					defer clip.Rect{Max: dims.Size}.Push(gtx.Ops).Pop()
-					event.Op(gtx.Ops, &nf.xcircleIco)
-					// Check for events
-					for {
-						ev, ok := gtx.Source.Event(pointer.Filter{
-							Target: &nf.xcircleIco,
-							Kinds:  pointer.Press | pointer.Release,
-						})
-						if !ok {
-							break
-						}
-						if x, ok := ev.(pointer.Event); ok {
-							switch x.Kind {
-							case pointer.Release:
-								// msg.resetOffset()
-								gtx.Execute(op.InvalidateCmd{})
-							}
-						}
-					}
-					call.Add(gtx.Ops)
-					return dims
-				}),
-				layout.Rigid(layout.Spacer{Width: unit.Dp(3)}.Layout),
-			)
-		},
-	)
-	call := macro.Stop()
-
-	// Mark event area
-	defer clip.Rect{Max: dims.Size}.Push(gtx.Ops).Pop()
-
-	if nf.isAnimating { // Animate
-		nf.offsetY += 0.7
-		if nf.offsetY > float32(dims.Size.Y) {
-			nf.offsetY = float32(dims.Size.Y)
-			nf.isAnimating = false
-		}
-		gtx.Execute(op.InvalidateCmd{})
-		offset := float32(dims.Size.Y) - nf.offsetY
-		if offset <= 0.005 {
-			offset = 0
-		}
-		defer op.Offset(image.Pt(0, int(offset))).Push(gtx.Ops).Pop()
-		call.Add(gtx.Ops)
-	} else {
-		nf.offsetY = 0 // Reset offset when not animating
-		call.Add(gtx.Ops)
-	}
-
-	return dims
-}
-
-func (nf *notification) show() {
-	nf.isAnimating = true
-}
-
-type msgPrompt struct {
-	th                                *material.Theme
-	errorIco                          image.Image
-	onConfirm                         func()
-	cancelClickable, confirmClickable widget.Clickable
-	isPromptOpen                      bool
-	backdropTag                       int
-	w, h                              int
-}
-
-func newMsgPrompt(th *material.Theme, w, h int, errorIco image.Image) msgPrompt {
-	return msgPrompt{
-		th:       th,
-		w:        w,
-		h:        h,
-		errorIco: errorIco,
-	}
-}
-
-func (p *msgPrompt) open() {
-	p.isPromptOpen = true
-}
-
-func (p *msgPrompt) close() {
-	p.isPromptOpen = false
-}
-
-func (p *msgPrompt) layout(gtx C) D {
+// layoutModal draws content in a box of at most w by h centered over a
+// backdrop, shrinking the box to fit small windows. A h of 0 fits the box
+// to the content.
+func layoutModal(gtx C, backdropTag event.Tag, w, h unit.Dp, content layout.Widget) D {
 	// Set a backdrop
 	trans := clip.Rect{Max: gtx.Constraints.Max}.Push(gtx.Ops)
-	paint.ColorOp{Color: color.NRGBA{A: 180}}.Add(gtx.Ops)
+	paint.ColorOp{Color: pal.Backdrop}.Add(gtx.Ops)
 	paint.PaintOp{}.Add(gtx.Ops)
-	event.Op(gtx.Ops, &p.backdropTag)
+	event.Op(gtx.Ops, backdropTag)
 	trans.Pop()
 	// Save constraints and resize constraints min max
-	pt := image.Pt(p.w, p.h)
+	max := gtx.Constraints.Max
+	pt := image.Pt(min(gtx.Dp(w), max.X-gtx.Dp(40)), min(gtx.Dp(h), max.Y-gtx.Dp(40)))
 	savedConstraints := gtx.Constraints
 	gtx.Constraints.Min, gtx.Constraints.Max = pt, pt
+	if h == 0 {
+		gtx.Constraints.Max.Y = max.Y - gtx.Dp(40)
+	}
 	macro := op.Record(gtx.Ops)
 	dims := layout.Background{}.Layout(gtx,
-		// Set a background to popup
+		// Set a background to the box
 		func(gtx C) D {
 			min := gtx.Constraints.Min
 			defer clip.UniformRRect(image.Rect(0, 0, min.X, min.Y), 5).Push(gtx.Ops).Pop()
-			paint.ColorOp{Color: color.NRGBA{60, 60, 63, 255}}.Add(gtx.Ops)
+			paint.ColorOp{Color: pal.Surface}.Add(gtx.Ops)
 			paint.PaintOp{}.Add(gtx.Ops)
 			return layout.Dimensions{Size: min}
 		},
-		// Layout popup
+		// Layout the content with some padding
 		func(gtx C) D {
-			// Process popup actions
-			if p.cancelClickable.Clicked(gtx) {
-				p.isPromptOpen = !p.isPromptOpen
-				gtx.Execute(op.InvalidateCmd{})
-			} else if p.confirmClickable.Clicked(gtx) {
-				p.onConfirm()
-				p.isPromptOpen = !p.isPromptOpen
-				gtx.Execute(op.InvalidateCmd{})
-			}
-			// Give some padding to box and lay it out
-			return layout.UniformInset(unit.Dp(6)).Layout(gtx,
-				func(gtx C) D {
-					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
-						// Popup message
-						layout.Flexed(0.5, func(gtx C) D {
-							return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
-								// Icon
-								layout.Rigid(func(gtx C) D {
-									img := widget.Image{Src: paint.NewImageOp(p.errorIco)}
-									img.Position = layout.Center
-									return img.Layout(gtx)
-								}),
-								// Spacer
-								layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
-								// Message label
-								layout.Flexed(0.5, func(gtx C) D {
-									c := gtx.Constraints
-									c.Min.Y, c.Max.Y = 18, 18
-									gtx.Constraints = c
-									lbl := material.Label(p.th, unit.Sp(16), "Confirm deletion of 1 note item?")
-									lbl.Font.Weight = font.Medium
-									return lbl.Layout(gtx)
-								}),
-							)
-						}),
-						// Spacer
-						layout.Rigid(layout.Spacer{Height: unit.Dp(30)}.Layout),
-						// Action buttons
-						layout.Rigid(func(gtx C) D {
-							return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
-								// Spacer to push below widgets to right
-								layout.Flexed(0.5, func(gtx C) D {
-									c := gtx.Constraints
-									return layout.Dimensions{Size: image.Pt(c.Max.X, c.Min.Y)}
-								}),
-								// OK action
-								layout.Rigid(material.Button(p.th, &p.confirmClickable, "Confirm").Layout),
-								// Spacer
-								layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
-								// Cancel action
-								layout.Rigid(func(gtx C) D {
-									th_ := *p.th
-									th_.Palette.ContrastBg = color.NRGBA{A: 0}
-									return material.Button(&th_, &p.cancelClickable, "Cancel").Layout(gtx)
-								}),
-							)
-						}),
-					)
-				},
-			)
+			return layout.UniformInset(unit.Dp(10)).Layout(gtx, content)
 		},
 	)
 	call := macro.Stop()
 	gtx.Constraints = savedConstraints
-	max := gtx.Constraints.Max
 	x := math.Round(float64(max.X)/2 - float64(dims.Size.X)/2)
 	y := math.Round(float64(max.Y)/2 - float64(dims.Size.Y)/2)
 	defer op.Offset(image.Pt(int(x), int(y))).Push(gtx.Ops).Pop()
@@ -813,11 +1252,59 @@ func (p *msgPrompt) layout(gtx C) D {
 }
 
 func (a *App) Layout(gtx C) D {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	wasLocked := a.lock.isLocked
+	// Shortcuts
+	a.isListFocused = gtx.Focused(&a.notesPane.notesListW) || gtx.Focused(&a.notesPane.searchBarW)
+	if !a.dialog.isOpen && !a.lock.isLocked && a.commands.processKeys(gtx) {
+		a.lock.active(gtx.Now)
+	}
+	if a.focus != nil {
+		gtx.Execute(key.FocusCmd{Tag: a.focus})
+		a.focus = nil
+	}
+	// Save every now and then
+	if d := time.Duration(a.settings.Autosave) * time.Second; d > 0 {
+		if a.nextSave.IsZero() || a.nextSave.Sub(gtx.Now) > d {
+			a.nextSave = gtx.Now.Add(d)
+		}
+		if !gtx.Now.Before(a.nextSave) {
+			a.toasts.showError("Couldn't save notes", a.autosave())
+			a.nextSave = gtx.Now.Add(d)
+		}
+		gtx.Execute(op.InvalidateCmd{At: a.nextSave})
+	}
+	// Lock after a while without input
+	t := a.editorPane.tab()
+	start, end := t.noteEditor.Selection()
+	a.lock.update(gtx, time.Duration(a.settings.LockTimeout)*time.Minute,
+		[5]int{t.noteEditor.Len(), start, end, t.titleEditor.Len(), a.notesPane.searchBarW.Len()})
+	if wasLocked != a.lock.isLocked {
+		a.invalidateWindows()
+	}
+	if a.lock.isLocked {
+		if !wasLocked {
+			a.toasts.showError("Couldn't save notes", a.autosave())
+		}
+		paint.Fill(gtx.Ops, pal.Bg)
+		dims := a.lock.layout(gtx)
+		if !a.lock.isLocked {
+			a.invalidateWindows()
+		}
+		a.lock.watch(gtx)
+		return dims
+	}
+	// Narrow windows show the notes list in a drawer
+	narrow := gtx.Constraints.Max.X < gtx.Dp(NARROW_WIDTH)
+	if !narrow {
+		a.isDrawerOpen = false
+	}
 	dims := layout.Background{}.Layout(gtx,
 		// Set a background
 		func(gtx C) D {
 			defer clip.Rect{Max: gtx.Constraints.Min}.Push(gtx.Ops).Pop()
-			paint.ColorOp{Color: color.NRGBA{40, 40, 43, 255}}.Add(gtx.Ops)
+			paint.ColorOp{Color: pal.Bg}.Add(gtx.Ops)
 			paint.PaintOp{}.Add(gtx.Ops)
 			return layout.Dimensions{Size: gtx.Constraints.Min}
 		},
@@ -827,19 +1314,39 @@ func (a *App) Layout(gtx C) D {
 				return layout.Flex{
 					Axis: layout.Vertical,
 				}.Layout(gtx,
-					// Logo
+					// Logo, the notes drawer toggle of narrow windows and settings
 					layout.Rigid(func(gtx C) D {
-						return widget.Image{Src: paint.NewImageOp(a.logo)}.Layout(gtx)
+						return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+							layout.Rigid(widget.Image{Src: paint.NewImageOp(a.logo)}.Layout),
+							layout.Flexed(1, func(gtx C) D {
+								return D{Size: image.Pt(gtx.Constraints.Max.X, 0)}
+							}),
+							layout.Rigid(func(gtx C) D {
+								if !narrow {
+									return D{}
+								}
+								return layout.Inset{Right: unit.Dp(5)}.Layout(gtx, a.drawerBtn.layout)
+							}),
+							layout.Rigid(a.settingsBtn.layout),
+						)
 					}),
 					// Spacer
 					layout.Rigid(layout.Spacer{Height: unit.Dp(14)}.Layout),
 					// Layout the notesPane and editorPane
 					layout.Flexed(0.5, func(gtx C) D {
+						if narrow {
+							return a.layoutNarrow(gtx)
+						}
 						var children []layout.FlexChild
 						children = append(children,
-							layout.Rigid(a.notesPane.layout),
 							layout.Rigid(func(gtx C) D {
-								return layout.Spacer{Width: unit.Dp(7)}.Layout(gtx)
+								w := gtx.Dp(a.state.NotesWidth)
+								gtx.Constraints.Min.X, gtx.Constraints.Max.X = w, w
+								return a.notesPane.layout(gtx)
+							}),
+							layout.Rigid(func(gtx C) D {
+								maxW := unit.Dp(float32(gtx.Constraints.Max.X)/gtx.Metric.PxPerDp) - MIN_EDITOR_WIDTH
+								return a.splitter.layout(gtx, &a.state.NotesWidth, MIN_NOTES_WIDTH, max(maxW, MIN_NOTES_WIDTH))
 							}),
 						)
 						if a.isEditorOpen {
@@ -847,95 +1354,412 @@ func (a *App) Layout(gtx C) D {
 						}
 						return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
 					}),
-					// Spacer
-					layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout),
-					// Layout notification
-					layout.Rigid(a.notif.layout),
 				)
 			})
 		},
 	)
-	// Trigger prompt if requested
-	if a.prompt.isPromptOpen {
-		a.prompt.layout(gtx)
+	if a.dialog.isOpen {
+		a.dialog.layout(gtx)
+	}
+	if a.replaceDlg.isOpen {
+		a.replaceDlg.layout(gtx)
+	}
+	if a.tmplDlg.isOpen {
+		a.tmplDlg.layout(gtx)
 	}
+	if a.settingsDlg.isOpen {
+		a.settingsDlg.layout(gtx)
+	}
+	if a.cmdPalette.isOpen {
+		a.cmdPalette.layout(gtx)
+	}
+	a.toasts.layout(gtx)
+	a.lock.watch(gtx)
 	return dims
 }
 
+// openNote opens note i in the editor, closing the notes drawer of narrow
+// windows.
+func (a *App) openNote(i int) {
+	a.editorPane.open(i)
+	a.isDrawerOpen = false
+}
+
+// openNoteInTab opens note i in a new tab.
+func (a *App) openNoteInTab(i int) {
+	a.editorPane.openTab(i)
+	a.isDrawerOpen = false
+}
+
+// layoutNarrow lays out the editor alone, with the notes list drawn over it
+// while the drawer is open.
+func (a *App) layoutNarrow(gtx C) D {
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx C) D {
+			if a.isEditorOpen {
+				return a.editorPane.layout(gtx)
+			}
+			return layout.Center.Layout(gtx, func(gtx C) D {
+				lbl := material.Label(a.th, unit.Sp(14), "Open the notes list to pick a note")
+				lbl.Color.A = 150
+				return lbl.Layout(gtx)
+			})
+		}),
+		layout.Expanded(func(gtx C) D {
+			if !a.isDrawerOpen {
+				return D{}
+			}
+			// Dim the editor, clicking it closes the drawer
+			sz := gtx.Constraints.Max
+			area := clip.Rect{Max: sz}.Push(gtx.Ops)
+			event.Op(gtx.Ops, &a.isDrawerOpen)
+			paint.ColorOp{Color: pal.Backdrop}.Add(gtx.Ops)
+			paint.PaintOp{}.Add(gtx.Ops)
+			area.Pop()
+			for {
+				ev, ok := gtx.Event(pointer.Filter{Target: &a.isDrawerOpen, Kinds: pointer.Press})
+				if !ok {
+					break
+				}
+				if _, ok := ev.(pointer.Event); ok {
+					a.isDrawerOpen = false
+				}
+			}
+			w := min(gtx.Dp(a.state.NotesWidth), sz.X*85/100)
+			gtx.Constraints.Min.X, gtx.Constraints.Max.X = w, w
+			gtx.Constraints.Min.Y = sz.Y
+			return layout.Background{}.Layout(gtx,
+				func(gtx C) D {
+					defer clip.Rect{Max: gtx.Constraints.Min}.Push(gtx.Ops).Pop()
+					paint.ColorOp{Color: pal.Bg}.Add(gtx.Ops)
+					paint.PaintOp{}.Add(gtx.Ops)
+					return layout.Dimensions{Size: gtx.Constraints.Min}
+				},
+				func(gtx C) D {
+					return layout.Inset{Right: unit.Dp(7)}.Layout(gtx, a.notesPane.layout)
+				},
+			)
+		}),
+	)
+}
+
+// notesChanged is called after notes were changed outside of the editor,
+// it refreshes the editor and saves.
+func (a *App) notesChanged(changed []int) {
+	a.editorPane.refresh(changed)
+	a.invalidateWindows()
+	a.toasts.showError("Couldn't save notes", a.saveSoon())
+}
+
+// notesChangedLocked is notesChanged once the notes are locked, and returns
+// the error of the save.
+func (a *App) notesChangedLocked(changed []int) error {
+	a.editorPane.refresh(changed)
+	a.invalidateWindows()
+	return a.saveLocked()
+}
+
 func (a *App) load() error {
-	// Load secret first if exists otherwise create it
-	secretPath := DATA_DIR + "/" + SECRET_FILE
-	if _, err := os.Stat(secretPath); err == nil {
-		s, _ := os.ReadFile(secretPath)
-		a.secret = string(s)
-	} else {
-		a.secret = a.genSecret(32)
-		err := os.MkdirAll(DATA_DIR, os.ModePerm) // Create relevant dirs
+	var err error
+	a.store, err = store.Open(a.settings.DataDir)
+	if err != nil {
+		return err
+	}
+	records, err := a.store.Load()
+	for _, r := range records {
+		a.notes = append(a.notes, noteFromRecord(r))
+	}
+	a.saved, _ = store.Marshal(records)
+	return err
+}
+
+// marshalNotes returns the notes as saved.
+func (a *App) marshalNotes() ([]byte, error) {
+	var records []store.Record
+	for _, vv := range a.notes {
+		records = append(records, vv.record())
+	}
+	return store.Marshal(records)
+}
+
+// collectGarbage removes the attachments no note or template refers to.
+// It only runs at launch, so that undoing the removal of a link during the
+// session always finds its attachment.
+func (a *App) collectGarbage() error {
+	var contents []string
+	for _, n := range a.notes {
+		contents = append(contents, n.content)
+	}
+	for _, t := range a.templates {
+		contents = append(contents, t.Content)
+	}
+	return a.attachments.collectGarbage(contents)
+}
+
+// Save saves the notes and the state of the window, waiting for another
+// process holding the notes lock if need be.
+func (a *App) Save() error {
+	unlock, err := a.lockStore()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return a.saveLocked()
+}
+
+// lockStore takes the notes lock and then mu, and returns the function
+// releasing both. Waiting for the notes lock while holding mu would hang
+// every window as long as another process holds it.
+func (a *App) lockStore() (func(), error) {
+	for {
+		a.mu.Lock()
+		st := a.store
+		a.mu.Unlock()
+		unlock, err := st.Lock()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		a.mu.Lock()
+		if a.store == st {
+			return func() {
+				a.mu.Unlock()
+				unlock()
+			}, nil
 		}
-		os.WriteFile(secretPath, []byte(a.secret), os.ModePerm)
+		// The data directory changed meanwhile
+		a.mu.Unlock()
+		unlock()
 	}
-	// Load notes
-	notesPath := DATA_DIR + "/" + NOTES_FILE
-	data, err := os.ReadFile(notesPath)
+}
+
+// save saves the notes and the state of the window. mu is held, so it
+// doesn't wait for another process holding the notes lock: it returns
+// store.ErrLocked and watchNotes saves once the lock is free.
+func (a *App) save() error {
+	unlock, err := a.store.TryLock()
 	if err != nil {
+		if errors.Is(err, store.ErrLocked) {
+			a.isSavePending = true
+		}
 		return err
 	}
-	v := map[int]any{}
-	json.Unmarshal(a.xorEncryptDecrypt(data), &v) // Decrypt notes
-	for i := 0; i < len(v); i++ {
-		for title, content := range v[i].(map[string]string) {
-			a.notes = append(a.notes, note{title: title, content: content})
-			break
-		}
+	defer unlock()
+	return a.saveLocked()
+}
+
+// saveSoon is save for saves which can wait, the notes are left to
+// watchNotes rather than failing if another process has them locked.
+func (a *App) saveSoon() error {
+	if err := a.save(); !errors.Is(err, store.ErrLocked) {
+		return err
 	}
 	return nil
 }
 
-func (a *App) Save() error {
-	v := map[int]any{}
-	if len(a.scratchNotes) != 0 {
-		for i, vv := range a.scratchNotes {
-			v[i] = map[string]string{
-				vv.title: vv.content,
-			}
-		}
-	} else {
-		for i, vv := range a.notes {
-			v[i] = map[string]string{
-				vv.title: vv.content,
-			}
+// saveLocked is save once the notes are locked. Changes other processes
+// made to them since the last save are merged first.
+func (a *App) saveLocked() error {
+	if a.store.Changed() {
+		if err := a.mergeExternal(); err != nil {
+			return err
 		}
 	}
-	data, err := json.Marshal(v)
+	data, err := a.marshalNotes()
+	if err != nil {
+		return err
+	}
+	if err := a.store.Write(data); err != nil {
+		return err
+	}
+	a.saved = data
+	a.isSavePending = false
+	a.state.Tabs, a.state.ActiveTab = a.editorPane.tabStates()
+	return a.saveState()
+}
+
+// writeNotes writes the notes as they are, without merging them with those
+// of the store, for a store which has none yet, such as the one they move
+// to. Merging would take the missing notes file for deletions.
+func (a *App) writeNotes() error {
+	unlock, err := a.store.TryLock()
 	if err != nil {
 		return err
 	}
-	f, err := os.OpenFile(NOTES_FILE, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	defer unlock()
+	data, err := a.marshalNotes()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	f.Write(a.xorEncryptDecrypt(data)) // Encrypt notes
+	if err := a.store.Write(data); err != nil {
+		return err
+	}
+	a.saved = data
+	return nil
+}
 
+// mergeExternal merges the notes other processes saved with the changes made
+// to them since the last save.
+func (a *App) mergeExternal() error {
+	theirs, err := a.store.Load()
+	if err != nil {
+		return err
+	}
+	var base, mine []store.Record
+	if len(a.saved) > 0 {
+		if err := json.Unmarshal(a.saved, &base); err != nil {
+			return err
+		}
+	}
+	for _, n := range a.notes {
+		mine = append(mine, n.record())
+	}
+	// What was loaded is the base of the next merge, the merged notes may
+	// be saved later
+	if a.saved, err = store.Marshal(theirs); err != nil {
+		return err
+	}
+	selected := ""
+	if a.selectedNote >= 0 && a.selectedNote < len(a.notes) {
+		selected = a.notes[a.selectedNote].id
+	}
+	var notes []note
+	var changed []int
+	for _, r := range store.Merge(base, mine, theirs) {
+		i := a.editorPane.noteIndex(r.ID)
+		switch {
+		case i < 0:
+			notes = append(notes, noteFromRecord(r))
+		case a.notes[i].record().Equal(r):
+			notes = append(notes, a.notes[i])
+		default:
+			n := noteFromRecord(r)
+			n.isSelected = a.notes[i].isSelected
+			notes = append(notes, n)
+			changed = append(changed, len(notes)-1)
+		}
+	}
+	old := a.notes
+	a.notes = notes
+	// Close the tabs of the notes deleted meanwhile
+	for _, n := range old {
+		if a.editorPane.noteIndex(n.id) < 0 {
+			a.editorPane.closeTab(a.editorPane.tabIndex(n.id))
+		}
+	}
+	a.selectedNote = slices.IndexFunc(a.notes, func(n note) bool { return n.id == selected })
+	a.editorPane.refresh(changed)
+	a.invalidateWindows()
 	return nil
 }
 
-func (a *App) genSecret(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	r := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letters[r.Intn(len(letters))]
+// watchNotes saves when another process changed the notes file, which
+// merges its changes in, or had it locked during a save.
+func (a *App) watchNotes() {
+	for range time.Tick(EXTERNAL_CHECK) {
+		a.mu.Lock()
+		if a.store != nil && (a.isSavePending || a.store.Changed()) {
+			a.toasts.showError("Couldn't save notes", a.saveSoon())
+		}
+		a.mu.Unlock()
 	}
-	return string(b)
 }
 
-func (a *App) xorEncryptDecrypt(input []byte) []byte {
-	output := make([]byte, len(input))
-	for i := range input {
-		output[i] = input[i] ^ a.secret[i%len(a.secret)]
+// autosave saves the notes if they changed since the last save.
+func (a *App) autosave() error {
+	data, err := a.marshalNotes()
+	if err != nil || bytes.Equal(data, a.saved) {
+		return err
+	}
+	return a.saveSoon()
+}
+
+// setDataDir moves the app to dir. The notes of dir are loaded if it has
+// any, otherwise the current notes are moved there.
+func (a *App) setDataDir(dir string) error {
+	if err := a.save(); err != nil {
+		return err
+	}
+	if err := a.saveTemplates(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	old := a.settings.DataDir
+	a.settings.DataDir = dir
+	if store.Exists(dir) {
+		// Switch to the notes of dir
+		a.editorPane.closeAll()
+		a.replaceDlg.undo = nil
+		a.notes, a.templates = nil, nil
+		if err := a.load(); err != nil {
+			a.settings.DataDir = old
+			a.load()
+			return err
+		}
+		a.loadTemplates()
+	} else {
+		// Bring the notes along, the secret and attachments too since notes
+		// are encrypted with the former and refer to the latter
+		if err := os.WriteFile(dir+"/"+store.SECRET_FILE, []byte(a.store.Secret()), 0600); err != nil {
+			a.settings.DataDir = old
+			return err
+		}
+		if err := copyDir(old+"/"+ATTACHMENTS_DIR, dir+"/"+ATTACHMENTS_DIR); err != nil {
+			a.settings.DataDir = old
+			return err
+		}
+		// A store of its own rather than a changed one, lockStore uses it
+		// without holding mu
+		oldStore := a.store
+		moved, err := store.Open(dir)
+		if err == nil {
+			a.store = moved
+			err = a.writeNotes()
+		}
+		if err == nil {
+			err = a.saveTemplates()
+		}
+		if err != nil {
+			// Leave dir without notes, so that moving there again moves them
+			os.Remove(dir + "/" + store.NOTES_FILE)
+			a.settings.DataDir = old
+			a.store = oldStore
+			return err
+		}
+	}
+	a.attachments = newAttachments(a.store)
+	return a.saveSettings()
+}
+
+// copyDir copies the files of src to dst, doing nothing if src doesn't
+// exist.
+func copyDir(src, dst string) error {
+	files, err := os.ReadDir(src)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
 	}
-	return output
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(src + "/" + f.Name())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(dst+"/"+f.Name(), data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *App) xorEncryptDecrypt(input []byte) []byte {
+	return a.store.Crypt(input)
 }
@@ -0,0 +1,393 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gioui.org/widget"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/importer"
+)
+
+// newTestApp returns an app whose DATA_DIR is in a temporary directory.
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return NewApp(nil)
+}
+
+func TestSetDataDirMovesNotes(t *testing.T) {
+	a := newTestApp(t)
+	id, err := a.store.AddAttachment("cat.png", []byte("png data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.notes = append(a.notes,
+		note{id: store.NewID(), title: "Cat", content: "![cat](attachment:" + id + ")", modified: time.Now()},
+		note{id: store.NewID(), title: "Groceries", content: "- milk", modified: time.Now()},
+	)
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "moved")
+	if err := a.setDataDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := st.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(a.notes) != 2 {
+		t.Fatalf("got %d notes saved and %d in the app, want 2", len(records), len(a.notes))
+	}
+	if data, err := a.store.ReadAttachment(id); err != nil || string(data) != "png data" {
+		t.Errorf("got attachment %q, %v, want it moved", data, err)
+	}
+}
+
+func TestSetDataDirRollsBack(t *testing.T) {
+	a := newTestApp(t)
+	a.notes = append(a.notes, note{id: store.NewID(), title: "Groceries", modified: time.Now()})
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+	old := a.settings.DataDir
+
+	// A directory where the templates can't be written
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, TEMPLATES_FILE), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.setDataDir(dir); err == nil {
+		t.Fatal("got no error, want the one of the templates")
+	}
+	if a.settings.DataDir != old || a.store.Dir != old {
+		t.Errorf("got data directory %q and store %q, want %q", a.settings.DataDir, a.store.Dir, old)
+	}
+	if store.Exists(dir) {
+		t.Error("the notes were left in the directory")
+	}
+}
+
+func TestReplaceSkipsChangedNotes(t *testing.T) {
+	a := newTestApp(t)
+	a.notes = append(a.notes,
+		note{id: store.NewID(), title: "One", content: "cat and cat"},
+		note{id: store.NewID(), title: "Two", content: "a cat"},
+	)
+	a.replaceDlg.findEditor.SetText("cat")
+	a.replaceDlg.replaceEditor.SetText("dog")
+	a.replaceDlg.search()
+
+	// The first note changes after the search, shorter than its matches
+	a.notes[0].content = "cat"
+	a.replaceDlg.apply()
+	if got := a.notes[0].content; got != "cat" {
+		t.Errorf("got %q, want the changed note left alone", got)
+	}
+	if got := a.notes[1].content; got != "a dog" {
+		t.Errorf("got %q, want the match replaced", got)
+	}
+}
+
+func TestFindBarReplaceAllSkipsEmptyMatches(t *testing.T) {
+	var fb findBar
+	var ed widget.Editor
+	ed.SetText("baaa b a")
+	fb.useRegex.Value = true
+	fb.caseSensitive.Value = true
+	fb.findEditor.SetText("a*")
+	fb.replaceEditor.SetText("<$0>")
+	fb.update(ed.Text())
+	if len(fb.matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(fb.matches))
+	}
+	fb.replaceAll(&ed)
+	if got, want := ed.Text(), "b<aaa> b <a>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSaveDoesntWaitForLock(t *testing.T) {
+	a := newTestApp(t)
+	a.notes = append(a.notes, note{id: store.NewID(), title: "Groceries", modified: time.Now()})
+	unlock, err := a.store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	a.notesChanged(nil)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("saving waited %v for the lock", d)
+	}
+	if !a.isSavePending {
+		t.Error("the save isn't pending")
+	}
+
+	unlock()
+	if err := a.saveSoon(); err != nil {
+		t.Fatal(err)
+	}
+	if a.isSavePending {
+		t.Error("the save is still pending")
+	}
+	records, err := a.store.Load()
+	if err != nil || len(records) != 1 {
+		t.Errorf("got %d notes, %v, want 1", len(records), err)
+	}
+}
+
+func TestAPIWaitsForLockWithoutMutex(t *testing.T) {
+	a := newTestApp(t)
+	id := store.NewID()
+	a.notes = append(a.notes, note{id: id, title: "Groceries", modified: time.Now()})
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+	s := &apiServer{a: a, changed: make(chan struct{}, 1)}
+
+	// Another process holds the notes while the note is renamed
+	unlock, err := a.store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		w := httptest.NewRecorder()
+		s.handleNote(w, httptest.NewRequest(http.MethodPatch, "/notes/"+id, strings.NewReader(`{"title":"Shopping"}`)))
+		done <- w
+	}()
+	time.Sleep(100 * time.Millisecond)
+	// The windows can still lay out meanwhile
+	if !a.mu.TryLock() {
+		t.Fatal("the request holds the app mutex while waiting for the notes lock")
+	}
+	a.mu.Unlock()
+	unlock()
+
+	w := <-done
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	records, err := a.store.Load()
+	if err != nil || len(records) != 1 || records[0].Title != "Shopping" {
+		t.Errorf("got %+v, %v, want the note renamed", records, err)
+	}
+}
+
+func TestSearchKeepsNotes(t *testing.T) {
+	a := newTestApp(t)
+	a.notes = append(a.notes,
+		note{id: store.NewID(), title: "Groceries"},
+		note{id: store.NewID(), title: "2024-05-01", journal: "2024-05-01"},
+		note{id: store.NewID(), title: "Grocery prices"},
+		note{id: store.NewID(), title: "Shopping", content: "Compare grocery stores"},
+	)
+	np := &a.notesPane
+	np.searchNotes("grocer")
+	if len(np.visible) != 3 || len(a.notes) != 4 {
+		t.Fatalf("got %v of %d notes, want 3 of 4, contents match too", np.visible, len(a.notes))
+	}
+	// A note deleted while searching is the one shown, not one of the
+	// same title hidden by the search
+	a.notes = slices.Delete(a.notes, np.visible[1], np.visible[1]+1)
+	np.searchNotes("")
+	if len(np.visible) != 2 || a.notes[np.visible[0]].title != "Groceries" {
+		t.Errorf("got %v, want the other regular notes", np.visible)
+	}
+	np.showJournal = true
+	np.searchNotes("")
+	if len(np.visible) != 1 || a.notes[np.visible[0]].journal == "" {
+		t.Errorf("got %v, want only the journal note", np.visible)
+	}
+}
+
+func TestAttachmentsKeptForTheSession(t *testing.T) {
+	a := newTestApp(t)
+	var ids []string
+	for _, name := range []string{"cat.png", "dog.png", "template.png"} {
+		id, err := a.store.AddAttachment(name, []byte("png data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Written long ago
+		path := filepath.Join(a.store.Dir, store.ATTACHMENTS_DIR, id)
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	a.notes = append(a.notes, note{id: store.NewID(), title: "Pets", content: "![dog](attachment:" + ids[1] + ")"})
+	a.templates = append(a.templates, noteTemplate{Name: "Logo", Content: "![logo](attachment:" + ids[2] + ")"})
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.saveTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	// The link can still be brought back by undo
+	if _, err := a.store.ReadAttachment(ids[0]); err != nil {
+		t.Errorf("the attachment was removed during the session: %v", err)
+	}
+
+	// Only collected at the next launch, unless a note or template refers
+	// to it
+	a = NewApp(nil)
+	for i, want := range []bool{false, true, true} {
+		if _, err := a.store.ReadAttachment(ids[i]); (err == nil) != want {
+			t.Errorf("attachment %d: got %v, want kept %v", i, err, want)
+		}
+	}
+}
+
+func TestPastedFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cat.png")
+	if err := os.WriteFile(file, []byte("png data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+	tests := []struct {
+		text string
+		want int
+	}{
+		{uri, 1},
+		{"# Copied files\r\n" + uri + "\r\n" + uri + "\r\n", 2},
+		// Paths are text, not files to attach
+		{file, 0},
+		{"See " + uri, 0},
+		{uri + "\n" + file, 0},
+		{"file://" + filepath.ToSlash(dir), 0},
+		{"file://" + filepath.ToSlash(filepath.Join(dir, "missing.png")), 0},
+	}
+	for _, tt := range tests {
+		if got := pastedFiles(tt.text); len(got) != tt.want {
+			t.Errorf("pastedFiles(%q) = %v, want %d files", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPaletteJumpToDeletedNote(t *testing.T) {
+	a := newTestApp(t)
+	a.notes = append(a.notes, note{id: store.NewID(), title: "Groceries"}, note{id: store.NewID(), title: "Ideas"})
+	a.cmdPalette.open()
+	run := map[string]func(){}
+	for _, it := range a.cmdPalette.items {
+		run[it.label] = it.run
+	}
+	// Deleted by another process while the palette is open
+	a.notes = a.notes[1:]
+	run["Groceries"]()
+	if a.selectedNote != -1 {
+		t.Errorf("selected note %d, want none", a.selectedNote)
+	}
+	run["Ideas"]()
+	if a.selectedNote != 0 {
+		t.Errorf("selected note %d, want the one picked", a.selectedNote)
+	}
+}
+
+func TestBulkChanges(t *testing.T) {
+	a := newTestApp(t)
+	long := time.Now().Add(-time.Hour)
+	a.notes = append(a.notes,
+		note{id: store.NewID(), title: "Groceries", modified: long},
+		note{id: store.NewID(), title: "Ideas", modified: long},
+	)
+	if err := a.save(); err != nil {
+		t.Fatal(err)
+	}
+	saved := func() []store.Record {
+		t.Helper()
+		records, err := a.store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+
+	// Pinned notes are newer than the copies other devices have
+	a.notes[0].isSelected = true
+	a.pinNotes()
+	if r := saved()[0]; !r.Pinned || !r.Modified.After(long) {
+		t.Errorf("got %+v, want the note pinned and touched", r)
+	}
+
+	// Deleted and brought back, both saved
+	a.deleteNotes()
+	a.dialog.spec.onResult(dialogResult{button: 0})
+	if records := saved(); len(records) != 1 || records[0].Title != "Ideas" {
+		t.Fatalf("got %+v saved, want the note deleted", records)
+	}
+	a.toasts.queue[len(a.toasts.queue)-1].onAction()
+	if records := saved(); len(records) != 2 || records[0].Title != "Groceries" {
+		t.Errorf("got %+v saved, want the note back in its place", records)
+	}
+}
+
+func TestImportReplacesDeletedNote(t *testing.T) {
+	a := newTestApp(t)
+	id := store.NewID()
+	a.notes = append(a.notes, note{id: id, title: "Groceries"})
+	p := importPlan{
+		notes:     []importer.Note{{Title: "Groceries", Content: "- milk"}, {Title: "Ideas"}},
+		conflicts: map[int]string{0: id},
+	}
+	// Deleted while the import was asking what to do with it
+	a.notes = nil
+	a.mergeImport(p, IMPORT_REPLACE)
+	if len(a.notes) != 2 || a.notes[0].content != "- milk" {
+		t.Errorf("got %+v, want both notes imported", a.notes)
+	}
+}
+
+func TestReplaceUndoFollowsNotes(t *testing.T) {
+	a := newTestApp(t)
+	long := time.Now().Add(-time.Hour)
+	a.notes = append(a.notes,
+		note{id: store.NewID(), title: "First", content: "cat", modified: long},
+		note{id: store.NewID(), title: "Second", content: "cat and cat", modified: long},
+	)
+	rd := &a.replaceDlg
+	rd.findEditor.SetText("cat")
+	rd.replaceEditor.SetText("dog")
+	rd.search()
+	rd.apply()
+	if rd.status != "Replaced 3 matches in 2 notes" {
+		t.Errorf("got status %q", rd.status)
+	}
+
+	// A note added before the changed ones moves them
+	a.notes = append([]note{{id: store.NewID(), title: "New"}}, a.notes...)
+	rd.undoLast()
+	if rd.status != "Restored 2 notes" || a.notes[1].content != "cat" || a.notes[2].content != "cat and cat" {
+		t.Errorf("got status %q and notes %+v, want both restored", rd.status, a.notes)
+	}
+	if !a.notes[1].modified.After(long) {
+		t.Error("the restored note wasn't touched")
+	}
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/svgs"
+
+	"gioui.org/op/paint"
+)
+
+const ATTACHMENTS_DIR = store.ATTACHMENTS_DIR
+
+// Unreferenced attachments are kept for ATTACHMENT_GRACE after they were
+// written, other processes may be adding them to notes they didn't save yet.
+const ATTACHMENT_GRACE = time.Minute
+
+// Attachments are referenced from note content with markdown style links,
+// ![name](attachment:id) for images and [name](attachment:id) for other files.
+var attachmentRefRe = store.AttachmentRefRe
+
+var imageExts = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".svg":  true,
+}
+
+// attachments are those of the store, with their decoded images.
+type attachments struct {
+	store  *store.Store
+	images map[string]paint.ImageOp
+}
+
+func newAttachments(st *store.Store) attachments {
+	return attachments{
+		store:  st,
+		images: map[string]paint.ImageOp{},
+	}
+}
+
+// add copies the file at path into the vault and returns the reference
+// to insert into the note content.
+func (at *attachments) add(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	id, err := at.store.AddAttachment(filepath.Base(path), data)
+	if err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("[", "(", "]", ")").Replace(filepath.Base(path))
+	if imageExts[filepath.Ext(id)] {
+		return fmt.Sprintf("![%s](attachment:%s)", name, id), nil
+	}
+	return fmt.Sprintf("[%s](attachment:%s)", name, id), nil
+}
+
+// image returns the decoded attachment ready to be painted. Decoded images
+// are cached so they aren't decoded again every frame.
+func (at *attachments) image(id string) (paint.ImageOp, bool) {
+	if op, ok := at.images[id]; ok {
+		return op, op.Size() != (image.Point{})
+	}
+	var op paint.ImageOp
+	if data, err := at.store.ReadAttachment(id); err == nil {
+		if img, err := decodeImage(id, data); err == nil {
+			op = paint.NewImageOp(img)
+		}
+	}
+	at.images[id] = op // Cache failures too
+	return op, op.Size() != (image.Point{})
+}
+
+// collectGarbage removes every blob that isn't referenced by any of the
+// given note contents and is older than ATTACHMENT_GRACE.
+func (at *attachments) collectGarbage(contents []string) error {
+	dir := filepath.Join(at.store.Dir, ATTACHMENTS_DIR)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	used := map[string]bool{}
+	for _, c := range contents {
+		for _, m := range attachmentRefRe.FindAllStringSubmatch(c, -1) {
+			used[m[3]] = true
+		}
+	}
+	for _, e := range entries {
+		if e.IsDir() || used[e.Name()] {
+			continue
+		}
+		if info, err := e.Info(); err != nil || time.Since(info.ModTime()) < ATTACHMENT_GRACE {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+		delete(at.images, e.Name())
+	}
+	return nil
+}
+
+// decodeImage decodes attachment data the same way the app's own resources
+// are decoded, using svgs.LoadSvg for vector images.
+func decodeImage(name string, data []byte) (image.Image, error) {
+	if strings.ToLower(filepath.Ext(name)) == ".svg" {
+		return svgs.LoadSvg(bytes.NewReader(data), image.Point{})
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// pastedFiles returns the files named by s if s is a text/uri-list of
+// file:// URIs, such as what file managers put on the clipboard when
+// copying files and send when dropping them. Plain paths are left as text,
+// a note may well be about a file without wanting a copy of it.
+func pastedFiles(s string) []string {
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(s), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			continue // Comments are allowed in URI lists
+		}
+		if !strings.HasPrefix(line, "file://") {
+			return nil
+		}
+		u, err := url.Parse(line)
+		if err != nil {
+			return nil
+		}
+		path := filepath.FromSlash(u.Path)
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			return nil
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// insertedText returns the byte range of cur that differs from prev, which
+// after a paste is the pasted text.
+func insertedText(prev, cur string) (start, end int) {
+	for start < len(prev) && start < len(cur) && prev[start] == cur[start] {
+		start++
+	}
+	n := 0
+	for n < len(prev)-start && n < len(cur)-start && prev[len(prev)-1-n] == cur[len(cur)-1-n] {
+		n++
+	}
+	end = len(cur) - n
+	// Don't split runes
+	for start > 0 && start < len(cur) && !utf8.RuneStart(cur[start]) {
+		start--
+	}
+	for end < len(cur) && !utf8.RuneStart(cur[end]) {
+		end++
+	}
+	return start, end
+}
@@ -0,0 +1,243 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/backup"
+)
+
+// Names of the files of a backup
+const (
+	BACKUP_NOTES     = "notes.json"
+	BACKUP_TEMPLATES = "templates.json"
+	BACKUP_SETTINGS  = "settings/" + SETTINGS_FILE
+	BACKUP_KEYMAP    = "settings/" + KEYMAP_FILE
+	BACKUP_THEMES    = "settings/" + THEMES_DIR + "/"
+	BACKUP_EXT       = ".kbak"
+)
+
+// backupNotes asks for a passphrase and a file to back everything up to.
+func (a *App) backupNotes() {
+	a.dialog.ask("Back up", "Back up the notes, attachments, templates and settings to an archive encrypted with the passphrase:",
+		"Passphrase", "", true, func(pass string) {
+			if pass == "" {
+				return
+			}
+			a.dialog.ask("Back up", "Repeat the passphrase, the backup can't be restored without it.", "Passphrase", "", true, func(again string) {
+				if again != pass {
+					a.toasts.show(SEVERITY_ERROR, "The passphrases don't match")
+					return
+				}
+				file := filepath.Join(a.settings.DataDir, "backups", "keeper-"+time.Now().Format("20060102-1504")+BACKUP_EXT)
+				a.dialog.ask("Back up", "Write the backup to the file:", "File", file, false, func(file string) {
+					if err := a.writeBackup(strings.TrimSpace(file), pass); err != nil {
+						a.toasts.showError("Couldn't back up", err)
+						return
+					}
+					a.toasts.show(SEVERITY_SUCCESS, "Backed up "+plural(len(a.notes), "note"))
+				})
+			})
+		})
+}
+
+// backupFiles returns the files a backup holds, all decrypted.
+func (a *App) backupFiles() (map[string][]byte, error) {
+	files := map[string][]byte{}
+	var records []store.Record
+	for _, n := range a.notes {
+		records = append(records, n.record())
+	}
+	var err error
+	if files[BACKUP_NOTES], err = json.Marshal(records); err != nil {
+		return nil, err
+	}
+	if files[BACKUP_TEMPLATES], err = json.Marshal(a.templates); err != nil {
+		return nil, err
+	}
+	if files[BACKUP_SETTINGS], err = json.MarshalIndent(a.settings, "", "  "); err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(DATA_DIR + "/" + KEYMAP_FILE); err == nil {
+		files[BACKUP_KEYMAP] = data
+	}
+	themes, _ := filepath.Glob(filepath.Join(DATA_DIR, THEMES_DIR, "*.json"))
+	for _, t := range themes {
+		if data, err := os.ReadFile(t); err == nil {
+			files[BACKUP_THEMES+filepath.Base(t)] = data
+		}
+	}
+	ids, err := a.store.Attachments()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		data, err := a.store.ReadAttachment(id)
+		if err != nil {
+			return nil, err
+		}
+		files[ATTACHMENTS_DIR+"/"+id] = data
+	}
+	return files, nil
+}
+
+// writeBackup saves and writes a backup encrypted with pass to file. The
+// file is only replaced once the backup is complete.
+func (a *App) writeBackup(file, pass string) error {
+	if err := a.save(); err != nil {
+		return err
+	}
+	files, err := a.backupFiles()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := backup.Write(&buf, pass, files); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file+".tmp", buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// restoreBackup asks for a backup and its passphrase, checks it and asks
+// how to restore it.
+func (a *App) restoreBackup() {
+	a.dialog.ask("Restore", "Restore the backup file:", "File", filepath.Join(a.settings.DataDir, "backups")+string(filepath.Separator),
+		false, func(file string) {
+			file = strings.TrimSpace(file)
+			a.dialog.ask("Restore", "Passphrase of "+filepath.Base(file)+":", "Passphrase", "", true, func(pass string) {
+				b, records, err := readBackup(file, pass)
+				if err != nil {
+					a.toasts.showError("Couldn't restore the backup", err)
+					return
+				}
+				body := "The backup of " + b.Manifest.Created.Format("Jan 2, 2006 15:04") + " holds " + plural(len(records), "note") +
+					". Replacing restores its templates and settings too, merging only adds its notes and updates the ones it has a later version of."
+				a.dialog.choose("Restore", body, []string{"Replace everything", "Merge by note ID"}, 1, func(i int) {
+					if i == 1 {
+						a.applyBackup(b, records, false)
+						return
+					}
+					a.dialog.confirm("Replace everything",
+						"Replace the "+plural(len(a.notes), "note")+" of Keeper with the "+plural(len(records), "note")+" of the backup?",
+						"Replace", a.errorIco, func() { a.applyBackup(b, records, true) })
+				})
+			})
+		})
+}
+
+// readBackup reads and checks the backup at file.
+func readBackup(file, pass string) (*backup.Backup, []store.Record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	b, err := backup.Read(f, pass)
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []store.Record
+	if err := json.Unmarshal(b.Files[BACKUP_NOTES], &records); err != nil {
+		return nil, nil, backup.ErrCorrupt
+	}
+	for name := range b.Files {
+		if dir, id := path.Split(name); dir == ATTACHMENTS_DIR+"/" && !store.AttachmentIDRe.MatchString(id) {
+			return nil, nil, errors.New("the backup has an invalid attachment: " + id)
+		}
+	}
+	return b, records, nil
+}
+
+// applyBackup restores b. Replacing restores everything, merging adds the
+// notes Keeper lacks and updates the ones b has a later version of.
+func (a *App) applyBackup(b *backup.Backup, records []store.Record, replace bool) {
+	// Attachments first, so notes never refer to missing ones
+	for name, data := range b.Files {
+		if id := strings.TrimPrefix(name, ATTACHMENTS_DIR+"/"); id != name {
+			if err := a.store.WriteAttachment(id, data); err != nil {
+				a.toasts.showError("Couldn't restore the backup", err)
+				return
+			}
+		}
+	}
+	var changed []int
+	restored := len(records)
+	if replace {
+		a.editorPane.closeAll()
+		a.replaceDlg.undo = nil
+		a.notes = nil
+		for _, r := range records {
+			a.notes = append(a.notes, noteFromRecord(r))
+		}
+		a.restoreSettings(b)
+	} else {
+		restored = 0
+		for _, r := range records {
+			i := a.editorPane.noteIndex(r.ID)
+			switch {
+			case i < 0:
+				a.notes = append(a.notes, noteFromRecord(r))
+				restored++
+			case r.Modified.After(a.notes[i].modified):
+				n := noteFromRecord(r)
+				n.isSelected = a.notes[i].isSelected
+				a.notes[i] = n
+				changed = append(changed, i)
+				restored++
+			}
+		}
+	}
+	a.notesPane.markSelected(a.editorPane.current())
+	a.notesChanged(changed)
+	a.toasts.show(SEVERITY_SUCCESS, "Restored "+plural(restored, "note"))
+}
+
+// restoreSettings restores the templates, settings, keymap and themes of b,
+// keeping the data directory.
+func (a *App) restoreSettings(b *backup.Backup) {
+	var err error
+	if data, ok := b.Files[BACKUP_TEMPLATES]; ok {
+		var templates []noteTemplate
+		if err = json.Unmarshal(data, &templates); err == nil {
+			a.templates = templates
+			err = a.saveTemplates()
+		}
+	}
+	if data, ok := b.Files[BACKUP_SETTINGS]; ok {
+		s := defaultSettings
+		if jerr := json.Unmarshal(data, &s); jerr == nil {
+			s.DataDir = a.settings.DataDir
+			a.settings = s
+		}
+		err = errors.Join(err, a.saveSettings())
+	}
+	for name, data := range b.Files {
+		dst := ""
+		if name == BACKUP_KEYMAP {
+			dst = filepath.Join(DATA_DIR, KEYMAP_FILE)
+		} else if t := strings.TrimPrefix(name, BACKUP_THEMES); t != name && t == path.Base(t) {
+			dst = filepath.Join(DATA_DIR, THEMES_DIR, t)
+		}
+		if dst != "" {
+			err = errors.Join(err, os.MkdirAll(filepath.Dir(dst), os.ModePerm), os.WriteFile(dst, data, 0600))
+		}
+	}
+	a.themes = loadThemes(DATA_DIR + "/" + THEMES_DIR)
+	a.applyTheme(a.settings.Theme)
+	a.applyAPI()
+	err = errors.Join(err, a.commands.loadKeymap(DATA_DIR+"/"+KEYMAP_FILE))
+	a.toasts.showError("Couldn't restore all settings", err)
+}
@@ -0,0 +1,221 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/utils/export"
+)
+
+// plural returns n followed by word, adding an s or es unless n is 1.
+func plural(n int, word string) string {
+	switch {
+	case n == 1:
+		return fmt.Sprintf("%d %s", n, word)
+	case strings.HasSuffix(word, "ch") || strings.HasSuffix(word, "sh") || strings.HasSuffix(word, "s") || strings.HasSuffix(word, "x"):
+		return fmt.Sprintf("%d %ses", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// targets returns the indices of the notes bulk actions apply to: the
+// selected notes, or the open one if none is selected.
+func (a *App) targets() []int {
+	sel := a.notesPane.selection()
+	if len(sel) == 0 {
+		if i := a.editorPane.current(); i >= 0 {
+			sel = append(sel, i)
+		}
+	}
+	return sel
+}
+
+// targetIDs returns the IDs of the targets, they stay valid while notes are
+// added and removed.
+func (a *App) targetIDs() []string {
+	var ids []string
+	for _, i := range a.targets() {
+		ids = append(ids, a.notes[i].id)
+	}
+	return ids
+}
+
+// forEachID calls f with the index of every note of ids that still exists.
+func (a *App) forEachID(ids []string, f func(i int)) {
+	for i := range a.notes {
+		if slices.Contains(ids, a.notes[i].id) {
+			f(i)
+		}
+	}
+}
+
+// deleteNotes asks for confirmation and deletes the targets, offering to
+// undo it.
+func (a *App) deleteNotes() {
+	ids := a.targetIDs()
+	if len(ids) == 0 {
+		return
+	}
+	a.dialog.confirm("Delete notes", "Delete "+plural(len(ids), "note item")+"?", "Delete", a.errorIco, func() {
+		type removed struct {
+			index int
+			note  note
+		}
+		var undo []removed
+		a.forEachID(ids, func(i int) {
+			n := a.notes[i]
+			n.isSelected, n.isHovered = false, false
+			undo = append(undo, removed{i, n})
+		})
+		a.notes = slices.DeleteFunc(a.notes, func(n note) bool { return slices.Contains(ids, n.id) })
+		for _, id := range ids {
+			if k := a.editorPane.tabIndex(id); k >= 0 {
+				a.editorPane.closeTab(k)
+			}
+		}
+		a.notesPane.markSelected(a.editorPane.current())
+		a.notesChanged(nil)
+		a.toasts.showAction(SEVERITY_SUCCESS, "Deleted "+plural(len(undo), "note"), "Undo", func() {
+			// Indices are ascending, so every note goes back to its place.
+			// Touched, so that they win over the deletion synced meanwhile
+			for _, r := range undo {
+				if a.editorPane.noteIndex(r.note.id) >= 0 {
+					continue
+				}
+				r.note.touch()
+				a.notes = slices.Insert(a.notes, min(r.index, len(a.notes)), r.note)
+			}
+			a.notesPane.markSelected(a.editorPane.current())
+			a.notesChanged(nil)
+		})
+	})
+}
+
+// moveNotes asks for a folder to move the targets to.
+func (a *App) moveNotes() {
+	ids := a.targetIDs()
+	if len(ids) == 0 {
+		return
+	}
+	folder := a.notes[a.targets()[0]].folder
+	a.dialog.ask("Move to folder", "Move "+plural(len(ids), "note")+" to the folder, leave it empty to take them out of their folders.",
+		"Folder", folder, false, func(folder string) {
+			folder = strings.TrimSpace(folder)
+			a.forEachID(ids, func(i int) {
+				if a.notes[i].folder != folder {
+					a.notes[i].folder = folder
+					a.notes[i].touch()
+				}
+			})
+			a.notesChanged(nil)
+		})
+}
+
+// tagNotes asks for a tag to add to the targets.
+func (a *App) tagNotes() {
+	ids := a.targetIDs()
+	if len(ids) == 0 {
+		return
+	}
+	a.dialog.ask("Add tag", "Tag "+plural(len(ids), "note")+" with:", "Tag", "", false, func(tag string) {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag == "" {
+			return
+		}
+		a.forEachID(ids, func(i int) {
+			if !slices.Contains(a.notes[i].tags, tag) {
+				a.notes[i].tags = append(a.notes[i].tags, tag)
+				a.notes[i].touch()
+			}
+		})
+		a.notesChanged(nil)
+	})
+}
+
+// pinNotes pins the targets to the top of the list, or unpins them if they
+// all are pinned.
+func (a *App) pinNotes() {
+	targets := a.targets()
+	pin := slices.ContainsFunc(targets, func(i int) bool { return !a.notes[i].isPinned })
+	for _, i := range targets {
+		if a.notes[i].isPinned != pin {
+			a.notes[i].isPinned = pin
+			a.notes[i].touch()
+		}
+	}
+	a.notesChanged(nil)
+}
+
+// exportNotes exports the targets.
+func (a *App) exportNotes() {
+	a.export(a.targetIDs())
+}
+
+// exportAll exports every note.
+func (a *App) exportAll() {
+	var ids []string
+	for _, n := range a.notes {
+		ids = append(ids, n.id)
+	}
+	a.export(ids)
+}
+
+// export asks for a format and a file to write the notes of ids to.
+func (a *App) export(ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	var choices []string
+	for _, f := range export.Formats {
+		choices = append(choices, f.String())
+	}
+	a.dialog.choose("Export notes", "Export "+plural(len(ids), "note")+" as:", choices, 0, func(i int) {
+		f := export.Formats[i]
+		name := "keeper-" + time.Now().Format("20060102")
+		if len(ids) == 1 {
+			a.forEachID(ids, func(i int) { name = export.FileName(a.notes[i].title) })
+		}
+		file := filepath.Join(a.settings.DataDir, "export", name+f.Ext())
+		a.dialog.ask("Export notes", "Write the "+f.String()+" export to the file:", "File", file, false, func(file string) {
+			var notes []export.Note
+			a.forEachID(ids, func(i int) { notes = append(notes, exportNote(&a.notes[i])) })
+			if err := writeExport(strings.TrimSpace(file), f, notes, a.store.ReadAttachment); err != nil {
+				a.toasts.showError("Couldn't export notes", err)
+				return
+			}
+			a.toasts.show(SEVERITY_SUCCESS, "Exported "+plural(len(notes), "note"))
+		})
+	})
+}
+
+// exportNote returns what the export package needs of n.
+func exportNote(n *note) export.Note {
+	return export.Note{
+		Title:    n.title,
+		Content:  n.content,
+		Journal:  n.journal,
+		Folder:   n.folder,
+		Tags:     n.tags,
+		Modified: n.modified,
+	}
+}
+
+// writeExport writes notes to file in format f, creating its directory.
+func writeExport(file string, f export.Format, notes []export.Note, attachments export.Attachments) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := export.Write(out, f, notes, attachments); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,143 @@
+package app
+
+import (
+	gioapp "gioui.org/app"
+	"gioui.org/font"
+	"gioui.org/font/gofont"
+	"gioui.org/io/key"
+	"gioui.org/io/system"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+
+	"github.com/deoxyimran/keeper/app/store"
+)
+
+// captureWindow is a small window to jot a note down without the rest of
+// the app, meant to be opened from a desktop shortcut. It writes through the
+// store while the notes are locked, so it is safe to use while the app runs,
+// which picks the note up. The window is kept above the others where the
+// platform allows it, see keepOnTop.
+type captureWindow struct {
+	// Widgets
+	th       *material.Theme
+	editor   widget.Editor
+	inboxBtn widget.Clickable
+	newBtn   widget.Clickable
+	// States
+	store     *store.Store
+	err       error
+	needFocus bool
+}
+
+// RunCapture runs the capture window until it closes.
+func RunCapture(window *gioapp.Window) error {
+	a := &App{}
+	a.loadSettings()
+	a.themes = loadThemes(DATA_DIR + "/" + THEMES_DIR)
+	a.th = material.NewTheme()
+	a.th.Shaper = text.NewShaper(text.WithCollection(gofont.Collection()))
+	a.applyTheme(a.settings.Theme)
+	cw := &captureWindow{th: a.th, needFocus: true}
+	cw.store, cw.err = store.Open(a.settings.DataDir)
+
+	var ops op.Ops
+	for {
+		switch e := window.Event().(type) {
+		case gioapp.DestroyEvent:
+			return e.Err
+		case gioapp.ViewEvent:
+			keepOnTop(e)
+		case gioapp.FrameEvent:
+			gtx := gioapp.NewContext(&ops, e)
+			if cw.layout(gtx) {
+				window.Perform(system.ActionClose)
+			}
+			e.Frame(gtx.Ops)
+		}
+	}
+}
+
+// capture adds the text to inbox, or to a new note if inbox is empty, and
+// reports whether it did.
+func (cw *captureWindow) capture(inbox string) bool {
+	if cw.store == nil {
+		return false
+	}
+	_, cw.err = cw.store.Capture(cw.editor.Text(), inbox)
+	return cw.err == nil
+}
+
+// layout lays the window out and reports whether it should close: the text
+// was captured or Esc was pressed.
+func (cw *captureWindow) layout(gtx C) bool {
+	if cw.needFocus {
+		gtx.Execute(key.FocusCmd{Tag: &cw.editor})
+		cw.needFocus = false
+	}
+	done := false
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Name: key.NameEscape},
+			key.Filter{Name: key.NameReturn, Required: key.ModShortcut},
+			key.Filter{Name: key.NameReturn, Required: key.ModShortcut | key.ModShift},
+		)
+		if !ok {
+			break
+		}
+		if e, ok := ev.(key.Event); ok && e.State == key.Press {
+			switch {
+			case e.Name == key.NameEscape:
+				done = true
+			case e.Modifiers.Contain(key.ModShift):
+				done = cw.capture("")
+			default:
+				done = cw.capture(store.CAPTURE_INBOX)
+			}
+		}
+	}
+	if cw.inboxBtn.Clicked(gtx) {
+		done = cw.capture(store.CAPTURE_INBOX)
+	}
+	if cw.newBtn.Clicked(gtx) {
+		done = cw.capture("")
+	}
+
+	paint.Fill(gtx.Ops, pal.Bg)
+	layout.UniformInset(unit.Dp(12)).Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Flexed(1, func(gtx C) D {
+				ed := material.Editor(cw.th, &cw.editor, "Jot something down…")
+				return ed.Layout(gtx)
+			}),
+			layout.Rigid(func(gtx C) D {
+				if cw.err == nil {
+					return D{}
+				}
+				l := material.Body2(cw.th, cw.err.Error())
+				l.Color = pal.Danger
+				return layout.Inset{Top: unit.Dp(8)}.Layout(gtx, l.Layout)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return layout.Inset{Top: unit.Dp(8)}.Layout(gtx, func(gtx C) D {
+					return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+						layout.Flexed(1, func(gtx C) D {
+							l := material.Caption(cw.th, "Ctrl+Enter adds to "+store.CAPTURE_INBOX+", Ctrl+Shift+Enter makes a new note")
+							l.Color.A = 170
+							l.Font.Style = font.Italic
+							return l.Layout(gtx)
+						}),
+						layout.Rigid(material.Button(cw.th, &cw.newBtn, "New note").Layout),
+						layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+						layout.Rigid(material.Button(cw.th, &cw.inboxBtn, "Add to "+store.CAPTURE_INBOX).Layout),
+					)
+				})
+			}),
+		)
+	})
+	return done
+}
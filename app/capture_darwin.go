@@ -0,0 +1,30 @@
+//go:build darwin && !ios
+
+package app
+
+/*
+#cgo CFLAGS: -Werror -fobjc-arc -x objective-c
+#cgo LDFLAGS: -framework AppKit
+
+#import <AppKit/AppKit.h>
+
+// keep_above floats the window of view above the normal windows.
+static void keep_above(CFTypeRef viewRef) {
+	NSView *view = (__bridge NSView *)viewRef;
+	dispatch_async(dispatch_get_main_queue(), ^{
+		[[view window] setLevel:NSFloatingWindowLevel];
+	});
+}
+*/
+import "C"
+
+import (
+	gioapp "gioui.org/app"
+)
+
+// keepOnTop floats the window of e above the others.
+func keepOnTop(e gioapp.ViewEvent) {
+	if v, ok := e.(gioapp.AppKitViewEvent); ok && v.Valid() {
+		C.keep_above(C.CFTypeRef(v.View))
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(((linux && !android) || freebsd || openbsd) && !nox11) && !windows && !(darwin && !ios)
+
+package app
+
+import (
+	gioapp "gioui.org/app"
+)
+
+// keepOnTop does nothing where the window can't be kept above the others.
+func keepOnTop(e gioapp.ViewEvent) {}
@@ -0,0 +1,23 @@
+package app
+
+import (
+	"syscall"
+
+	gioapp "gioui.org/app"
+)
+
+const (
+	_HWND_TOPMOST   = ^uintptr(0) // -1
+	_SWP_NOSIZE     = 0x0001
+	_SWP_NOMOVE     = 0x0002
+	_SWP_NOACTIVATE = 0x0010
+)
+
+var setWindowPos = syscall.NewLazyDLL("user32.dll").NewProc("SetWindowPos")
+
+// keepOnTop makes the window of e topmost.
+func keepOnTop(e gioapp.ViewEvent) {
+	if w, ok := e.(gioapp.Win32ViewEvent); ok && w.Valid() {
+		setWindowPos.Call(w.HWND, _HWND_TOPMOST, 0, 0, 0, 0, _SWP_NOMOVE|_SWP_NOSIZE|_SWP_NOACTIVATE)
+	}
+}
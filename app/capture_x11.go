@@ -0,0 +1,40 @@
+//go:build ((linux && !android) || freebsd || openbsd) && !nox11
+
+package app
+
+/*
+#cgo freebsd openbsd CFLAGS: -I/usr/X11R6/include -I/usr/local/include
+#cgo freebsd openbsd LDFLAGS: -L/usr/X11R6/lib -L/usr/local/lib -lX11
+#cgo linux pkg-config: x11
+
+#include <X11/Xlib.h>
+
+// keep_above asks the window manager to keep win above the other windows,
+// as the EWMH asks for windows that are already mapped.
+static void keep_above(Display *dpy, Window win) {
+	XEvent ev = {0};
+	ev.xclient.type = ClientMessage;
+	ev.xclient.window = win;
+	ev.xclient.message_type = XInternAtom(dpy, "_NET_WM_STATE", False);
+	ev.xclient.format = 32;
+	ev.xclient.data.l[0] = 1; // _NET_WM_STATE_ADD
+	ev.xclient.data.l[1] = XInternAtom(dpy, "_NET_WM_STATE_ABOVE", False);
+	ev.xclient.data.l[3] = 1; // From a normal application.
+	XSendEvent(dpy, DefaultRootWindow(dpy), False,
+		SubstructureRedirectMask | SubstructureNotifyMask, &ev);
+	XFlush(dpy);
+}
+*/
+import "C"
+
+import (
+	gioapp "gioui.org/app"
+)
+
+// keepOnTop keeps the window of e above the others on X11. Wayland has no
+// protocol for it, the window stays as it is there.
+func keepOnTop(e gioapp.ViewEvent) {
+	if x, ok := e.(gioapp.X11ViewEvent); ok && x.Valid() {
+		C.keep_above((*C.Display)(x.Display), C.Window(x.Window))
+	}
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/deoxyimran/keeper/app/store"
+)
+
+// Flags of capture
+var (
+	captureTo        string
+	captureNew       bool
+	captureClipboard bool
+)
+
+func captureFlags(fs *flag.FlagSet) {
+	fs.StringVar(&captureTo, "to", store.CAPTURE_INBOX, "title of the note to add to, created if missing")
+	fs.BoolVar(&captureNew, "new", false, "make a new note titled after the first line instead")
+	fs.BoolVar(&captureClipboard, "clipboard", false, "capture the clipboard even if stdin is piped")
+}
+
+// capture adds the text of args, of stdin or of the clipboard to the inbox
+// note or to a new note.
+func capture(e *env, args []string) error {
+	text := strings.Join(args, " ")
+	if text == "" && !captureClipboard {
+		piped := false
+		var err error
+		if text, piped, err = readStdin(); err != nil {
+			return err
+		}
+		captureClipboard = !piped
+	}
+	if captureClipboard {
+		var err error
+		if text, err = readClipboard(); err != nil {
+			return err
+		}
+	}
+	if err := e.open(); err != nil {
+		return err
+	}
+	inbox := strings.TrimSpace(captureTo)
+	if captureNew {
+		inbox = ""
+	}
+	r, err := e.store.Capture(text, inbox)
+	if err != nil {
+		return err
+	}
+	if e.asJSON {
+		return printJSON(r)
+	}
+	fmt.Fprintf(stdout, "Captured to %s (%s)\n", title(r), r.ID)
+	return nil
+}
+
+// clipboardCommands are the commands printing the clipboard, by operating
+// system. The first one found is used.
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbpaste"}},
+	"windows": {{"powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw"}},
+	"other":   {{"wl-paste", "--no-newline"}, {"xclip", "-selection", "clipboard", "-out"}, {"xsel", "--clipboard", "--output"}},
+}
+
+// readClipboard returns the text of the clipboard.
+func readClipboard() (string, error) {
+	cmds, ok := clipboardCommands[runtime.GOOS]
+	if !ok {
+		cmds = clipboardCommands["other"]
+	}
+	var names []string
+	for _, c := range cmds {
+		if _, err := exec.LookPath(c[0]); err != nil {
+			names = append(names, c[0])
+			continue
+		}
+		out, err := exec.Command(c[0], c[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("couldn't read the clipboard: %w", err)
+		}
+		return string(out), nil
+	}
+	return "", errors.New("couldn't read the clipboard, install one of " + strings.Join(names, ", "))
+}
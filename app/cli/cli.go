@@ -0,0 +1,370 @@
+// Package cli is the command line interface of Keeper. It reads and writes
+// the notes of the GUI through the same store, without opening a window.
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+)
+
+const usage = `Usage: keeper [command] [flags] [arguments]
+
+Without a command, Keeper opens its window.
+
+Commands:
+  list                     List the notes
+  show <note>              Print a note
+  new --title X < body     Add a note, its content read from stdin
+  edit <note>              Edit a note in $EDITOR, or replace its content with stdin
+  rm <note>...             Delete notes
+  search <query>           Search titles and contents, #tag and /folder too
+  export [note...]         Export notes, all of them by default
+  import <path>            Import notes from another application
+  tui                      Browse and edit the notes in the terminal
+  capture [text]           Add text, stdin or the clipboard to the Inbox note
+  sync [--folder DIR]      Sync the notes with a shared folder, encrypted
+
+Run keeper --capture for a small window to jot a note down, from a desktop
+shortcut for instance.
+
+While $EDITOR runs, the note it edits is decrypted in a private directory
+of the data directory, which is removed once the editor exits.
+
+The sync passphrase is read from --passphrase-file, $KEEPER_SYNC_PASSPHRASE
+or the terminal.
+
+Notes are given by ID, ID prefix or title. Every command takes --dir to use
+another data directory and --json to print JSON.
+`
+
+// Directories of the notes edited in $EDITOR start with EDIT_DIR_PREFIX
+const EDIT_DIR_PREFIX = ".edit-"
+
+// Streams of the commands, variables so they can be replaced
+var (
+	stdin  io.Reader = os.Stdin
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// command is a subcommand. flags adds its flags to the common ones, run
+// gets the arguments left once flags are parsed.
+type command struct {
+	flags func(fs *flag.FlagSet)
+	run   func(e *env, args []string) error
+}
+
+// env is what commands work on.
+type env struct {
+	dir    string
+	asJSON bool
+	store  *store.Store
+}
+
+// Run runs the subcommand of args and returns the exit code.
+func Run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "keeper: unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+	e := &env{}
+	fs := flag.NewFlagSet("keeper "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&e.dir, "dir", "", "data directory, the one of the settings by default")
+	fs.BoolVar(&e.asJSON, "json", false, "print JSON")
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	rest, err := parseFlags(fs, args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if e.dir == "" {
+		e.dir = store.DataDir()
+	}
+	if err := cmd.run(e, rest); err != nil {
+		fmt.Fprintln(stderr, "keeper:", err)
+		return 1
+	}
+	return 0
+}
+
+// parseFlags parses flags placed anywhere among the arguments, and returns
+// the arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		// Everything after -- is an argument
+		if parsed := len(args) - fs.NArg(); parsed > 0 && args[parsed-1] == "--" {
+			return append(rest, fs.Args()...), nil
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// open opens the store of the data directory.
+func (e *env) open() error {
+	if e.store != nil {
+		return nil
+	}
+	var err error
+	e.store, err = store.Open(e.dir)
+	return err
+}
+
+// load loads the notes.
+func (e *env) load() ([]store.Record, error) {
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	return e.store.Load()
+}
+
+// update changes the notes with f while they are locked, so the window and
+// other commands running meanwhile don't lose changes.
+func (e *env) update(f func(records []store.Record) ([]store.Record, error)) ([]store.Record, error) {
+	if err := e.open(); err != nil {
+		return nil, err
+	}
+	return e.store.Update(f)
+}
+
+// put saves r, replacing the note of its ID. Only the fields that differ
+// from old are changed, other processes may have changed the others.
+func (e *env) put(old, r store.Record) ([]store.Record, error) {
+	return e.update(func(records []store.Record) ([]store.Record, error) {
+		i := slices.IndexFunc(records, func(c store.Record) bool { return c.ID == r.ID })
+		if i < 0 {
+			if old.ID != "" {
+				return nil, fmt.Errorf("%q was deleted meanwhile", title(old))
+			}
+			return append(records, r), nil
+		}
+		c := &records[i]
+		if r.Title != old.Title {
+			c.Title = r.Title
+		}
+		if r.Content != old.Content {
+			c.Content = r.Content
+		}
+		if r.Folder != old.Folder {
+			c.Folder = r.Folder
+		}
+		if !slices.Equal(r.Tags, old.Tags) {
+			c.Tags = r.Tags
+		}
+		if r.Pinned != old.Pinned {
+			c.Pinned = r.Pinned
+		}
+		c.Modified = r.Modified
+		return records, nil
+	})
+}
+
+// printJSON prints v as indented JSON.
+func printJSON(v any) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// find returns the index of the note arg refers to: its ID, a prefix of it
+// or its title.
+func find(records []store.Record, arg string) (int, error) {
+	var matches []int
+	for i, r := range records {
+		if r.ID == arg {
+			return i, nil
+		}
+		if len(arg) >= 4 && strings.HasPrefix(r.ID, arg) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		for i, r := range records {
+			if strings.EqualFold(strings.TrimSpace(r.Title), strings.TrimSpace(arg)) {
+				matches = append(matches, i)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("no note %q", arg)
+	case 1:
+		return matches[0], nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d notes match %q, give one of their IDs:", len(matches), arg)
+	for _, i := range matches {
+		fmt.Fprintf(&b, "\n  %s  %s", records[i].ID, records[i].Title)
+	}
+	return -1, errors.New(b.String())
+}
+
+// printList prints records one per line.
+func printList(records []store.Record) {
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	for _, r := range records {
+		pin := ""
+		if r.Pinned {
+			pin = "* "
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s%s\t%s\n", r.ID, formatTime(r.Modified), pin, title(r), meta(r))
+	}
+	tw.Flush()
+}
+
+// sorted returns records with the pinned ones first, then the most
+// recently modified ones.
+func sorted(records []store.Record) []store.Record {
+	records = append([]store.Record(nil), records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Pinned != records[j].Pinned {
+			return records[i].Pinned
+		}
+		return records[i].Modified.After(records[j].Modified)
+	})
+	return records
+}
+
+func title(r store.Record) string {
+	if strings.TrimSpace(r.Title) == "" {
+		return "Untitled"
+	}
+	return r.Title
+}
+
+// meta describes the journal day, folder and tags of r.
+func meta(r store.Record) string {
+	var parts []string
+	if r.Journal != "" {
+		parts = append(parts, "journal "+r.Journal)
+	}
+	if r.Folder != "" {
+		parts = append(parts, "/"+r.Folder)
+	}
+	for _, t := range r.Tags {
+		parts = append(parts, "#"+t)
+	}
+	return strings.Join(parts, " ")
+}
+
+// plural returns n and word, in the plural unless n is 1, like the app
+// words its messages.
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// isTerminal reports whether r is a terminal rather than a pipe or file.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// readStdin returns what is piped to stdin, nothing if it is a terminal.
+func readStdin() (string, bool, error) {
+	if isTerminal(stdin) {
+		return "", false, nil
+	}
+	data, err := io.ReadAll(stdin)
+	return string(data), true, err
+}
+
+// EditText opens text in the editor of $VISUAL or $EDITOR and returns it
+// once the editor exits. The text is decrypted meanwhile, so it is written
+// to a private directory in the data directory dir rather than to the
+// system's temporary directory. The directory and any swap or backup files
+// of the editor in it are removed afterwards.
+func EditText(dir, text string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	tmp, err := os.MkdirTemp(dir, EDIT_DIR_PREFIX+"*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	f, err := os.OpenFile(filepath.Join(tmp, "note.md"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	// The editor may come with arguments, like "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", editor, err)
+	}
+	data, err := os.ReadFile(f.Name())
+	return string(data), err
+}
+
+// listFlag is a flag that can be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
@@ -0,0 +1,519 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/export"
+	"github.com/deoxyimran/keeper/app/utils/importer"
+)
+
+// SNIPPET_LEN is the length of the content search prints around a match.
+const SNIPPET_LEN = 60
+
+var commands = map[string]command{
+	"list":    {run: list},
+	"show":    {run: show},
+	"new":     {flags: newFlags, run: newNote},
+	"edit":    {flags: editFlags, run: edit},
+	"rm":      {run: remove},
+	"search":  {run: search},
+	"export":  {flags: exportFlags, run: exportNotes},
+	"import":  {flags: importFlags, run: importNotes},
+	"tui":     {run: runTUI},
+	"capture": {flags: captureFlags, run: capture},
+	"sync":    {flags: syncFlags, run: syncNotes},
+}
+
+// list prints every note.
+func list(e *env, args []string) error {
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	records = sorted(records)
+	if e.asJSON {
+		return printJSON(nonNil(records))
+	}
+	printList(records)
+	return nil
+}
+
+// show prints the notes of args.
+func show(e *env, args []string) error {
+	if len(args) == 0 {
+		return errors.New("show: which note?")
+	}
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	var shown []store.Record
+	for _, arg := range args {
+		i, err := find(records, arg)
+		if err != nil {
+			return err
+		}
+		shown = append(shown, records[i])
+	}
+	if e.asJSON {
+		if len(shown) == 1 {
+			return printJSON(shown[0])
+		}
+		return printJSON(shown)
+	}
+	for k, r := range shown {
+		if k > 0 {
+			fmt.Fprintln(stdout)
+		}
+		fmt.Fprintln(stdout, title(r))
+		fmt.Fprintln(stdout, strings.Repeat("=", len([]rune(title(r)))))
+		fmt.Fprintf(stdout, "%s  %s  %s\n\n", r.ID, formatTime(r.Modified), meta(r))
+		fmt.Fprintln(stdout, strings.TrimRight(r.Content, "\n"))
+	}
+	return nil
+}
+
+// Flags of new and edit
+var (
+	noteTitle   string
+	noteFolder  string
+	noteJournal string
+	noteTags    listFlag
+	notePinned  bool
+	stdinBody   bool
+	appendBody  bool
+)
+
+func newFlags(fs *flag.FlagSet) {
+	fs.StringVar(&noteTitle, "title", "", "title of the note")
+	fs.StringVar(&noteFolder, "folder", "", "folder of the note")
+	fs.StringVar(&noteJournal, "journal", "", "make it the journal entry of the day, as YYYY-MM-DD")
+	fs.Var(&noteTags, "tag", "tag of the note, can be repeated")
+	fs.BoolVar(&notePinned, "pin", false, "pin the note")
+}
+
+// newNote adds a note with the content of stdin and prints its ID.
+func newNote(e *env, args []string) error {
+	if noteTitle == "" && len(args) > 0 {
+		noteTitle = strings.Join(args, " ")
+	}
+	if noteJournal != "" {
+		if _, err := time.Parse(time.DateOnly, noteJournal); err != nil {
+			return fmt.Errorf("new: the journal day %q isn't YYYY-MM-DD", noteJournal)
+		}
+	}
+	content, _, err := readStdin()
+	if err != nil {
+		return err
+	}
+	r := store.Record{
+		ID:       store.NewID(),
+		Title:    strings.TrimSpace(noteTitle),
+		Content:  content,
+		Journal:  noteJournal,
+		Folder:   strings.TrimSpace(noteFolder),
+		Tags:     cleanTags(noteTags),
+		Pinned:   notePinned,
+		Modified: time.Now(),
+	}
+	if _, err := e.put(store.Record{}, r); err != nil {
+		return err
+	}
+	if e.asJSON {
+		return printJSON(r)
+	}
+	fmt.Fprintln(stdout, r.ID)
+	return nil
+}
+
+func editFlags(fs *flag.FlagSet) {
+	fs.StringVar(&noteTitle, "title", "", "new title")
+	fs.StringVar(&noteFolder, "folder", "", "new folder, - takes the note out of its folder")
+	fs.Var(&noteTags, "tag", "tag to add, -tag removes it, can be repeated")
+	fs.BoolVar(&stdinBody, "stdin", false, "replace the content with stdin, even if it is empty")
+	fs.BoolVar(&appendBody, "append", false, "append stdin to the content instead of replacing it")
+}
+
+// edit changes a note. Its content becomes what is piped to stdin, or what
+// it is edited to in the editor, only when flags change nothing else: scripts
+// often run with a stdin which isn't a terminal. --stdin and --append always
+// take stdin.
+func edit(e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("edit: which note?")
+	}
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	i, err := find(records, args[0])
+	if err != nil {
+		return err
+	}
+	r := records[i]
+	if noteTitle != "" {
+		r.Title = strings.TrimSpace(noteTitle)
+	}
+	if noteFolder == "-" {
+		r.Folder = ""
+	} else if noteFolder != "" {
+		r.Folder = strings.TrimSpace(noteFolder)
+	}
+	for _, t := range noteTags {
+		if removed, ok := strings.CutPrefix(t, "-"); ok {
+			r.Tags = slices.DeleteFunc(r.Tags, func(tag string) bool { return strings.EqualFold(tag, removed) })
+		} else {
+			r.Tags = cleanTags(append(r.Tags, t))
+		}
+	}
+	switch {
+	case appendBody:
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		if len(content) > 0 && r.Content != "" && !strings.HasSuffix(r.Content, "\n") {
+			r.Content += "\n"
+		}
+		r.Content += string(content)
+	case stdinBody:
+		content, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		r.Content = string(content)
+	case noteTitle != "" || noteFolder != "" || len(noteTags) > 0:
+		// Only the metadata changes
+	case isTerminal(stdin):
+		if r.Content, err = EditText(e.store.Dir, r.Content); err != nil {
+			return err
+		}
+	default:
+		// An empty stdin isn't taken for an empty content
+		content, _, err := readStdin()
+		if err != nil {
+			return err
+		}
+		if content != "" {
+			r.Content = content
+		}
+	}
+	if slices.Equal(r.Tags, records[i].Tags) && r.Title == records[i].Title &&
+		r.Folder == records[i].Folder && r.Content == records[i].Content {
+		if !e.asJSON {
+			fmt.Fprintln(stderr, "keeper: nothing changed")
+		}
+	} else {
+		r.Modified = time.Now()
+		if _, err := e.put(records[i], r); err != nil {
+			return err
+		}
+	}
+	if e.asJSON {
+		return printJSON(r)
+	}
+	return nil
+}
+
+// remove deletes the notes of args.
+func remove(e *env, args []string) error {
+	if len(args) == 0 {
+		return errors.New("rm: which notes?")
+	}
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, arg := range args {
+		i, err := find(records, arg)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, records[i].ID)
+	}
+	_, err = e.update(func(records []store.Record) ([]store.Record, error) {
+		return slices.DeleteFunc(records, func(r store.Record) bool { return slices.Contains(ids, r.ID) }), nil
+	})
+	if err != nil {
+		return err
+	}
+	if e.asJSON {
+		return printJSON(ids)
+	}
+	fmt.Fprintf(stdout, "Deleted %s\n", plural(len(ids), "note"))
+	return nil
+}
+
+// search prints the notes matching the query of args. Like in the notes
+// list, #tag matches tags and /folder folders, other queries match titles
+// and contents.
+func search(e *env, args []string) error {
+	query := strings.ToLower(strings.TrimSpace(strings.Join(args, " ")))
+	if query == "" {
+		return errors.New("search: search for what?")
+	}
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	found := []store.Record{}
+	for _, r := range sorted(records) {
+		if r.Matches(query) {
+			found = append(found, r)
+		}
+	}
+	if e.asJSON {
+		return printJSON(found)
+	}
+	for _, r := range found {
+		fmt.Fprintf(stdout, "%s  %s\n", r.ID, title(r))
+		if s := snippet(r.Content, query); s != "" {
+			fmt.Fprintf(stdout, "    %s\n", s)
+		}
+	}
+	return nil
+}
+
+// snippet returns the line of content around query, on a single line.
+func snippet(content, query string) string {
+	lower := strings.ToLower(content)
+	at := strings.Index(lower, query)
+	if at < 0 || len(query) == 0 {
+		return ""
+	}
+	// Lowercasing can change the length of some letters
+	if len(lower) != len(content) {
+		content = lower
+	}
+	runes := []rune(content)
+	// Index in runes of the match
+	at = len([]rune(content[:at]))
+	start := max(0, at-SNIPPET_LEN/2)
+	end := min(len(runes), at+len([]rune(query))+SNIPPET_LEN/2)
+	s := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(runes) {
+		s += "…"
+	}
+	return s
+}
+
+// exportFormats are the formats of export by name.
+var exportFormats = map[string]export.Format{
+	"markdown": export.Markdown,
+	"html":     export.HTML,
+	"text":     export.Text,
+	"pdf":      export.PDF,
+}
+
+// Flags of export
+var (
+	exportFormat string
+	exportOut    string
+)
+
+func exportFlags(fs *flag.FlagSet) {
+	fs.StringVar(&exportFormat, "format", "", "markdown, html, text or pdf, from the extension of --out by default")
+	fs.StringVar(&exportOut, "out", "", "file to write, stdout by default")
+}
+
+// exportNotes exports the notes of args, all notes without any.
+func exportNotes(e *env, args []string) error {
+	f, err := exportFormatOf(exportFormat, exportOut)
+	if err != nil {
+		return err
+	}
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		var picked []store.Record
+		for _, arg := range args {
+			i, err := find(records, arg)
+			if err != nil {
+				return err
+			}
+			picked = append(picked, records[i])
+		}
+		records = picked
+	}
+	var notes []export.Note
+	for _, r := range records {
+		notes = append(notes, export.Note{Title: r.Title, Content: r.Content, Journal: r.Journal,
+			Folder: r.Folder, Tags: r.Tags, Modified: r.Modified})
+	}
+	var buf bytes.Buffer
+	if err := export.Write(&buf, f, notes, e.store.ReadAttachment); err != nil {
+		return err
+	}
+	if exportOut == "" || exportOut == "-" {
+		_, err := stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(exportOut, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	if e.asJSON {
+		return printJSON(map[string]any{"file": exportOut, "format": f.String(), "notes": len(notes)})
+	}
+	fmt.Fprintf(stderr, "Exported %s to %s\n", plural(len(notes), "note"), exportOut)
+	return nil
+}
+
+// exportFormatOf returns the format named name, or the one of the extension
+// of out. Markdown is the default.
+func exportFormatOf(name, out string) (export.Format, error) {
+	if name == "" {
+		for _, f := range export.Formats {
+			if strings.EqualFold(filepath.Ext(out), f.Ext()) {
+				return f, nil
+			}
+		}
+		return export.Markdown, nil
+	}
+	if f, ok := exportFormats[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return 0, fmt.Errorf("export: unknown format %q, use markdown, html, text or pdf", name)
+}
+
+// Flags of import
+var (
+	importConflicts string
+	importDryRun    bool
+)
+
+func importFlags(fs *flag.FlagSet) {
+	fs.StringVar(&importConflicts, "conflicts", "keep", "what to do with notes having the title of one of Keeper: keep, replace or skip")
+	fs.BoolVar(&importDryRun, "dry-run", false, "only print what would be imported")
+}
+
+// importNotes imports the export of another application at the path of args.
+func importNotes(e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("import: import which file or folder?")
+	}
+	if !slices.Contains([]string{"keep", "replace", "skip"}, importConflicts) {
+		return fmt.Errorf("import: --conflicts is keep, replace or skip, not %q", importConflicts)
+	}
+	notes, kind, err := importer.Read(args[0])
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Kind       string   `json:"kind"`
+		Found      int      `json:"found"`
+		Added      []string `json:"added"`
+		Replaced   []string `json:"replaced"`
+		Duplicates int      `json:"duplicates"`
+		Skipped    int      `json:"skipped"`
+	}{Kind: kind.String(), Found: len(notes), Added: []string{}, Replaced: []string{}}
+	merge := func(records []store.Record) ([]store.Record, error) {
+		var existing []importer.Existing
+		for _, r := range records {
+			existing = append(existing, importer.Existing{ID: r.ID, Title: r.Title, Journal: r.Journal, Content: r.Content})
+		}
+		duplicates, conflicts := importer.Match(existing, notes)
+		result.Duplicates = len(duplicates)
+		for k, in := range notes {
+			id, conflict := conflicts[k]
+			if duplicates[k] {
+				continue
+			}
+			if conflict && importConflicts == "skip" {
+				result.Skipped++
+				continue
+			}
+			r := store.Record{ID: store.NewID(), Title: in.Title, Journal: in.Journal, Folder: in.Folder,
+				Tags: in.Tags, Pinned: in.Pinned, Modified: in.Modified}
+			if r.Modified.IsZero() {
+				r.Modified = time.Now()
+			}
+			if !importDryRun {
+				var refs []string
+				for _, at := range in.Attachments {
+					stored, err := e.store.AddAttachment(at.Name, at.Data)
+					if err != nil {
+						return nil, err
+					}
+					refs = append(refs, "attachment:"+stored)
+				}
+				r.Content = importer.LinkAttachments(in.Content, refs)
+			}
+			if conflict && importConflicts == "replace" {
+				r.ID = id
+				for i := range records {
+					if records[i].ID == id {
+						records[i] = r
+					}
+				}
+				result.Replaced = append(result.Replaced, id)
+				continue
+			}
+			records = append(records, r)
+			result.Added = append(result.Added, r.ID)
+		}
+		return records, nil
+	}
+	if importDryRun {
+		records, err := e.load()
+		if err != nil {
+			return err
+		}
+		merge(records)
+	} else if _, err := e.update(merge); err != nil {
+		return err
+	}
+	if e.asJSON {
+		return printJSON(result)
+	}
+	verb := "Imported"
+	if importDryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(stdout, "%s %s from the %s export of %d\n", verb, plural(len(result.Added), "new note"), kind, len(notes))
+	if len(result.Replaced) > 0 {
+		fmt.Fprintf(stdout, "  Replaced %s of the same title\n", plural(len(result.Replaced), "note"))
+	}
+	if result.Skipped > 0 {
+		fmt.Fprintf(stdout, "  Skipped %s of the same title\n", plural(result.Skipped, "note"))
+	}
+	if result.Duplicates > 0 {
+		fmt.Fprintf(stdout, "  %s already in Keeper\n", plural(result.Duplicates, "note"))
+	}
+	return nil
+}
+
+// cleanTags trims tags and drops empty and repeated ones.
+func cleanTags(tags []string) []string {
+	var cleaned []string
+	for _, t := range tags {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "#")
+		if t != "" && !slices.ContainsFunc(cleaned, func(c string) bool { return strings.EqualFold(c, t) }) {
+			cleaned = append(cleaned, t)
+		}
+	}
+	return cleaned
+}
+
+// nonNil returns records, an empty list rather than nil so it prints as [].
+func nonNil(records []store.Record) []store.Record {
+	if records == nil {
+		return []store.Record{}
+	}
+	return records
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+// key is a key press: a rune, a control key like ctrl('s') or one of the
+// special keys below.
+type key rune
+
+// Special keys, negative so they never collide with runes
+const (
+	KEY_UP key = -1 - iota
+	KEY_DOWN
+	KEY_LEFT
+	KEY_RIGHT
+	KEY_HOME
+	KEY_END
+	KEY_PAGE_UP
+	KEY_PAGE_DOWN
+	KEY_DELETE
+)
+
+// Control keys
+const (
+	KEY_TAB       key = '\t'
+	KEY_ENTER     key = '\r'
+	KEY_ESCAPE    key = 0x1b
+	KEY_BACKSPACE key = 0x7f
+)
+
+// ctrl returns the key of Ctrl and the letter c.
+func ctrl(c rune) key {
+	return key(c & 0x1f)
+}
+
+// parseKeys returns the keys of input read from a terminal. An escape
+// ending input is the Escape key, the start of a sequence otherwise.
+func parseKeys(input []byte) []key {
+	var keys []key
+	for len(input) > 0 {
+		if input[0] != 0x1b || len(input) == 1 || input[1] != '[' && input[1] != 'O' {
+			if input[0] == 0x1b {
+				keys = append(keys, KEY_ESCAPE)
+				input = input[1:]
+				continue
+			}
+			r, size := utf8.DecodeRune(input)
+			switch {
+			case r == '\n':
+				r = rune(KEY_ENTER)
+			case r == 0x08:
+				r = rune(KEY_BACKSPACE)
+			}
+			keys = append(keys, key(r))
+			input = input[size:]
+			continue
+		}
+		// A CSI or SS3 sequence: parameters then a final byte
+		end := 2
+		for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+			end++
+		}
+		if end == len(input) {
+			return keys
+		}
+		params, final := string(input[2:end]), input[end]
+		input = input[end+1:]
+		if final == '~' {
+			n, _ := strconv.Atoi(params)
+			switch n {
+			case 1, 7:
+				keys = append(keys, KEY_HOME)
+			case 4, 8:
+				keys = append(keys, KEY_END)
+			case 3:
+				keys = append(keys, KEY_DELETE)
+			case 5:
+				keys = append(keys, KEY_PAGE_UP)
+			case 6:
+				keys = append(keys, KEY_PAGE_DOWN)
+			}
+			continue
+		}
+		if k, ok := map[byte]key{'A': KEY_UP, 'B': KEY_DOWN, 'C': KEY_RIGHT, 'D': KEY_LEFT, 'H': KEY_HOME, 'F': KEY_END}[final]; ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/notesync"
+)
+
+// SYNC_PASSPHRASE_ENV is the environment variable of the sync passphrase.
+const SYNC_PASSPHRASE_ENV = "KEEPER_SYNC_PASSPHRASE"
+
+// Flags of sync
+var (
+	syncFolder         string
+	syncPassphraseFile string
+)
+
+func syncFlags(fs *flag.FlagSet) {
+	fs.StringVar(&syncFolder, "folder", "", "shared folder to sync with, the one of the settings by default")
+	fs.StringVar(&syncPassphraseFile, "passphrase-file", "", "file of the passphrase, $"+SYNC_PASSPHRASE_ENV+" or asked by default")
+}
+
+// syncNotes syncs the notes with the shared folder.
+func syncNotes(e *env, args []string) error {
+	if len(args) != 0 {
+		return errors.New("sync takes no arguments")
+	}
+	folder := syncFolder
+	if folder == "" {
+		folder = store.SyncDir()
+	}
+	if folder == "" {
+		return errors.New("no sync folder, set one in the settings or with --folder")
+	}
+	pass, err := syncPassphrase()
+	if err != nil {
+		return err
+	}
+	if err := e.open(); err != nil {
+		return err
+	}
+	res, err := notesync.Sync(e.store, folder, pass)
+	if err != nil {
+		return err
+	}
+	if e.asJSON {
+		return printJSON(res)
+	}
+	fmt.Fprintf(stdout, "Synced: %s sent, %s received, %s deleted\n",
+		plural(res.Sent, "change"), plural(res.Received, "note"), plural(res.Deleted, "note"))
+	return nil
+}
+
+// syncPassphrase returns the passphrase of --passphrase-file, of the
+// environment, typed in the terminal or piped to stdin.
+func syncPassphrase() (string, error) {
+	if syncPassphraseFile != "" {
+		f, err := os.Open(syncPassphraseFile)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		return readLine(f)
+	}
+	if pass := os.Getenv(SYNC_PASSPHRASE_ENV); pass != "" {
+		return pass, nil
+	}
+	if !isTerminal(stdin) {
+		return readLine(stdin)
+	}
+	fmt.Fprint(stderr, "Sync passphrase: ")
+	pass, err := readPassword()
+	fmt.Fprintln(stderr)
+	return pass, err
+}
+
+// readLine returns the first line of r.
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,34 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+// terminal is the terminal of stdin and stdout in raw mode.
+type terminal struct {
+	in, out *os.File
+}
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("the terminal UI isn't supported on " + runtime.GOOS)
+}
+
+func (t *terminal) raw() error {
+	return nil
+}
+
+func (t *terminal) restore() error {
+	return nil
+}
+
+func (t *terminal) size() (int, int) {
+	return 80, 24
+}
+
+func readPassword() (string, error) {
+	return "", errors.New("passphrases can't be typed on " + runtime.GOOS)
+}
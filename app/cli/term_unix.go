@@ -0,0 +1,71 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminal is the terminal of stdin and stdout in raw mode.
+type terminal struct {
+	in, out *os.File
+	cooked  unix.Termios
+}
+
+// openTerminal puts the terminal in raw mode. Reads return after a tenth of
+// a second without input, so the UI notices when the terminal is resized.
+func openTerminal() (*terminal, error) {
+	t := &terminal{in: os.Stdin, out: os.Stdout}
+	cooked, err := unix.IoctlGetTermios(int(t.in.Fd()), ioctlGetTermios)
+	if err != nil {
+		return nil, errors.New("the terminal UI needs a terminal")
+	}
+	t.cooked = *cooked
+	return t, t.raw()
+}
+
+func (t *terminal) raw() error {
+	raw := t.cooked
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 0
+	raw.Cc[unix.VTIME] = 1
+	return unix.IoctlSetTermios(int(t.in.Fd()), ioctlSetTermios, &raw)
+}
+
+// restore puts the terminal back in the mode it was in.
+func (t *terminal) restore() error {
+	return unix.IoctlSetTermios(int(t.in.Fd()), ioctlSetTermios, &t.cooked)
+}
+
+// size returns the columns and rows of the terminal.
+func (t *terminal) size() (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(t.out.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+// readPassword reads a line of the terminal without echoing it.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	cooked, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return "", errors.New("not a terminal")
+	}
+	noEcho := *cooked
+	noEcho.Lflag &^= unix.ECHO
+	noEcho.Lflag |= unix.ICANON | unix.ISIG
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &noEcho); err != nil {
+		return "", err
+	}
+	defer unix.IoctlSetTermios(fd, ioctlSetTermios, cooked)
+	return readLine(os.Stdin)
+}
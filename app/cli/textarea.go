@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TAB_WIDTH is the number of columns a tab takes.
+const TAB_WIDTH = 4
+
+// textArea is a multiline text editor for the terminal. Lines don't wrap,
+// the view scrolls to keep the caret visible.
+type textArea struct {
+	lines [][]rune
+	// Caret, the column in runes
+	row, col int
+	// First line and column shown
+	top, left int
+}
+
+func newTextArea(text string) textArea {
+	t := textArea{}
+	for _, l := range strings.Split(text, "\n") {
+		t.lines = append(t.lines, []rune(l))
+	}
+	return t
+}
+
+func (t *textArea) text() string {
+	lines := make([]string, len(t.lines))
+	for i, l := range t.lines {
+		lines[i] = string(l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// key handles k and reports whether it changed the text.
+func (t *textArea) key(k key, height int) bool {
+	line := t.lines[t.row]
+	switch k {
+	case KEY_UP:
+		t.row = max(0, t.row-1)
+	case KEY_DOWN:
+		t.row = min(len(t.lines)-1, t.row+1)
+	case KEY_PAGE_UP:
+		t.row = max(0, t.row-height)
+	case KEY_PAGE_DOWN:
+		t.row = min(len(t.lines)-1, t.row+height)
+	case KEY_LEFT:
+		if t.col > 0 {
+			t.col = min(t.col, len(line)) - 1
+		} else if t.row > 0 {
+			t.row--
+			t.col = len(t.lines[t.row])
+		}
+	case KEY_RIGHT:
+		if t.col < len(line) {
+			t.col++
+		} else if t.row < len(t.lines)-1 {
+			t.row, t.col = t.row+1, 0
+		}
+	case KEY_HOME:
+		t.col = 0
+	case KEY_END:
+		t.col = len(line)
+	case KEY_ENTER:
+		t.col = min(t.col, len(line))
+		rest := append([]rune(nil), line[t.col:]...)
+		t.lines[t.row] = line[:t.col]
+		t.row, t.col = t.row+1, 0
+		t.lines = append(t.lines[:t.row], append([][]rune{rest}, t.lines[t.row:]...)...)
+		return true
+	case KEY_BACKSPACE:
+		t.col = min(t.col, len(line))
+		if t.col > 0 {
+			t.lines[t.row] = append(line[:t.col-1], line[t.col:]...)
+			t.col--
+			return true
+		}
+		if t.row > 0 {
+			t.row--
+			t.col = len(t.lines[t.row])
+			t.lines[t.row] = append(t.lines[t.row], line...)
+			t.lines = append(t.lines[:t.row+1], t.lines[t.row+2:]...)
+			return true
+		}
+	case KEY_DELETE:
+		t.col = min(t.col, len(line))
+		if t.col < len(line) {
+			t.lines[t.row] = append(line[:t.col], line[t.col+1:]...)
+			return true
+		}
+		if t.row < len(t.lines)-1 {
+			t.lines[t.row] = append(line, t.lines[t.row+1]...)
+			t.lines = append(t.lines[:t.row+1], t.lines[t.row+2:]...)
+			return true
+		}
+	default:
+		if k == KEY_TAB || k >= ' ' && unicode.IsPrint(rune(k)) {
+			t.col = min(t.col, len(line))
+			t.lines[t.row] = append(line[:t.col], append([]rune{rune(k)}, line[t.col:]...)...)
+			t.col++
+			return true
+		}
+	}
+	return false
+}
+
+// view returns the lines shown in width by height columns, and where the
+// caret is in them.
+func (t *textArea) view(width, height int) (lines []string, x, y int) {
+	t.top = min(t.top, t.row)
+	if t.row >= t.top+height {
+		t.top = t.row - height + 1
+	}
+	x = column(t.lines[t.row], min(t.col, len(t.lines[t.row])))
+	t.left = min(t.left, x)
+	if x >= t.left+width {
+		t.left = x - width + 1
+	}
+	for i := t.top; i < len(t.lines) && i < t.top+height; i++ {
+		lines = append(lines, cut(expandTabs(string(t.lines[i])), t.left, width))
+	}
+	return lines, x - t.left, t.row - t.top
+}
+
+// column returns the column of the rune col of line, tabs expanded.
+func column(line []rune, col int) int {
+	x := 0
+	for _, r := range line[:col] {
+		if r == '\t' {
+			x += TAB_WIDTH - x%TAB_WIDTH
+		} else {
+			x++
+		}
+	}
+	return x
+}
+
+func expandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	var b strings.Builder
+	x := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := TAB_WIDTH - x%TAB_WIDTH
+			b.WriteString(strings.Repeat(" ", n))
+			x += n
+			continue
+		}
+		b.WriteRune(r)
+		x++
+	}
+	return b.String()
+}
+
+// cut returns width columns of s from the column left.
+func cut(s string, left, width int) string {
+	runes := []rune(s)
+	if left >= len(runes) {
+		return ""
+	}
+	return string(runes[left:min(len(runes), left+width)])
+}
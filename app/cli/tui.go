@@ -0,0 +1,491 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+)
+
+// Modes of the terminal UI
+const (
+	MODE_LIST = iota
+	MODE_EDIT
+	MODE_SEARCH
+	MODE_PROMPT
+	MODE_CONFIRM
+)
+
+// Escape sequences of the terminal UI
+const (
+	ALT_SCREEN    = "\x1b[?1049h"
+	MAIN_SCREEN   = "\x1b[?1049l"
+	HIDE_CURSOR   = "\x1b[?25l"
+	SHOW_CURSOR   = "\x1b[?25h"
+	STYLE_RESET   = "\x1b[0m"
+	STYLE_BOLD    = "\x1b[1m"
+	STYLE_DIM     = "\x1b[2m"
+	STYLE_REVERSE = "\x1b[7m"
+)
+
+// tui is the terminal UI: the notes list on the left and the selected note
+// on the right, like the notes and editor panes of the window.
+type tui struct {
+	term    *terminal
+	env     *env
+	records []store.Record
+	// Indices in records of the notes listed
+	shown []int
+	// Listed note selected, and first one shown
+	cur, top int
+	query    string
+	mode     int
+	// Note editor, the note it edits as it was opened
+	area    textArea
+	editing store.Record
+	// Prompt and confirmation of the status line
+	prompt   string
+	input    []rune
+	onInput  func(string)
+	onYes    func()
+	status   string
+	quit     bool
+	width    int
+	height   int
+	lastSize [2]int
+}
+
+// runTUI runs the terminal UI on the notes of e until it quits.
+func runTUI(e *env, args []string) error {
+	if !isTerminal(stdin) {
+		return errors.New("tui: the terminal UI needs a terminal")
+	}
+	records, err := e.load()
+	if err != nil {
+		return err
+	}
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	t := &tui{term: term, env: e, records: records}
+	t.filter("")
+	fmt.Fprint(term.out, ALT_SCREEN)
+	defer func() {
+		fmt.Fprint(term.out, STYLE_RESET+SHOW_CURSOR+MAIN_SCREEN)
+		term.restore()
+	}()
+	buf := make([]byte, 256)
+	t.render()
+	for !t.quit {
+		// Reads time out with io.EOF
+		n, err := term.in.Read(buf)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 && e.store.Changed() {
+			t.reload()
+		} else if w, h := term.size(); n == 0 && [2]int{w, h} == t.lastSize {
+			continue
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			t.key(k)
+		}
+		t.render()
+	}
+	return nil
+}
+
+// filter lists the notes matching query, keeping the selected note
+// selected.
+func (t *tui) filter(query string) {
+	selected := t.selected()
+	t.query = query
+	t.shown = t.shown[:0]
+	for i, r := range t.records {
+		if r.Matches(strings.ToLower(strings.TrimSpace(query))) {
+			t.shown = append(t.shown, i)
+		}
+	}
+	slices.SortStableFunc(t.shown, func(i, j int) int {
+		a, b := t.records[i], t.records[j]
+		if a.Pinned != b.Pinned {
+			if a.Pinned {
+				return -1
+			}
+			return 1
+		}
+		return b.Modified.Compare(a.Modified)
+	})
+	t.cur = 0
+	for k, i := range t.shown {
+		if t.records[i].ID == selected {
+			t.cur = k
+		}
+	}
+}
+
+// selected returns the ID of the selected note, if any.
+func (t *tui) selected() string {
+	if t.cur < len(t.shown) {
+		return t.records[t.shown[t.cur]].ID
+	}
+	return ""
+}
+
+// reload loads the notes other processes changed.
+func (t *tui) reload() {
+	records, err := t.env.store.Load()
+	if err != nil {
+		t.status = "Couldn't load the notes: " + err.Error()
+		return
+	}
+	t.records = records
+	t.filter(t.query)
+}
+
+// put saves r, changing the note old to it, and reloads the notes.
+func (t *tui) put(old, r store.Record) {
+	r.Modified = time.Now()
+	t.saved(t.env.put(old, r))
+}
+
+// saved shows the notes as saved, or reports err in the status line.
+func (t *tui) saved(records []store.Record, err error) {
+	if err != nil {
+		t.status = "Couldn't save the notes: " + err.Error()
+		return
+	}
+	t.records = records
+	t.filter(t.query)
+}
+
+// key handles the key k in the current mode.
+func (t *tui) key(k key) {
+	t.status = ""
+	if k == ctrl('c') {
+		if t.mode == MODE_EDIT {
+			t.closeEditor()
+		}
+		t.quit = true
+		return
+	}
+	switch t.mode {
+	case MODE_EDIT:
+		switch k {
+		case KEY_ESCAPE:
+			t.closeEditor()
+		case ctrl('s'):
+			t.saveEditor()
+			t.status = "Saved"
+		default:
+			t.area.key(k, t.height-5)
+		}
+	case MODE_SEARCH, MODE_PROMPT:
+		t.promptKey(k)
+	case MODE_CONFIRM:
+		t.mode = MODE_LIST
+		if k == 'y' || k == 'Y' {
+			t.onYes()
+		}
+	default:
+		t.listKey(k)
+	}
+}
+
+func (t *tui) listKey(k key) {
+	page := max(1, t.height-3)
+	switch k {
+	case KEY_UP, 'k':
+		t.cur = max(0, t.cur-1)
+	case KEY_DOWN, 'j':
+		t.cur = max(0, min(len(t.shown)-1, t.cur+1))
+	case KEY_PAGE_UP:
+		t.cur = max(0, t.cur-page)
+	case KEY_PAGE_DOWN:
+		t.cur = max(0, min(len(t.shown)-1, t.cur+page))
+	case KEY_HOME, 'g':
+		t.cur = 0
+	case KEY_END, 'G':
+		t.cur = max(0, len(t.shown)-1)
+	case KEY_ENTER, KEY_TAB:
+		if len(t.shown) > 0 {
+			t.edit(t.records[t.shown[t.cur]])
+		}
+	case 'e':
+		t.externalEditor()
+	case 'n':
+		t.ask("New note title: ", "", func(title string) {
+			r := store.Record{ID: store.NewID(), Title: strings.TrimSpace(title)}
+			t.query = ""
+			t.put(store.Record{}, r)
+			if i := slices.IndexFunc(t.records, func(c store.Record) bool { return c.ID == r.ID }); i >= 0 {
+				t.cur = slices.Index(t.shown, i)
+				t.edit(t.records[i])
+			}
+		})
+	case 'r':
+		if len(t.shown) > 0 {
+			old := t.records[t.shown[t.cur]]
+			t.ask("Rename to: ", old.Title, func(title string) {
+				r := old
+				r.Title = strings.TrimSpace(title)
+				t.put(old, r)
+			})
+		}
+	case 'p':
+		if len(t.shown) > 0 {
+			old := t.records[t.shown[t.cur]]
+			r := old
+			r.Pinned = !r.Pinned
+			t.put(old, r)
+		}
+	case 'd', KEY_DELETE:
+		if len(t.shown) > 0 {
+			id := t.records[t.shown[t.cur]].ID
+			t.prompt, t.input = fmt.Sprintf("Delete %q? (y/n) ", title(t.records[t.shown[t.cur]])), nil
+			t.mode = MODE_CONFIRM
+			t.onYes = func() {
+				t.saved(t.env.update(func(records []store.Record) ([]store.Record, error) {
+					return slices.DeleteFunc(records, func(r store.Record) bool { return r.ID == id }), nil
+				}))
+				if t.status == "" {
+					t.status = "Deleted"
+				}
+			}
+		}
+	case '/':
+		t.mode = MODE_SEARCH
+		t.prompt, t.input, t.onInput = "Search: ", []rune(t.query), nil
+	case KEY_ESCAPE:
+		t.filter("")
+	case 'q':
+		t.quit = true
+	}
+}
+
+// ask asks for a line of text in the status line, and calls onInput with it
+// unless it is cancelled.
+func (t *tui) ask(prompt, text string, onInput func(string)) {
+	t.mode = MODE_PROMPT
+	t.prompt, t.input, t.onInput = prompt, []rune(text), onInput
+}
+
+// promptKey edits the text of the status line. Searches apply as the query
+// is typed.
+func (t *tui) promptKey(k key) {
+	switch {
+	case k == KEY_ENTER:
+		t.mode = MODE_LIST
+		if onInput := t.onInput; onInput != nil {
+			t.onInput = nil
+			onInput(string(t.input))
+		}
+		return
+	case k == KEY_ESCAPE:
+		if t.mode == MODE_SEARCH {
+			t.filter("")
+		}
+		t.mode, t.onInput = MODE_LIST, nil
+		return
+	case k == KEY_BACKSPACE:
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case k >= ' ':
+		t.input = append(t.input, rune(k))
+	}
+	if t.mode == MODE_SEARCH {
+		t.filter(string(t.input))
+	}
+}
+
+// edit opens r in the note editor.
+func (t *tui) edit(r store.Record) {
+	t.editing = r
+	t.area = newTextArea(r.Content)
+	t.mode = MODE_EDIT
+}
+
+// saveEditor saves the content of the note editor.
+func (t *tui) saveEditor() {
+	if text := t.area.text(); text != t.editing.Content {
+		r := t.editing
+		r.Content = text
+		t.put(t.editing, r)
+		t.editing = r
+	}
+}
+
+// closeEditor saves the note editor and goes back to the list.
+func (t *tui) closeEditor() {
+	t.saveEditor()
+	t.mode = MODE_LIST
+	t.filter(t.query)
+}
+
+// externalEditor edits the selected note in $EDITOR, leaving the terminal to
+// it meanwhile.
+func (t *tui) externalEditor() {
+	if len(t.shown) == 0 {
+		return
+	}
+	old := t.records[t.shown[t.cur]]
+	fmt.Fprint(t.term.out, STYLE_RESET+SHOW_CURSOR+MAIN_SCREEN)
+	t.term.restore()
+	text, err := EditText(t.env.store.Dir, old.Content)
+	t.term.raw()
+	fmt.Fprint(t.term.out, ALT_SCREEN)
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	if text != old.Content {
+		r := old
+		r.Content = text
+		t.put(old, r)
+	}
+}
+
+// render draws the whole screen.
+func (t *tui) render() {
+	t.width, t.height = t.term.size()
+	t.lastSize = [2]int{t.width, t.height}
+	w, h := t.width, t.height
+	listWidth := min(max(w/3, 20), 40)
+	if w < 50 {
+		listWidth = w / 2
+	}
+	noteWidth := w - listWidth - 1
+	rows := h - 2
+
+	var b strings.Builder
+	b.WriteString(HIDE_CURSOR)
+	line := func(y int, s string) {
+		fmt.Fprintf(&b, "\x1b[%d;1H\x1b[2K%s%s", y+1, s, STYLE_RESET)
+	}
+
+	header := fmt.Sprintf(" Keeper  %d of %d notes", len(t.shown), len(t.records))
+	if t.query != "" {
+		header += fmt.Sprintf("  matching %q", t.query)
+	}
+	line(0, STYLE_REVERSE+pad(header, w))
+
+	// Notes list
+	if t.cur < t.top {
+		t.top = t.cur
+	} else if t.cur >= t.top+rows {
+		t.top = t.cur - rows + 1
+	}
+	left := make([]string, rows)
+	for y := range left {
+		k := t.top + y
+		if k >= len(t.shown) {
+			left[y] = pad("", listWidth)
+			continue
+		}
+		r := t.records[t.shown[k]]
+		name := " " + title(r)
+		if r.Pinned {
+			name = "*" + title(r)
+		}
+		left[y] = pad(name, listWidth)
+		if k == t.cur {
+			style := STYLE_REVERSE
+			if t.mode == MODE_EDIT {
+				style = STYLE_BOLD
+			}
+			left[y] = style + left[y] + STYLE_RESET
+		}
+	}
+
+	// Selected note
+	var right []string
+	cursorX, cursorY := -1, -1
+	if t.mode == MODE_EDIT || len(t.shown) > 0 {
+		r := t.editing
+		if t.mode != MODE_EDIT {
+			r = t.records[t.shown[t.cur]]
+		}
+		right = append(right, STYLE_BOLD+pad(title(r), noteWidth)+STYLE_RESET,
+			STYLE_DIM+pad(strings.TrimSpace(formatTime(r.Modified)+"  "+meta(r)), noteWidth)+STYLE_RESET, "")
+		if t.mode == MODE_EDIT {
+			var lines []string
+			lines, cursorX, cursorY = t.area.view(noteWidth, rows-3)
+			right = append(right, lines...)
+			cursorY += 3
+		} else {
+			for _, l := range strings.Split(r.Content, "\n") {
+				right = append(right, wrapLine(expandTabs(l), noteWidth)...)
+			}
+		}
+	} else {
+		right = append(right, STYLE_DIM+"No notes"+STYLE_RESET)
+	}
+	for y := 0; y < rows; y++ {
+		s := left[y] + STYLE_DIM + "│" + STYLE_RESET
+		if y < len(right) {
+			s += right[y]
+		}
+		line(y+1, s)
+	}
+
+	// Status line
+	switch {
+	case t.mode == MODE_SEARCH || t.mode == MODE_PROMPT || t.mode == MODE_CONFIRM:
+		line(h-1, t.prompt+string(t.input))
+		fmt.Fprintf(&b, "\x1b[%d;%dH%s", h, min(len([]rune(t.prompt))+len(t.input), w-1)+1, SHOW_CURSOR)
+		t.term.out.WriteString(b.String())
+		return
+	case t.status != "":
+		line(h-1, pad(t.status, w))
+	case t.mode == MODE_EDIT:
+		line(h-1, STYLE_DIM+pad("esc save and close  ctrl+s save  ctrl+c quit", w))
+	default:
+		line(h-1, STYLE_DIM+pad("↑↓ select  enter edit  e $EDITOR  n new  r rename  p pin  / search  d delete  q quit", w))
+	}
+	if cursorX >= 0 {
+		fmt.Fprintf(&b, "\x1b[%d;%dH%s", cursorY+2, listWidth+2+cursorX, SHOW_CURSOR)
+	}
+	t.term.out.WriteString(b.String())
+}
+
+// pad cuts or pads s with spaces to width columns.
+func pad(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) > width {
+		if width <= 1 {
+			return string(runes[:max(0, width)])
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-len(runes))
+}
+
+// wrapLine wraps s to lines of width columns, at spaces when it can.
+func wrapLine(s string, width int) []string {
+	runes := []rune(s)
+	if width <= 0 {
+		return nil
+	}
+	var lines []string
+	for len(runes) > width {
+		at := width
+		for i := width; i > width/2; i-- {
+			if runes[i] == ' ' {
+				at = i
+				break
+			}
+		}
+		lines = append(lines, string(runes[:at]))
+		runes = runes[at:]
+		if len(runes) > 0 && runes[0] == ' ' {
+			runes = runes[1:]
+		}
+	}
+	return append(lines, string(runes))
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"image"
+
+	"github.com/deoxyimran/keeper/app/utils/fuzzy"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+type paletteItem struct {
+	label  string
+	detail string // Keys of commands, kind of notes
+	run    func()
+}
+
+// commandPalette runs commands and jumps to notes by typing part of their
+// name.
+type commandPalette struct {
+	// Widgets
+	th          *material.Theme
+	input       widget.Editor
+	listW       widget.List
+	clicks      []widget.Clickable
+	backdropTag int
+	// States
+	isOpen    bool
+	needFocus bool
+	items     []paletteItem
+	results   []fuzzy.Result
+	query     string
+	selected  int // Index in results
+	// States refs
+	commands *commands
+	notes    *[]note
+	// Callbacks
+	onJump func(id string)
+}
+
+func newCommandPalette(th *material.Theme, cmds *commands, notes *[]note, onJump func(id string)) commandPalette {
+	return commandPalette{
+		th:       th,
+		commands: cmds,
+		notes:    notes,
+		onJump:   onJump,
+		input:    widget.Editor{SingleLine: true, Submit: true},
+		listW:    widget.List{List: layout.List{Axis: layout.Vertical}},
+	}
+}
+
+func (cp *commandPalette) open() {
+	cp.isOpen = true
+	cp.needFocus = true
+	cp.input.SetText("")
+	// Commands first, then notes
+	cp.items = cp.items[:0]
+	for _, c := range cp.commands.list {
+		if c.id == ACTION_COMMAND_PALETTE || !c.isEnabled() {
+			continue
+		}
+		cp.items = append(cp.items, paletteItem{label: c.title, detail: cp.commands.keymap.keys(c.id), run: c.run})
+	}
+	for _, n := range *cp.notes {
+		id := n.id
+		detail := "Note"
+		if n.journal != "" {
+			detail = "Journal"
+		}
+		cp.items = append(cp.items, paletteItem{label: n.title, detail: detail, run: func() { cp.onJump(id) }})
+	}
+	cp.filter()
+}
+
+func (cp *commandPalette) close() {
+	cp.isOpen = false
+}
+
+func (cp *commandPalette) filter() {
+	cp.query = cp.input.Text()
+	labels := make([]string, len(cp.items))
+	for i, it := range cp.items {
+		labels[i] = it.label
+	}
+	cp.results = fuzzy.Filter(cp.query, labels)
+	cp.selected = 0
+	cp.listW.Position = layout.Position{}
+	if len(cp.clicks) < len(cp.results) {
+		cp.clicks = make([]widget.Clickable, len(cp.results))
+	}
+}
+
+// runItem closes the palette and runs the result at index i.
+func (cp *commandPalette) runItem(i int) {
+	if i < 0 || i >= len(cp.results) {
+		return
+	}
+	cp.close()
+	cp.items[cp.results[i].Index].run()
+}
+
+func (cp *commandPalette) layout(gtx C) D {
+	// Handle keys before the input sees them, it would move its caret on
+	// up and down
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Name: key.NameEscape},
+			key.Filter{Focus: &cp.input, Name: key.NameUpArrow},
+			key.Filter{Focus: &cp.input, Name: key.NameDownArrow},
+			pointer.Filter{Target: &cp.backdropTag, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		switch e := ev.(type) {
+		case pointer.Event:
+			cp.close()
+		case key.Event:
+			if e.State != key.Press {
+				continue
+			}
+			switch e.Name {
+			case key.NameEscape:
+				cp.close()
+			case key.NameUpArrow:
+				cp.selected = max(cp.selected-1, 0)
+				cp.listW.ScrollTo(max(cp.selected-2, 0))
+			case key.NameDownArrow:
+				cp.selected = min(cp.selected+1, len(cp.results)-1)
+				if p := cp.listW.Position; cp.selected >= p.First+p.Count-1 {
+					cp.listW.ScrollTo(max(cp.selected-p.Count+2, 0))
+				}
+			}
+		}
+	}
+	for {
+		ev, ok := cp.input.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			cp.runItem(cp.selected)
+		}
+	}
+	if !cp.isOpen {
+		gtx.Execute(op.InvalidateCmd{})
+		return D{}
+	}
+	if cp.needFocus {
+		gtx.Execute(key.FocusCmd{Tag: &cp.input})
+		cp.needFocus = false
+	}
+	if cp.input.Text() != cp.query {
+		cp.filter()
+	}
+	return layoutModal(gtx, &cp.backdropTag, 560, 420, cp.layoutContent)
+}
+
+func (cp *commandPalette) layoutContent(gtx C) D {
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(entry(cp.th, &cp.input, "Type a command or a note title")),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout),
+		layout.Flexed(1, func(gtx C) D {
+			if len(cp.results) == 0 {
+				return material.Body2(cp.th, "No matches").Layout(gtx)
+			}
+			return material.List(cp.th, &cp.listW).Layout(gtx, len(cp.results), cp.layoutResult)
+		}),
+	)
+}
+
+func (cp *commandPalette) layoutResult(gtx C, i int) D {
+	if cp.clicks[i].Clicked(gtx) {
+		cp.runItem(i)
+		return D{}
+	}
+	it := cp.items[cp.results[i].Index]
+	return material.Clickable(gtx, &cp.clicks[i], func(gtx C) D {
+		return layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				if i == cp.selected {
+					defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+					paint.ColorOp{Color: pal.Selected}.Add(gtx.Ops)
+					paint.PaintOp{}.Add(gtx.Ops)
+				}
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.UniformInset(unit.Dp(6)).Layout(gtx, func(gtx C) D {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Flexed(1, func(gtx C) D {
+							lbl := material.Label(cp.th, unit.Sp(14), it.label)
+							lbl.MaxLines = 1
+							return lbl.Layout(gtx)
+						}),
+						layout.Rigid(func(gtx C) D {
+							lbl := material.Label(cp.th, unit.Sp(12), it.detail)
+							lbl.Font.Style = font.Italic
+							lbl.Color.A = 160
+							return lbl.Layout(gtx)
+						}),
+					)
+				})
+			},
+		)
+	})
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+)
+
+// command is an action of the app. Buttons, shortcuts and the command
+// palette all run actions through commands.
+type command struct {
+	id    string
+	title string
+	// Default keys, the keymap file can rebind them
+	keys []string
+	// Keys only run the command while focus has the keyboard focus, nil
+	// for global shortcuts
+	focus event.Tag
+	// enabled reports whether the command can run, nil means always
+	enabled func() bool
+	run     func()
+}
+
+// commands is the registry of every command.
+type commands struct {
+	list   []*command
+	keymap keymap
+}
+
+func (cs *commands) register(c command) {
+	cs.list = append(cs.list, &c)
+}
+
+func (cs *commands) get(id string) *command {
+	for _, c := range cs.list {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (c *command) isEnabled() bool {
+	return c.enabled == nil || c.enabled()
+}
+
+// run runs the command id if it is enabled.
+func (cs *commands) run(id string) {
+	if c := cs.get(id); c != nil && c.isEnabled() {
+		c.run()
+	}
+}
+
+// loadKeymap binds the keys of the keymap file at path, or the default
+// keys of the commands.
+func (cs *commands) loadKeymap(path string) error {
+	defaults := map[string][]string{}
+	for _, c := range cs.list {
+		defaults[c.id] = c.keys
+	}
+	var err error
+	cs.keymap, err = loadKeymap(path, defaults)
+	return err
+}
+
+// processKeys runs the commands whose keys were pressed, and reports
+// whether any key was.
+func (cs *commands) processKeys(gtx C) (pressed bool) {
+	var filters []event.Filter
+	for _, c := range cs.list {
+		filters = append(filters, cs.keymap.filters(c.focus, c.id)...)
+	}
+	for {
+		ev, ok := gtx.Event(filters...)
+		if !ok {
+			break
+		}
+		e, ok := ev.(key.Event)
+		if !ok || e.State != key.Press {
+			continue
+		}
+		pressed = true
+		for _, c := range cs.list {
+			if _, ok := cs.keymap.action(e, c.id); ok && (c.focus == nil || gtx.Focused(c.focus)) {
+				if c.isEnabled() {
+					c.run()
+				}
+				break
+			}
+		}
+	}
+	return pressed
+}
+
+// registerCommands registers the commands of the app.
+func (a *App) registerCommands() {
+	cs := &a.commands
+	hasNote := func() bool { return a.editorPane.current() >= 0 }
+	hasTargets := func() bool { return len(a.targets()) > 0 }
+	cs.register(command{
+		id: ACTION_NEW_NOTE, title: "New note", keys: []string{"Ctrl+N"},
+		run: func() {
+			a.notesPane.clearSearch()
+			a.notesPane.addNote(note{title: "Untitled"})
+			a.focus = &a.editorPane.tab().titleEditor
+		},
+	})
+	cs.register(command{
+		id: ACTION_DELETE_NOTE, title: "Delete note", keys: []string{"Delete"},
+		focus: &a.notesPane.notesListW, enabled: hasTargets, run: a.deleteNotes,
+	})
+	cs.register(command{
+		id: ACTION_MOVE_NOTES, title: "Move notes to a folder", enabled: hasTargets, run: a.moveNotes,
+	})
+	cs.register(command{
+		id: ACTION_TAG_NOTES, title: "Add a tag to notes", enabled: hasTargets, run: a.tagNotes,
+	})
+	cs.register(command{
+		id: ACTION_PIN_NOTES, title: "Pin or unpin notes", enabled: hasTargets, run: a.pinNotes,
+	})
+	cs.register(command{
+		id: ACTION_EXPORT_NOTES, title: "Export notes", enabled: hasTargets, run: a.exportNotes,
+	})
+	cs.register(command{
+		id: ACTION_BACKUP, title: "Back up everything", run: a.backupNotes,
+	})
+	cs.register(command{
+		id: ACTION_RESTORE, title: "Restore a backup", run: a.restoreBackup,
+	})
+	cs.register(command{
+		id: ACTION_SYNC, title: "Sync with the shared folder", enabled: func() bool { return !a.isSyncing }, run: a.syncNotes,
+	})
+	cs.register(command{
+		id: ACTION_IMPORT, title: "Import notes", run: a.importNotes,
+	})
+	cs.register(command{
+		id: ACTION_EXPORT_ALL, title: "Export all notes", enabled: func() bool { return len(a.notes) > 0 }, run: a.exportAll,
+	})
+	cs.register(command{
+		id: ACTION_CLOSE_TAB, title: "Close tab", keys: []string{"Ctrl+W"}, enabled: hasNote,
+		run: func() { a.editorPane.closeTab(a.editorPane.active) },
+	})
+	cs.register(command{
+		id: ACTION_NEXT_TAB, title: "Next tab", keys: []string{"Ctrl+PageDown"}, enabled: hasNote,
+		run: func() { a.editorPane.cycleTab(1) },
+	})
+	cs.register(command{
+		id: ACTION_PREV_TAB, title: "Previous tab", keys: []string{"Ctrl+PageUp"}, enabled: hasNote,
+		run: func() { a.editorPane.cycleTab(-1) },
+	})
+	cs.register(command{
+		id: ACTION_DETACH, title: "Open note in a new window", keys: []string{"Ctrl+Shift+O"}, enabled: hasNote,
+		run: func() { a.detach(a.editorPane.current()) },
+	})
+	cs.register(command{
+		id: ACTION_NEXT_NOTE, title: "Next note", keys: []string{"Down", "J"},
+		focus: &a.notesPane.notesListW, run: func() { a.notesPane.moveSelection(1) },
+	})
+	cs.register(command{
+		id: ACTION_PREV_NOTE, title: "Previous note", keys: []string{"Up", "K"},
+		focus: &a.notesPane.notesListW, run: func() { a.notesPane.moveSelection(-1) },
+	})
+	cs.register(command{
+		id: ACTION_FOCUS_SEARCH, title: "Search notes", keys: []string{"Ctrl+K"},
+		run: func() {
+			a.isDrawerOpen = true
+			a.notesPane.searchBarW.SetCaret(a.notesPane.searchBarW.Len(), 0)
+			a.focus = &a.notesPane.searchBarW
+		},
+	})
+	cs.register(command{
+		id: ACTION_SWITCH_PANE, title: "Switch between the notes list and the editor", keys: []string{"F6"},
+		run: func() {
+			if a.isListFocused {
+				if a.isEditorOpen {
+					a.isDrawerOpen = false
+					a.focus = &a.editorPane.tab().noteEditor
+				}
+			} else {
+				a.isDrawerOpen = true
+				a.focus = &a.notesPane.notesListW
+			}
+		},
+	})
+	cs.register(command{
+		id: ACTION_FIND, title: "Find in note", keys: []string{"Ctrl+F"}, enabled: hasNote,
+		run: func() {
+			a.editorPane.isPreview = false // Matches are shown in the editor
+			a.editorPane.findBar.open(&a.editorPane.tab().noteEditor)
+		},
+	})
+	cs.register(command{
+		id: ACTION_REPLACE_ALL, title: "Replace in all notes", keys: []string{"Ctrl+Shift+H"},
+		run: a.replaceDlg.open,
+	})
+	cs.register(command{
+		id: ACTION_TOGGLE_PREVIEW, title: "Toggle note preview", keys: []string{"Ctrl+E"}, enabled: hasNote,
+		run: func() { a.editorPane.isPreview = !a.editorPane.isPreview },
+	})
+	cs.register(command{
+		id: ACTION_TODAY, title: "Open today's journal", keys: []string{"Ctrl+T"},
+		run: a.notesPane.openToday,
+	})
+	cs.register(command{
+		id: ACTION_TEMPLATES, title: "Manage templates",
+		run: a.tmplDlg.open,
+	})
+	cs.register(command{
+		id: ACTION_TOGGLE_THEME, title: "Toggle light and dark theme",
+		run: func() {
+			a.settings.Theme = THEME_LIGHT
+			if pal == lightPalette {
+				a.settings.Theme = THEME_DARK
+			}
+			a.applyTheme(a.settings.Theme)
+			a.saveSettings()
+		},
+	})
+	cs.register(command{
+		id: ACTION_LOCK, title: "Lock", keys: []string{"Ctrl+L"},
+		run: func() { a.lock.isLocked = true },
+	})
+	cs.register(command{
+		id: ACTION_SETTINGS, title: "Open settings", keys: []string{"Ctrl+,"},
+		run: func() {
+			// Pick up theme files added since the last time
+			a.themes = loadThemes(DATA_DIR + "/" + THEMES_DIR)
+			a.settingsDlg.open(themeNames(a.themes))
+		},
+	})
+	cs.register(command{
+		id: ACTION_COMMAND_PALETTE, title: "Show all commands", keys: []string{"Ctrl+Shift+P"},
+		run: a.cmdPalette.open,
+	})
+}
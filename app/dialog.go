@@ -0,0 +1,290 @@
+package app
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/font"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// dialogSpec describes what a dialog shows.
+type dialogSpec struct {
+	title string
+	body  string
+	icon  image.Image // Optional
+	// Labels of the buttons, the first one is the default one Enter picks
+	buttons []string
+	cancel  int // Index of the button Esc and clicks outside pick, -1 for none
+	danger  bool
+	// Text input variant, shown when hint isn't empty
+	hint     string
+	text     string // Initial text
+	isSecret bool   // Mask the text, for passphrases
+	// Choice variant, shown when there are choices
+	choices []string
+	choice  int // Initially selected choice
+	// onResult gets the result once a button is picked
+	onResult func(r dialogResult)
+}
+
+// dialogResult is how a dialog was closed.
+type dialogResult struct {
+	button int    // Index of the button picked
+	text   string // Text of the input variant
+	choice int    // Index of the choice of the choice variant
+}
+
+// dialog is a modal dialog. While it is open the keyboard focus stays in
+// it: Tab cycles through its input and buttons, Enter picks the default
+// button and Esc the cancel one.
+type dialog struct {
+	// Widgets
+	th          *material.Theme
+	input       widget.Editor
+	choices     widget.Enum
+	btns        []widget.Clickable
+	backdropTag int
+	// States
+	isOpen    bool
+	needFocus bool
+	spec      dialogSpec
+}
+
+func newDialog(th *material.Theme) dialog {
+	return dialog{
+		th:    th,
+		input: widget.Editor{SingleLine: true, Submit: true},
+	}
+}
+
+// open shows the dialog described by spec, replacing any open one.
+func (d *dialog) open(spec dialogSpec) {
+	d.spec = spec
+	d.isOpen = true
+	d.needFocus = true
+	d.btns = make([]widget.Clickable, len(spec.buttons))
+	d.input.SetText(spec.text)
+	d.input.SetCaret(d.input.Len(), 0)
+	d.input.Mask = 0
+	if spec.isSecret {
+		d.input.Mask = '•'
+	}
+	d.choices.Value = ""
+	if spec.choice >= 0 && spec.choice < len(spec.choices) {
+		d.choices.Value = spec.choices[spec.choice]
+	}
+}
+
+// confirm asks body with a button labeled action that runs onConfirm, and
+// a Cancel one.
+func (d *dialog) confirm(title, body, action string, icon image.Image, onConfirm func()) {
+	d.open(dialogSpec{
+		title: title, body: body, icon: icon, buttons: []string{action, "Cancel"}, cancel: 1, danger: icon != nil,
+		onResult: func(r dialogResult) {
+			if r.button == 0 {
+				onConfirm()
+			}
+		},
+	})
+}
+
+// ask asks for a line of text, initially text, that onSubmit gets unless
+// the dialog is cancelled.
+func (d *dialog) ask(title, body, hint, text string, isSecret bool, onSubmit func(text string)) {
+	d.open(dialogSpec{
+		title: title, body: body, buttons: []string{"OK", "Cancel"}, cancel: 1,
+		hint: hint, text: text, isSecret: isSecret,
+		onResult: func(r dialogResult) {
+			if r.button == 0 {
+				onSubmit(r.text)
+			}
+		},
+	})
+}
+
+// choose asks to pick one of choices, onChoice gets its index unless the
+// dialog is cancelled.
+func (d *dialog) choose(title, body string, choices []string, choice int, onChoice func(i int)) {
+	d.open(dialogSpec{
+		title: title, body: body, buttons: []string{"OK", "Cancel"}, cancel: 1,
+		choices: choices, choice: choice,
+		onResult: func(r dialogResult) {
+			if r.button == 0 && r.choice >= 0 {
+				onChoice(r.choice)
+			}
+		},
+	})
+}
+
+// close closes the dialog as if button i was picked.
+func (d *dialog) close(i int) {
+	if !d.isOpen || i < 0 || i >= len(d.spec.buttons) {
+		return
+	}
+	d.isOpen = false
+	r := dialogResult{button: i, text: d.input.Text(), choice: -1}
+	for k, c := range d.spec.choices {
+		if c == d.choices.Value {
+			r.choice = k
+		}
+	}
+	if d.spec.onResult != nil {
+		d.spec.onResult(r)
+	}
+}
+
+// focusables returns the tags Tab cycles through.
+func (d *dialog) focusables() []event.Tag {
+	var tags []event.Tag
+	if d.spec.hint != "" {
+		tags = append(tags, &d.input)
+	}
+	for i := range d.btns {
+		tags = append(tags, &d.btns[i])
+	}
+	return tags
+}
+
+func (d *dialog) processKeys(gtx C) {
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Name: key.NameEscape},
+			key.Filter{Name: key.NameReturn},
+			key.Filter{Name: key.NameTab, Optional: key.ModShift},
+			pointer.Filter{Target: &d.backdropTag, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		switch e := ev.(type) {
+		case pointer.Event:
+			d.close(d.spec.cancel)
+		case key.Event:
+			if e.State != key.Press {
+				continue
+			}
+			switch e.Name {
+			case key.NameEscape:
+				d.close(d.spec.cancel)
+			case key.NameReturn:
+				d.close(0)
+			case key.NameTab:
+				// Keep the focus in the dialog
+				tags := d.focusables()
+				if len(tags) == 0 {
+					continue
+				}
+				next := 0
+				for i, t := range tags {
+					if gtx.Focused(t) {
+						next = i + 1
+						if e.Modifiers.Contain(key.ModShift) {
+							next = i - 1 + len(tags)
+						}
+					}
+				}
+				gtx.Execute(key.FocusCmd{Tag: tags[next%len(tags)]})
+			}
+		}
+	}
+	for {
+		ev, ok := d.input.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			d.close(0)
+		}
+	}
+	for i := range d.btns {
+		if d.btns[i].Clicked(gtx) {
+			d.close(i)
+		}
+	}
+}
+
+func (d *dialog) layout(gtx C) D {
+	d.processKeys(gtx)
+	if !d.isOpen {
+		gtx.Execute(op.InvalidateCmd{})
+		return D{}
+	}
+	if tags := d.focusables(); d.needFocus && len(tags) > 0 {
+		d.needFocus = false
+		gtx.Execute(key.FocusCmd{Tag: tags[0]})
+	}
+	return layoutModal(gtx, &d.backdropTag, 380, 0, d.layoutContent)
+}
+
+func (d *dialog) layoutContent(gtx C) D {
+	spec := d.spec
+	var children []layout.FlexChild
+	// Icon and title
+	children = append(children, layout.Rigid(func(gtx C) D {
+		return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				if spec.icon == nil {
+					return D{}
+				}
+				return layout.Inset{Right: unit.Dp(8)}.Layout(gtx, widget.Image{Src: paint.NewImageOp(spec.icon)}.Layout)
+			}),
+			layout.Flexed(1, func(gtx C) D {
+				lbl := material.Label(d.th, unit.Sp(16), spec.title)
+				lbl.Font.Weight = font.Medium
+				return lbl.Layout(gtx)
+			}),
+		)
+	}))
+	if spec.body != "" {
+		children = append(children,
+			layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+			layout.Rigid(material.Body1(d.th, spec.body).Layout),
+		)
+	}
+	if spec.hint != "" {
+		children = append(children,
+			layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+			layout.Rigid(entry(d.th, &d.input, spec.hint)),
+		)
+	}
+	for _, c := range spec.choices {
+		c := c
+		children = append(children, layout.Rigid(material.RadioButton(d.th, &d.choices, c, c).Layout))
+	}
+	// Buttons, right aligned with the default one last
+	children = append(children,
+		layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
+		layout.Rigid(func(gtx C) D {
+			btns := []layout.FlexChild{
+				layout.Flexed(1, func(gtx C) D {
+					return D{Size: image.Pt(gtx.Constraints.Max.X, 0)}
+				}),
+			}
+			for i := len(spec.buttons) - 1; i >= 0; i-- {
+				i := i
+				btns = append(btns, layout.Rigid(func(gtx C) D {
+					th := *d.th
+					if i != 0 {
+						th.Palette.ContrastBg = color.NRGBA{A: 0}
+						th.Palette.ContrastFg = pal.Fg
+					} else if spec.danger {
+						th.Palette.ContrastBg = pal.Danger
+						th.Palette.ContrastFg = pal.OnStatus
+					}
+					return layout.Inset{Left: unit.Dp(6)}.Layout(gtx, material.Button(&th, &d.btns[i], spec.buttons[i]).Layout)
+				}))
+			}
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, btns...)
+		}),
+	)
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
@@ -0,0 +1,307 @@
+package app
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gioui.org/font"
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+type findMatch struct {
+	// Rune offsets into the note, used by the editor
+	start, end int
+	// Byte offsets of the match and its submatches, used for replacing
+	submatches []int
+}
+
+type findBar struct {
+	// Widgets
+	th            *material.Theme
+	findEditor    widget.Editor
+	replaceEditor widget.Editor
+	caseSensitive widget.Bool
+	useRegex      widget.Bool
+	prevBtn       button
+	nextBtn       button
+	replaceBtn    button
+	replaceAllBtn button
+	closeBtn      button
+	// States
+	isOpen    bool
+	needFocus bool
+	matches   []findMatch
+	current   int
+	re        *regexp.Regexp
+	err       error
+	// Inputs the matches were computed from
+	query, text       string
+	wasCase, wasRegex bool
+}
+
+func newFindBar(th *material.Theme) findBar {
+	fb := findBar{
+		th:            th,
+		findEditor:    widget.Editor{SingleLine: true, Submit: true},
+		replaceEditor: widget.Editor{SingleLine: true, Submit: true},
+		prevBtn:       button{th: th, label: "Prev"},
+		nextBtn:       button{th: th, label: "Next"},
+		replaceBtn:    button{th: th, label: "Replace"},
+		replaceAllBtn: button{th: th, label: "Replace all"},
+		closeBtn:      button{th: th, label: "Close"},
+	}
+	return fb
+}
+
+func (fb *findBar) open(ed *widget.Editor) {
+	fb.isOpen = true
+	fb.needFocus = true
+	// Search for the selected text if any
+	if s := ed.SelectedText(); s != "" && utf8.RuneCountInString(s) < 100 {
+		fb.findEditor.SetText(s)
+	}
+	fb.findEditor.SetCaret(fb.findEditor.Len(), 0)
+}
+
+func (fb *findBar) close() {
+	fb.isOpen = false
+	fb.matches = nil
+	fb.query = ""
+}
+
+// update recomputes the matches when the query, options or text changed.
+func (fb *findBar) update(text string) {
+	query := fb.findEditor.Text()
+	cs, rx := fb.caseSensitive.Value, fb.useRegex.Value
+	if query == fb.query && text == fb.text && cs == fb.wasCase && rx == fb.wasRegex {
+		return
+	}
+	fb.query, fb.text, fb.wasCase, fb.wasRegex = query, text, cs, rx
+	fb.matches, fb.re, fb.err = nil, nil, nil
+	if query == "" {
+		return
+	}
+	fb.re, fb.err = compileQuery(query, cs, rx)
+	if fb.err != nil {
+		return
+	}
+	// Convert byte offsets to rune offsets as we go
+	runes, last := 0, 0
+	for _, m := range fb.re.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] == m[1] {
+			continue // Skip empty matches
+		}
+		runes += utf8.RuneCountInString(text[last:m[0]])
+		start := runes
+		runes += utf8.RuneCountInString(text[m[0]:m[1]])
+		last = m[1]
+		fb.matches = append(fb.matches, findMatch{start: start, end: runes, submatches: m})
+	}
+	if fb.current >= len(fb.matches) {
+		fb.current = 0
+	}
+}
+
+// compileQuery turns a search query into a regexp, quoting it unless
+// isRegex is set.
+func compileQuery(query string, caseSensitive, isRegex bool) (*regexp.Regexp, error) {
+	pattern := query
+	if !isRegex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// jump moves to the match dir steps away from the current one and selects
+// it, which also scrolls it into view.
+func (fb *findBar) jump(ed *widget.Editor, dir int) {
+	if len(fb.matches) == 0 {
+		return
+	}
+	fb.current = (fb.current + dir + len(fb.matches)) % len(fb.matches)
+	m := fb.matches[fb.current]
+	ed.SetCaret(m.start, m.end)
+}
+
+func (fb *findBar) replacement(m findMatch) string {
+	repl := fb.replaceEditor.Text()
+	if !fb.useRegex.Value {
+		return repl
+	}
+	return string(fb.re.ExpandString(nil, repl, fb.text, m.submatches))
+}
+
+func (fb *findBar) replace(ed *widget.Editor) {
+	if len(fb.matches) == 0 {
+		return
+	}
+	m := fb.matches[fb.current]
+	ed.SetCaret(m.start, m.end)
+	ed.Insert(fb.replacement(m))
+}
+
+// replaceAll replaces every match at once, as a single undoable edit. Only
+// the counted matches are replaced, not the empty ones update skips.
+func (fb *findBar) replaceAll(ed *widget.Editor) {
+	if len(fb.matches) == 0 {
+		return
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range fb.matches {
+		b.WriteString(fb.text[last:m.submatches[0]])
+		b.WriteString(fb.replacement(m))
+		last = m.submatches[1]
+	}
+	b.WriteString(fb.text[last:])
+	ed.SetCaret(0, ed.Len())
+	ed.Insert(b.String())
+	ed.SetCaret(0, 0)
+}
+
+// processKeys handles the shortcuts of the open find bar. The find command
+// opens it.
+func (fb *findBar) processKeys(gtx C, ed *widget.Editor) {
+	if !fb.isOpen {
+		return
+	}
+	filters := []event.Filter{
+		key.Filter{Name: key.NameEscape},
+		key.Filter{Name: "G", Required: key.ModShortcut, Optional: key.ModShift},
+		key.Filter{Name: key.NameF3, Optional: key.ModShift},
+	}
+	for {
+		ev, ok := gtx.Event(filters...)
+		if !ok {
+			break
+		}
+		e, ok := ev.(key.Event)
+		if !ok || e.State != key.Press {
+			continue
+		}
+		switch e.Name {
+		case key.NameEscape:
+			fb.close()
+		case "G", key.NameF3:
+			if e.Modifiers.Contain(key.ModShift) {
+				fb.jump(ed, -1)
+			} else {
+				fb.jump(ed, 1)
+			}
+		}
+	}
+	// Enter finds the next match
+	for {
+		ev, ok := fb.findEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			fb.jump(ed, 1)
+		}
+	}
+	for {
+		ev, ok := fb.replaceEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			fb.replace(ed)
+		}
+	}
+}
+
+// paintMatches highlights the matches visible in the note editor. It must
+// be called right after the editor is laid out, at the same offset.
+func (fb *findBar) paintMatches(gtx C, ed *widget.Editor) {
+	if !fb.isOpen {
+		return
+	}
+	var regions []widget.Region
+	for i, m := range fb.matches {
+		regions = ed.Regions(m.start, m.end, regions[:0])
+		col := pal.Match
+		if i == fb.current {
+			col = pal.Current
+		}
+		for _, r := range regions {
+			rect := clip.Rect(r.Bounds).Push(gtx.Ops)
+			paint.ColorOp{Color: col}.Add(gtx.Ops)
+			paint.PaintOp{}.Add(gtx.Ops)
+			rect.Pop()
+		}
+	}
+}
+
+func (fb *findBar) layout(gtx C, ed *widget.Editor, text string) D {
+	if fb.needFocus {
+		gtx.Execute(key.FocusCmd{Tag: &fb.findEditor})
+		fb.needFocus = false
+	}
+	fb.update(text)
+	fb.prevBtn.onClick = func() { fb.jump(ed, -1) }
+	fb.nextBtn.onClick = func() { fb.jump(ed, 1) }
+	fb.replaceBtn.onClick = func() { fb.replace(ed) }
+	fb.replaceAllBtn.onClick = func() { fb.replaceAll(ed) }
+	fb.closeBtn.onClick = fb.close
+	for _, b := range []*button{&fb.prevBtn, &fb.nextBtn, &fb.replaceBtn, &fb.replaceAllBtn} {
+		b.isDisabled = len(fb.matches) == 0
+	}
+
+	spacer := layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout)
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		// Find row
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(0.5, entry(fb.th, &fb.findEditor, "Find")),
+				spacer,
+				// Match count
+				layout.Rigid(func(gtx C) D {
+					gtx.Constraints.Min.X = gtx.Dp(unit.Dp(70))
+					status := "No results"
+					switch {
+					case fb.err != nil:
+						status = "Bad regex"
+					case len(fb.matches) != 0:
+						status = strconv.Itoa(fb.current+1) + " of " + strconv.Itoa(len(fb.matches))
+					}
+					lbl := material.Label(fb.th, unit.Sp(13), status)
+					lbl.Font.Style = font.Italic
+					return lbl.Layout(gtx)
+				}),
+				layout.Rigid(material.CheckBox(fb.th, &fb.caseSensitive, "Aa").Layout),
+				layout.Rigid(material.CheckBox(fb.th, &fb.useRegex, ".*").Layout),
+				spacer,
+				layout.Rigid(fb.prevBtn.layout),
+				spacer,
+				layout.Rigid(fb.nextBtn.layout),
+				spacer,
+				layout.Rigid(fb.closeBtn.layout),
+			)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(5)}.Layout),
+		// Replace row
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(0.5, entry(fb.th, &fb.replaceEditor, "Replace")),
+				spacer,
+				layout.Rigid(fb.replaceBtn.layout),
+				spacer,
+				layout.Rigid(fb.replaceAllBtn.layout),
+			)
+		}),
+	)
+}
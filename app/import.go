@@ -0,0 +1,158 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/importer"
+)
+
+// What to do with imported notes having the title of a note of Keeper
+const (
+	IMPORT_KEEP_BOTH = iota
+	IMPORT_REPLACE
+	IMPORT_SKIP
+)
+
+// IMPORT_PREVIEW_LEN is the number of titles the import summary lists.
+const IMPORT_PREVIEW_LEN = 5
+
+// importPlan is what an import adds to the notes.
+type importPlan struct {
+	kind  importer.Kind
+	notes []importer.Note
+	// IDs of the notes of Keeper with the titles of imported notes, by
+	// index of the imported note
+	conflicts map[int]string
+	// Indices of the imported notes Keeper already has
+	duplicates map[int]bool
+}
+
+// importNotes asks for an export of another application to import.
+func (a *App) importNotes() {
+	a.dialog.ask("Import notes", "Import a folder of Markdown or text files, a Google Keep Takeout, a Simplenote, "+
+		"Evernote (.enex) or Joplin (.jex or RAW folder) export. Folders can be zipped.",
+		"File or folder", "", false, func(p string) {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				return
+			}
+			notes, kind, err := importer.Read(p)
+			if err != nil {
+				a.toasts.showError("Couldn't import notes", err)
+				return
+			}
+			if len(notes) == 0 {
+				a.toasts.show(SEVERITY_WARNING, "No notes found in "+p)
+				return
+			}
+			a.previewImport(a.planImport(kind, notes))
+		})
+}
+
+// planImport finds which of the imported notes Keeper already has and which
+// have the title of one of its notes.
+func (a *App) planImport(kind importer.Kind, notes []importer.Note) importPlan {
+	var existing []importer.Existing
+	for _, n := range a.notes {
+		existing = append(existing, importer.Existing{ID: n.id, Title: n.title, Journal: n.journal, Content: n.content})
+	}
+	p := importPlan{kind: kind, notes: notes}
+	p.duplicates, p.conflicts = importer.Match(existing, notes)
+	return p
+}
+
+// previewImport summarizes what p adds and asks how to merge it.
+func (a *App) previewImport(p importPlan) {
+	added := len(p.notes) - len(p.conflicts) - len(p.duplicates)
+	if added == 0 && len(p.conflicts) == 0 {
+		a.toasts.show(SEVERITY_INFO, "Keeper already has the "+plural(len(p.notes), "note")+" of the "+p.kind.String()+" export")
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %s in the %s export:\n", plural(len(p.notes), "note"), p.kind)
+	fmt.Fprintf(&b, "• %d new\n", added)
+	if len(p.duplicates) > 0 {
+		fmt.Fprintf(&b, "• %d already in Keeper, they are skipped\n", len(p.duplicates))
+	}
+	if len(p.conflicts) > 0 {
+		fmt.Fprintf(&b, "• %d with the title of a different note of Keeper\n", len(p.conflicts))
+	}
+	var titles []string
+	for k, n := range p.notes {
+		if len(titles) == IMPORT_PREVIEW_LEN {
+			titles = append(titles, "…")
+			break
+		}
+		if !p.duplicates[k] {
+			title := n.Title
+			if _, ok := p.conflicts[k]; ok {
+				title += " (conflict)"
+			}
+			titles = append(titles, title)
+		}
+	}
+	b.WriteString("\n" + strings.Join(titles, "\n"))
+	if len(p.conflicts) == 0 {
+		a.dialog.confirm("Import notes", b.String(), "Import", nil, func() { a.mergeImport(p, IMPORT_KEEP_BOTH) })
+		return
+	}
+	b.WriteString("\n\nFor the notes with the title of a note of Keeper:")
+	a.dialog.choose("Import notes", b.String(),
+		[]string{"Keep both notes", "Replace the note of Keeper", "Skip the imported note"}, IMPORT_KEEP_BOTH,
+		func(mode int) { a.mergeImport(p, mode) })
+}
+
+// mergeImport adds the notes of p to the notes, mode says what to do with
+// the conflicting ones.
+func (a *App) mergeImport(p importPlan, mode int) {
+	var changed []int
+	count := 0
+	var failed error
+	for k, in := range p.notes {
+		id, conflict := p.conflicts[k]
+		if p.duplicates[k] || conflict && mode == IMPORT_SKIP {
+			continue
+		}
+		var refs []string
+		for _, at := range in.Attachments {
+			stored, err := a.store.AddAttachment(at.Name, at.Data)
+			if err != nil {
+				failed = err
+				refs = append(refs, at.Name)
+				continue
+			}
+			refs = append(refs, "attachment:"+stored)
+		}
+		n := note{
+			id:       store.NewID(),
+			title:    in.Title,
+			content:  importer.LinkAttachments(in.Content, refs),
+			journal:  in.Journal,
+			folder:   in.Folder,
+			tags:     in.Tags,
+			isPinned: in.Pinned,
+			modified: in.Modified,
+		}
+		if n.modified.IsZero() {
+			n.modified = time.Now()
+		}
+		count++
+		// The conflicting note may have been deleted since, the imported
+		// one is added then
+		if i := a.editorPane.noteIndex(id); conflict && mode == IMPORT_REPLACE && i >= 0 {
+			n.id, n.isSelected = id, a.notes[i].isSelected
+			a.notes[i] = n
+			changed = append(changed, i)
+			continue
+		}
+		a.notes = append(a.notes, n)
+	}
+	a.notesChanged(changed)
+	if failed != nil {
+		a.toasts.showError("Couldn't import some attachments", failed)
+	}
+	a.toasts.show(SEVERITY_SUCCESS, "Imported "+plural(count, "note")+" from "+p.kind.String())
+}
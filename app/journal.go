@@ -0,0 +1,205 @@
+package app
+
+import (
+	"image"
+	"strconv"
+	"time"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// Journal notes remember the day they belong to in this format.
+const JOURNAL_DATE = "2006-01-02"
+
+var defaultJournalTemplate = noteTemplate{
+	Name:    "Journal",
+	Content: "# {{title}}\n\n",
+}
+
+// journalTemplate returns the template daily notes are created from.
+func (np *notesPane) journalTemplate() noteTemplate {
+	for _, t := range *np.templates {
+		if t.Journal {
+			return t
+		}
+	}
+	return defaultJournalTemplate
+}
+
+// openJournal selects the journal note of day, creating it first if it
+// doesn't exist and create is set.
+func (np *notesPane) openJournal(day time.Time, create bool) {
+	date := day.Format(JOURNAL_DATE)
+	np.showJournal = true
+	np.clearSearch()
+	for i, n := range *np.notes {
+		if n.journal == date {
+			np.handleUnselectNote(*np.selectedNote)
+			np.handleSelectNote(i)
+			return
+		}
+	}
+	if !create {
+		return
+	}
+	t := np.journalTemplate()
+	t.Title = date
+	n := expandTemplate(t, day)
+	n.journal = date
+	np.addNote(n)
+}
+
+func (np *notesPane) openToday() {
+	np.openJournal(time.Now(), true)
+}
+
+// calendar shows a month and lets users pick a day.
+type calendar struct {
+	th      *material.Theme
+	month   time.Time // First day of the shown month
+	prevBtn widget.Clickable
+	nextBtn widget.Clickable
+	days    [42]widget.Clickable
+}
+
+func newCalendar(th *material.Theme) calendar {
+	now := time.Now()
+	return calendar{
+		th:    th,
+		month: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local),
+	}
+}
+
+// layout draws the month. Days for which hasEntry returns true are
+// highlighted, onPick is called with the day that was clicked.
+func (c *calendar) layout(gtx C, hasEntry func(date string) bool, onPick func(day time.Time)) D {
+	if c.prevBtn.Clicked(gtx) {
+		c.month = c.month.AddDate(0, -1, 0)
+	}
+	if c.nextBtn.Clicked(gtx) {
+		c.month = c.month.AddDate(0, 1, 0)
+	}
+	// Weeks start on monday
+	start := c.month.AddDate(0, 0, -((int(c.month.Weekday()) + 6) % 7))
+	today := time.Now().Format(JOURNAL_DATE)
+
+	cell := func(k int) layout.FlexChild {
+		return layout.Flexed(1, func(gtx C) D {
+			day := start.AddDate(0, 0, k)
+			date := day.Format(JOURNAL_DATE)
+			if c.days[k].Clicked(gtx) {
+				onPick(day)
+			}
+			return material.Clickable(gtx, &c.days[k], func(gtx C) D {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.Background{}.Layout(gtx,
+					func(gtx C) D {
+						sz := gtx.Constraints.Min
+						if hasEntry(date) {
+							defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+							paint.ColorOp{Color: pal.Selected}.Add(gtx.Ops)
+							paint.PaintOp{}.Add(gtx.Ops)
+						}
+						return layout.Dimensions{Size: sz}
+					},
+					func(gtx C) D {
+						return layout.UniformInset(unit.Dp(3)).Layout(gtx, func(gtx C) D {
+							lbl := material.Label(c.th, unit.Sp(12), strconv.Itoa(day.Day()))
+							lbl.Alignment = text.Middle
+							if day.Month() != c.month.Month() {
+								lbl.Color.A = 90
+							}
+							if date == today {
+								lbl.Font.Weight = font.ExtraBold
+							}
+							return lbl.Layout(gtx)
+						})
+					},
+				)
+			})
+		})
+	}
+	week := func(w int) layout.FlexChild {
+		return layout.Rigid(func(gtx C) D {
+			children := make([]layout.FlexChild, 7)
+			for d := range children {
+				children[d] = cell(w*7 + d)
+			}
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+		})
+	}
+	rows := []layout.FlexChild{
+		// Month and navigation
+		layout.Rigid(func(gtx C) D {
+			arrow := func(btn *widget.Clickable, s string) layout.Widget {
+				return func(gtx C) D {
+					return material.Clickable(gtx, btn, func(gtx C) D {
+						return layout.UniformInset(unit.Dp(4)).Layout(gtx, material.Label(c.th, unit.Sp(14), s).Layout)
+					})
+				}
+			}
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(arrow(&c.prevBtn, "‹")),
+				layout.Flexed(1, func(gtx C) D {
+					lbl := material.Label(c.th, unit.Sp(13), c.month.Format("January 2006"))
+					lbl.Alignment = text.Middle
+					lbl.Font.Weight = font.Medium
+					return lbl.Layout(gtx)
+				}),
+				layout.Rigid(arrow(&c.nextBtn, "›")),
+			)
+		}),
+		// Weekday names
+		layout.Rigid(func(gtx C) D {
+			var children []layout.FlexChild
+			for _, s := range []string{"Mo", "Tu", "We", "Th", "Fr", "Sa", "Su"} {
+				s := s
+				children = append(children, layout.Flexed(1, func(gtx C) D {
+					lbl := material.Label(c.th, unit.Sp(11), s)
+					lbl.Alignment = text.Middle
+					lbl.Color.A = 150
+					return lbl.Layout(gtx)
+				}))
+			}
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+		}),
+	}
+	for w := 0; w < 6; w++ {
+		rows = append(rows, week(w))
+	}
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, rows...)
+}
+
+// layoutTab draws a tab of the notes pane's notes/journal switch.
+func layoutTab(gtx C, th *material.Theme, btn *widget.Clickable, label string, active bool) D {
+	return material.Clickable(gtx, btn, func(gtx C) D {
+		return layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				if active {
+					defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+					paint.ColorOp{Color: pal.Hover}.Add(gtx.Ops)
+					paint.PaintOp{}.Add(gtx.Ops)
+				}
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				return layout.Inset{Top: unit.Dp(5), Bottom: unit.Dp(5), Left: unit.Dp(8), Right: unit.Dp(8)}.Layout(gtx,
+					func(gtx C) D {
+						lbl := material.Label(th, unit.Sp(13), label)
+						if active {
+							lbl.Font.Weight = font.Bold
+						}
+						return lbl.Layout(gtx)
+					})
+			},
+		)
+	})
+}
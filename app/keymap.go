@@ -0,0 +1,175 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+)
+
+// KEYMAP_FILE rebinds shortcuts, it maps actions to lists of keys, e.g.
+//
+//	{"note.next": ["Down", "J"], "note.new": ["Ctrl+Shift+N"]}
+//
+// Actions missing from it keep their default keys. Ctrl stands for Cmd on
+// macOS.
+const KEYMAP_FILE = "keymap.json"
+
+// Actions that can be bound to keys, they are the IDs of commands
+const (
+	ACTION_NEXT_NOTE       = "note.next"
+	ACTION_PREV_NOTE       = "note.prev"
+	ACTION_NEW_NOTE        = "note.new"
+	ACTION_DELETE_NOTE     = "note.delete"
+	ACTION_MOVE_NOTES      = "notes.move"
+	ACTION_TAG_NOTES       = "notes.tag"
+	ACTION_PIN_NOTES       = "notes.pin"
+	ACTION_EXPORT_NOTES    = "notes.export"
+	ACTION_EXPORT_ALL      = "notes.exportAll"
+	ACTION_IMPORT          = "notes.import"
+	ACTION_BACKUP          = "backup.create"
+	ACTION_RESTORE         = "backup.restore"
+	ACTION_SYNC            = "sync.now"
+	ACTION_CLOSE_TAB       = "tab.close"
+	ACTION_NEXT_TAB        = "tab.next"
+	ACTION_PREV_TAB        = "tab.prev"
+	ACTION_DETACH          = "note.detach"
+	ACTION_FOCUS_SEARCH    = "search.focus"
+	ACTION_SWITCH_PANE     = "pane.switch"
+	ACTION_REPLACE_ALL     = "replace.open"
+	ACTION_FIND            = "find.open"
+	ACTION_TOGGLE_PREVIEW  = "editor.preview"
+	ACTION_TODAY           = "journal.today"
+	ACTION_TEMPLATES       = "templates.manage"
+	ACTION_TOGGLE_THEME    = "theme.toggle"
+	ACTION_LOCK            = "app.lock"
+	ACTION_SETTINGS        = "settings.open"
+	ACTION_COMMAND_PALETTE = "palette.open"
+)
+
+// binding is a key and the modifiers that must be held with it.
+type binding struct {
+	name key.Name
+	mods key.Modifiers
+}
+
+type keymap map[string][]binding
+
+// keyNames maps the names used in the keymap file to Gio's.
+var keyNames = map[string]key.Name{
+	"up": key.NameUpArrow, "down": key.NameDownArrow, "left": key.NameLeftArrow, "right": key.NameRightArrow,
+	"delete": key.NameDeleteForward, "del": key.NameDeleteForward, "backspace": key.NameDeleteBackward,
+	"enter": key.NameReturn, "return": key.NameReturn, "esc": key.NameEscape, "escape": key.NameEscape,
+	"tab": key.NameTab, "space": key.NameSpace, "home": key.NameHome, "end": key.NameEnd,
+	"pageup": key.NamePageUp, "pagedown": key.NamePageDown,
+}
+
+// parseBinding parses keys like "Ctrl+Shift+K".
+func parseBinding(s string) (binding, error) {
+	parts := strings.Split(s, "+")
+	var b binding
+	for _, p := range parts[:len(parts)-1] {
+		switch strings.ToLower(strings.TrimSpace(p)) {
+		case "ctrl", "cmd":
+			b.mods |= key.ModShortcut
+		case "shift":
+			b.mods |= key.ModShift
+		case "alt":
+			b.mods |= key.ModAlt
+		default:
+			return b, fmt.Errorf("unknown modifier %q in %q", p, s)
+		}
+	}
+	name := strings.TrimSpace(parts[len(parts)-1])
+	switch n, ok := keyNames[strings.ToLower(name)]; {
+	case ok:
+		b.name = n
+	case len([]rune(name)) == 1 || (len(name) <= 3 && strings.HasPrefix(strings.ToUpper(name), "F")):
+		b.name = key.Name(strings.ToUpper(name))
+	default:
+		return b, fmt.Errorf("unknown key %q in %q", name, s)
+	}
+	return b, nil
+}
+
+// loadKeymap returns the defaults, a map of actions to their default keys,
+// with the bindings of the keymap file at path applied.
+func loadKeymap(path string, defaults map[string][]string) (keymap, error) {
+	bindings := map[string][]string{}
+	for a, keys := range defaults {
+		bindings[a] = keys
+	}
+	var err error
+	if data, rerr := os.ReadFile(path); rerr == nil {
+		var user map[string][]string
+		if err = json.Unmarshal(data, &user); err == nil {
+			for a, keys := range user {
+				if _, ok := bindings[a]; !ok {
+					err = fmt.Errorf("unknown action %q", a)
+					continue
+				}
+				bindings[a] = keys
+			}
+		}
+	} else if !os.IsNotExist(rerr) {
+		err = rerr
+	}
+	km := keymap{}
+	for a, keys := range bindings {
+		for _, k := range keys {
+			b, perr := parseBinding(k)
+			if perr != nil {
+				err = perr
+				continue
+			}
+			km[a] = append(km[a], b)
+		}
+	}
+	return km, err
+}
+
+// filters returns the key filters of the actions. A nil focus receives the
+// keys no focused widget handles.
+func (km keymap) filters(focus event.Tag, actions ...string) []event.Filter {
+	var filters []event.Filter
+	for _, a := range actions {
+		for _, b := range km[a] {
+			filters = append(filters, key.Filter{Focus: focus, Name: b.name, Required: b.mods})
+		}
+	}
+	return filters
+}
+
+// action returns the action e is bound to among actions.
+func (km keymap) action(e key.Event, actions ...string) (string, bool) {
+	for _, a := range actions {
+		for _, b := range km[a] {
+			if e.Name == b.name && e.Modifiers == b.mods {
+				return a, true
+			}
+		}
+	}
+	return "", false
+}
+
+// keys returns the first key bound to action for display, e.g. "Ctrl+N".
+func (km keymap) keys(action string) string {
+	bs := km[action]
+	if len(bs) == 0 {
+		return ""
+	}
+	var s string
+	if bs[0].mods.Contain(key.ModShortcut) {
+		s += "Ctrl+"
+	}
+	if bs[0].mods.Contain(key.ModAlt) {
+		s += "Alt+"
+	}
+	if bs[0].mods.Contain(key.ModShift) {
+		s += "Shift+"
+	}
+	return s + string(bs[0].name)
+}
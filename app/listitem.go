@@ -0,0 +1,94 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PREVIEW_LEN is the number of runes of content kept for the preview of a
+// note in the list, enough to fill two lines.
+const PREVIEW_LEN = 160
+
+// touch marks n as modified at now.
+func (n *note) touch() {
+	n.modified = time.Now()
+}
+
+// summary returns the preview text and word count of n. They are cached
+// until the content changes, comparing the content to the one they were
+// computed from is cheap as unchanged strings share their bytes.
+func (n *note) summary() (string, int) {
+	if n.summaryOf != n.content {
+		n.summaryOf = n.content
+		n.preview = previewText(n.content, PREVIEW_LEN)
+		n.words = wordCount(n.content)
+	}
+	return n.preview, n.words
+}
+
+// previewText returns the first n runes of the text of content on one
+// line, without the Markdown marks starting lines.
+func previewText(content string, n int) string {
+	var b strings.Builder
+	count := 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "#>-*+ \t")
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+			count++
+		}
+		for _, r := range line {
+			if count == n {
+				return b.String() + "…"
+			}
+			if unicode.IsSpace(r) {
+				r = ' '
+			}
+			b.WriteRune(r)
+			count++
+		}
+	}
+	return b.String()
+}
+
+// wordCount counts the words of s, leaving out Markdown marks like # or -.
+func wordCount(s string) int {
+	count := 0
+	for _, f := range strings.Fields(s) {
+		if strings.IndexFunc(f, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// relativeTime describes t relative to now, e.g. "5 min ago" or
+// "yesterday".
+func relativeTime(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := now.Sub(t)
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := now.Date()
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min ago", int(d.Minutes()))
+	case y1 == y2 && m1 == m2 && d1 == d2:
+		return fmt.Sprintf("%d h ago", int(d.Hours()))
+	case now.AddDate(0, 0, -1).Format(JOURNAL_DATE) == t.Format(JOURNAL_DATE):
+		return "yesterday"
+	case d < 7*24*time.Hour:
+		return t.Format("Monday")
+	case y1 == y2:
+		return t.Format("Jan 2")
+	}
+	return t.Format("Jan 2, 2006")
+}
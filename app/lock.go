@@ -0,0 +1,95 @@
+package app
+
+import (
+	"image"
+	"time"
+
+	"gioui.org/font"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// lock hides the notes after a while without input.
+type lock struct {
+	th        *material.Theme
+	unlockBtn widget.Clickable
+	// States
+	isLocked  bool
+	lastInput time.Time
+	// Lengths of the editors and caret of the note editor, typing changes
+	// them
+	editors [5]int
+}
+
+func newLock(th *material.Theme) lock {
+	return lock{th: th}
+}
+
+// update locks once timeout passed without input. editors is the state of
+// the editors, which they don't report as events.
+func (l *lock) update(gtx C, timeout time.Duration, editors [5]int) {
+	if l.lastInput.IsZero() || editors != l.editors {
+		l.lastInput = gtx.Now
+		l.editors = editors
+	}
+	for {
+		_, ok := gtx.Event(pointer.Filter{Target: l, Kinds: pointer.Move | pointer.Press | pointer.Scroll})
+		if !ok {
+			break
+		}
+		l.lastInput = gtx.Now
+	}
+	if timeout <= 0 || l.isLocked {
+		return
+	}
+	if at := l.lastInput.Add(timeout); gtx.Now.Before(at) {
+		gtx.Execute(op.InvalidateCmd{At: at})
+	} else {
+		l.isLocked = true
+	}
+}
+
+// active notes input that other widgets took, such as the keys of the
+// commands.
+func (l *lock) active(now time.Time) {
+	l.lastInput = now
+}
+
+// watch notices input anywhere in the window without taking it from the
+// widgets. It must be called after everything else is laid out.
+func (l *lock) watch(gtx C) {
+	defer pointer.PassOp{}.Push(gtx.Ops).Pop()
+	defer clip.Rect{Max: gtx.Constraints.Max}.Push(gtx.Ops).Pop()
+	event.Op(gtx.Ops, l)
+}
+
+// layout draws the lock screen.
+func (l *lock) layout(gtx C) D {
+	if l.unlockBtn.Clicked(gtx) {
+		l.isLocked = false
+		l.lastInput = gtx.Now
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	return layout.Center.Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical, Alignment: layout.Middle}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				lbl := material.Label(l.th, unit.Sp(18), "Keeper is locked")
+				lbl.Font.Weight = font.Medium
+				return lbl.Layout(gtx)
+			}),
+			layout.Rigid(layout.Spacer{Height: unit.Dp(14)}.Layout),
+			layout.Rigid(func(gtx C) D {
+				return material.Button(l.th, &l.unlockBtn, "Unlock").Layout(gtx)
+			}),
+			layout.Rigid(func(gtx C) D {
+				return D{Size: image.Pt(0, gtx.Dp(60))}
+			}),
+		)
+	})
+}
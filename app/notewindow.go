@@ -0,0 +1,185 @@
+package app
+
+import (
+	"image"
+	"slices"
+
+	gioapp "gioui.org/app"
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// noteWindow shows a single note in a window of its own, like a sticky note
+// that stays around next to other applications. Every window edits the
+// notes of the App, edits show up in the other windows on their next frame.
+type noteWindow struct {
+	// Widgets
+	th     *material.Theme
+	window *gioapp.Window
+	tab    *noteTab
+	// States
+	title string // Title of the note, the window takes it after the frame
+	// States refs
+	notes    *[]note
+	settings *settings
+	lock     *lock
+	// Callbacks
+	onEdit func()
+}
+
+// sync updates the editors of t to n after n was changed elsewhere, e.g. in
+// another window.
+func (t *noteTab) sync(n *note) {
+	if t.titleEditor.Text() != n.title {
+		t.titleEditor.SetText(n.title)
+	}
+	if t.noteEditor.Text() != n.content {
+		start, end := t.noteEditor.Selection()
+		t.noteEditor.SetText(n.content)
+		t.noteEditor.SetCaret(start, end)
+	}
+}
+
+func (nw *noteWindow) layout(gtx C) D {
+	paint.Fill(gtx.Ops, pal.Bg)
+	message := func(s string) D {
+		return layout.Center.Layout(gtx, func(gtx C) D {
+			lbl := material.Label(nw.th, unit.Sp(14), s)
+			lbl.Color.A = 150
+			return lbl.Layout(gtx)
+		})
+	}
+	if nw.lock.isLocked {
+		return message("Keeper is locked")
+	}
+	i := slices.IndexFunc(*nw.notes, func(n note) bool { return n.id == nw.tab.id })
+	if i < 0 {
+		return message("This note was deleted")
+	}
+	n := &(*nw.notes)[i]
+	nw.tab.sync(n)
+	nw.title = n.title
+
+	dims := layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			// Title entry
+			layout.Rigid(func(gtx C) D {
+				edit := material.Editor(nw.th, &nw.tab.titleEditor, "Title")
+				edit.Font.Style = font.Italic
+				edit.TextSize = unit.Sp(16)
+				return layout.UniformInset(unit.Dp(4)).Layout(gtx, edit.Layout)
+			}),
+			layout.Rigid(layout.Spacer{Height: unit.Dp(5)}.Layout),
+			// Note editor
+			layout.Flexed(1, func(gtx C) D {
+				return layout.Background{}.Layout(gtx,
+					func(gtx C) D {
+						sz := gtx.Constraints.Min
+						defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+						paint.ColorOp{Color: pal.Editor}.Add(gtx.Ops)
+						paint.PaintOp{}.Add(gtx.Ops)
+						return layout.Dimensions{Size: sz}
+					},
+					func(gtx C) D {
+						gtx.Constraints.Min = gtx.Constraints.Max
+						edit := material.Editor(nw.th, &nw.tab.noteEditor, "Write something...")
+						edit.TextSize = unit.Sp(nw.settings.FontSize)
+						edit.Font.Typeface = font.Typeface(nw.settings.FontFamily)
+						return layout.UniformInset(unit.Dp(8)).Layout(gtx, edit.Layout)
+					},
+				)
+			}),
+		)
+	})
+	// Update states
+	if s := nw.tab.titleEditor.Text(); s != n.title {
+		n.title = s
+		n.touch()
+		nw.edited(gtx)
+	}
+	if s := nw.tab.noteEditor.Text(); s != n.content {
+		n.content = s
+		n.touch()
+		nw.edited(gtx)
+	}
+	return dims
+}
+
+func (nw *noteWindow) edited(gtx C) {
+	// Typing here counts as input for the lock of the main window
+	nw.lock.lastInput = gtx.Now
+	gtx.Execute(op.InvalidateCmd{})
+	if nw.onEdit != nil {
+		nw.onEdit()
+	}
+}
+
+// detach opens note i in a window of its own, closing its tab.
+func (a *App) detach(i int) {
+	n := &a.notes[i]
+	nw := &noteWindow{
+		th:       a.th,
+		window:   new(gioapp.Window),
+		tab:      newNoteTab(n),
+		title:    n.title,
+		notes:    &a.notes,
+		settings: &a.settings,
+		lock:     &a.lock,
+		onEdit:   a.invalidateWindows,
+	}
+	nw.window.Option(
+		gioapp.Title(n.title),
+		gioapp.Size(unit.Dp(340), unit.Dp(380)),
+		gioapp.MinSize(unit.Dp(220), unit.Dp(200)),
+	)
+	if k := a.editorPane.tabIndex(n.id); k >= 0 {
+		a.editorPane.closeTab(k)
+	}
+	a.windows = append(a.windows, nw)
+	go a.runNoteWindow(nw)
+}
+
+// runNoteWindow runs the event loop of nw. Windows run in goroutines of
+// their own, they hold a.mu while they touch the app state.
+func (a *App) runNoteWindow(nw *noteWindow) {
+	var ops op.Ops
+	title := nw.title
+	for {
+		switch e := nw.window.Event().(type) {
+		case gioapp.DestroyEvent:
+			a.mu.Lock()
+			a.windows = slices.DeleteFunc(a.windows, func(w *noteWindow) bool { return w == nw })
+			a.autosave()
+			a.mu.Unlock()
+			return
+		case gioapp.FrameEvent:
+			gtx := gioapp.NewContext(&ops, e)
+			a.mu.Lock()
+			nw.layout(gtx)
+			a.mu.Unlock()
+			e.Frame(gtx.Ops)
+			// Options wait for the platform, the other windows shouldn't
+			// wait for them
+			if nw.title != title {
+				title = nw.title
+				nw.window.Option(gioapp.Title(title))
+			}
+		}
+	}
+}
+
+// invalidateWindows redraws every window to show a change made in one of
+// them.
+func (a *App) invalidateWindows() {
+	if a.window != nil {
+		a.window.Invalidate()
+	}
+	for _, nw := range a.windows {
+		nw.window.Invalidate()
+	}
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"image"
+	"io"
+	"strings"
+
+	"github.com/deoxyimran/keeper/app/utils/highlight"
+
+	"gioui.org/font"
+	"gioui.org/io/clipboard"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+type blockKind int
+
+const (
+	blockText blockKind = iota
+	blockImage
+	blockFile
+	blockCode
+)
+
+type previewBlock struct {
+	kind     blockKind
+	text     string
+	name, id string
+	// Code blocks only
+	lang  string
+	lines [][]highlight.Token
+}
+
+// parsePreview splits note content into the blocks shown by the preview.
+// Attachment references on a line of their own become image or file blocks
+// and fenced code blocks become code blocks.
+func parsePreview(content string) []previewBlock {
+	var blocks []previewBlock
+	var lines []string
+	var code *previewBlock
+	flush := func() {
+		if len(lines) != 0 {
+			blocks = append(blocks, previewBlock{kind: blockText, text: strings.Join(lines, "\n")})
+			lines = nil
+		}
+	}
+	for _, line := range strings.Split(content, "\n") {
+		// Fenced code
+		if fence := strings.HasPrefix(strings.TrimSpace(line), "```"); code != nil {
+			if fence {
+				code.text = strings.Join(lines, "\n")
+				blocks = append(blocks, *code)
+				code, lines = nil, nil
+			} else {
+				lines = append(lines, line)
+			}
+			continue
+		} else if fence {
+			flush()
+			code = &previewBlock{kind: blockCode, lang: strings.TrimSpace(strings.TrimSpace(line)[3:])}
+			continue
+		}
+		m := attachmentRefRe.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil || m[0] != strings.TrimSpace(line) {
+			lines = append(lines, line)
+			continue
+		}
+		flush()
+		b := previewBlock{kind: blockFile, name: m[2], id: m[3]}
+		if m[1] == "!" {
+			b.kind = blockImage
+		}
+		blocks = append(blocks, b)
+	}
+	// Unterminated fences run until the end of the note
+	if code != nil {
+		code.text = strings.Join(lines, "\n")
+		blocks = append(blocks, *code)
+		lines = nil
+	}
+	flush()
+	return blocks
+}
+
+type notePreview struct {
+	th          *material.Theme
+	attachments *attachments
+	settings    *settings
+	listW       widget.List
+	copyBtns    []widget.Clickable
+	// Blocks are only parsed again when the content changes and code is
+	// only lexed again when its block changes
+	content   string
+	blocks    []previewBlock
+	highlight highlight.Cache
+}
+
+func newNotePreview(th *material.Theme, attachments *attachments, settings *settings) notePreview {
+	return notePreview{
+		th:          th,
+		attachments: attachments,
+		settings:    settings,
+		listW:       widget.List{List: layout.List{Axis: layout.Vertical}},
+	}
+}
+
+func (p *notePreview) layout(gtx C, content string) D {
+	if content != p.content || p.blocks == nil {
+		p.content = content
+		p.blocks = parsePreview(content)
+		for i, b := range p.blocks {
+			if b.kind == blockCode {
+				p.blocks[i].lines = p.highlight.Lines(b.lang, strings.ReplaceAll(b.text, "\t", "    "))
+			}
+		}
+		p.highlight.Sweep()
+		p.copyBtns = make([]widget.Clickable, len(p.blocks))
+	}
+	return material.List(p.th, &p.listW).Layout(gtx, len(p.blocks), func(gtx C, i int) D {
+		b := p.blocks[i]
+		switch b.kind {
+		case blockImage:
+			return p.layoutImage(gtx, b)
+		case blockFile:
+			return p.layoutFile(gtx, b)
+		case blockCode:
+			return p.layoutCode(gtx, b, &p.copyBtns[i])
+		}
+		lbl := material.Label(p.th, unit.Sp(p.settings.FontSize), b.text)
+		lbl.Font.Typeface = font.Typeface(p.settings.FontFamily)
+		return lbl.Layout(gtx)
+	})
+}
+
+func (p *notePreview) layoutImage(gtx C, b previewBlock) D {
+	src, ok := p.attachments.image(b.id)
+	if !ok {
+		return p.layoutFile(gtx, b)
+	}
+	return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+		// Never make images larger than they are, only shrink them to fit
+		if h := gtx.Dp(unit.Dp(400)); gtx.Constraints.Max.Y > h {
+			gtx.Constraints.Max.Y = h
+		}
+		gtx.Constraints.Min = image.Point{}
+		return widget.Image{Src: src, Fit: widget.ScaleDown, Position: layout.W}.Layout(gtx)
+	})
+}
+
+func (p *notePreview) layoutFile(gtx C, b previewBlock) D {
+	return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+		return layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+				paint.ColorOp{Color: pal.Hover}.Add(gtx.Ops)
+				paint.PaintOp{}.Add(gtx.Ops)
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				return layout.UniformInset(unit.Dp(6)).Layout(gtx,
+					material.Body2(p.th, "Attachment: "+b.name).Layout)
+			},
+		)
+	})
+}
+
+func (p *notePreview) layoutCode(gtx C, b previewBlock, copyBtn *widget.Clickable) D {
+	if copyBtn.Clicked(gtx) {
+		gtx.Execute(clipboard.WriteCmd{Type: "application/text", Data: io.NopCloser(strings.NewReader(b.text))})
+	}
+	return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+		return layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+				paint.ColorOp{Color: pal.CodeBg}.Add(gtx.Ops)
+				paint.PaintOp{}.Add(gtx.Ops)
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layout.UniformInset(unit.Dp(6)).Layout(gtx, func(gtx C) D {
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						// Highlighted code
+						layout.Flexed(1, func(gtx C) D {
+							children := make([]layout.FlexChild, len(b.lines))
+							for i, line := range b.lines {
+								line := line
+								children[i] = layout.Rigid(func(gtx C) D {
+									return p.layoutCodeLine(gtx, line)
+								})
+							}
+							return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+						}),
+						// Copy to clipboard button
+						layout.Rigid(func(gtx C) D {
+							btn := material.Button(p.th, copyBtn, "Copy")
+							btn.TextSize = unit.Sp(11)
+							btn.Inset = layout.UniformInset(unit.Dp(4))
+							return btn.Layout(gtx)
+						}),
+					)
+				})
+			},
+		)
+	})
+}
+
+func (p *notePreview) layoutCodeLine(gtx C, line []highlight.Token) D {
+	if len(line) == 0 {
+		line = []highlight.Token{{Text: " "}}
+	}
+	children := make([]layout.FlexChild, len(line))
+	for i, t := range line {
+		t := t
+		children[i] = layout.Rigid(func(gtx C) D {
+			lbl := material.Label(p.th, unit.Sp(13), t.Text)
+			lbl.Font.Typeface = "Go Mono"
+			lbl.MaxLines = 1
+			if c, ok := pal.tokenColor(t.Kind); ok {
+				lbl.Color = c
+			}
+			if t.Kind == highlight.Keyword {
+				lbl.Font.Weight = font.Bold
+			}
+			return lbl.Layout(gtx)
+		})
+	}
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, children...)
+}
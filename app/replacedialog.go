@@ -0,0 +1,406 @@
+package app
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+type globalMatch struct {
+	note    int
+	noteID  string
+	inTitle bool
+	// Title or content the match was found in
+	text string
+	// Byte offsets of the match and its submatches
+	submatches []int
+	include    widget.Bool
+}
+
+// isStale reports whether the note of m changed since m was found, the
+// offsets of m are then meaningless.
+func (m *globalMatch) isStale(notes []note) bool {
+	if m.note >= len(notes) || notes[m.note].id != m.noteID {
+		return true
+	}
+	if m.inTitle {
+		return notes[m.note].title != m.text
+	}
+	return notes[m.note].content != m.text
+}
+
+type replaceRow struct {
+	note  int
+	match *globalMatch // nil for note headers
+}
+
+// noteSnapshot remembers a note before and after a replace so it can be
+// undone.
+type noteSnapshot struct {
+	id                   string
+	title, content       string
+	newTitle, newContent string
+}
+
+// replaceDialog finds and replaces text across every note.
+type replaceDialog struct {
+	// Widgets
+	th            *material.Theme
+	findEditor    widget.Editor
+	replaceEditor widget.Editor
+	caseSensitive widget.Bool
+	useRegex      widget.Bool
+	listW         widget.List
+	applyBtn      button
+	undoBtn       button
+	closeBtn      button
+	backdropTag   int
+	// States
+	isOpen    bool
+	needFocus bool
+	re        *regexp.Regexp
+	err       error
+	matches   []*globalMatch
+	rows      []replaceRow
+	undo      []noteSnapshot
+	status    string
+	// Inputs the matches were computed from
+	query             string
+	wasCase, wasRegex bool
+	// States refs
+	notes *[]note
+	// Callbacks
+	onChange func(changed []int)
+}
+
+func newReplaceDialog(th *material.Theme, notes *[]note, onChange func(changed []int)) replaceDialog {
+	return replaceDialog{
+		th:            th,
+		notes:         notes,
+		onChange:      onChange,
+		findEditor:    widget.Editor{SingleLine: true},
+		replaceEditor: widget.Editor{SingleLine: true},
+		listW:         widget.List{List: layout.List{Axis: layout.Vertical}},
+		applyBtn:      button{th: th, label: "Replace selected"},
+		undoBtn:       button{th: th, label: "Undo", isDisabled: true},
+		closeBtn:      button{th: th, label: "Close"},
+	}
+}
+
+func (rd *replaceDialog) open() {
+	rd.isOpen = true
+	rd.needFocus = true
+	rd.status = ""
+	rd.search()
+}
+
+func (rd *replaceDialog) close() {
+	rd.isOpen = false
+}
+
+// search finds every match in the titles and contents of all notes.
+func (rd *replaceDialog) search() {
+	rd.query, rd.wasCase, rd.wasRegex = rd.findEditor.Text(), rd.caseSensitive.Value, rd.useRegex.Value
+	rd.matches, rd.rows, rd.re, rd.err = nil, nil, nil, nil
+	if rd.query == "" {
+		return
+	}
+	rd.re, rd.err = compileQuery(rd.query, rd.wasCase, rd.wasRegex)
+	if rd.err != nil {
+		return
+	}
+	for i, n := range *rd.notes {
+		header := true
+		find := func(inTitle bool, text string) {
+			for _, m := range rd.re.FindAllStringSubmatchIndex(text, -1) {
+				if m[0] == m[1] {
+					continue // Skip empty matches
+				}
+				if header {
+					rd.rows = append(rd.rows, replaceRow{note: i})
+					header = false
+				}
+				gm := &globalMatch{note: i, noteID: n.id, inTitle: inTitle, text: text, submatches: m}
+				gm.include.Value = true
+				rd.matches = append(rd.matches, gm)
+				rd.rows = append(rd.rows, replaceRow{note: i, match: gm})
+			}
+		}
+		find(true, n.title)
+		find(false, n.content)
+	}
+}
+
+func (rd *replaceDialog) replacement(text string, m *globalMatch) string {
+	if !rd.wasRegex {
+		return rd.replaceEditor.Text()
+	}
+	return string(rd.re.ExpandString(nil, rd.replaceEditor.Text(), text, m.submatches))
+}
+
+// replaceIn applies the included matches to text, last one first so the
+// offsets of earlier matches stay valid.
+func (rd *replaceDialog) replaceIn(text string, matches []*globalMatch) string {
+	out := text
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		if !m.include.Value {
+			continue
+		}
+		out = out[:m.submatches[0]] + rd.replacement(text, m) + out[m.submatches[1]:]
+	}
+	return out
+}
+
+// apply replaces every included match as a single operation that can be
+// undone with undoLast. Notes changed since the search, by another window,
+// process or device, are skipped.
+func (rd *replaceDialog) apply() {
+	notes := *rd.notes
+	var snaps []noteSnapshot
+	var changed []int
+	count, skipped := 0, 0
+	for i := 0; i < len(rd.matches); {
+		// Matches are grouped by note, titles first
+		n := rd.matches[i].note
+		var inTitle, inContent []*globalMatch
+		stale, included := false, 0
+		for ; i < len(rd.matches) && rd.matches[i].note == n; i++ {
+			m := rd.matches[i]
+			if m.inTitle {
+				inTitle = append(inTitle, m)
+			} else {
+				inContent = append(inContent, m)
+			}
+			if m.include.Value {
+				included++
+			}
+			stale = stale || m.isStale(notes)
+		}
+		if stale {
+			skipped++
+			continue
+		}
+		count += included
+		snap := noteSnapshot{id: notes[n].id, title: notes[n].title, content: notes[n].content}
+		snap.newTitle = rd.replaceIn(snap.title, inTitle)
+		snap.newContent = rd.replaceIn(snap.content, inContent)
+		if snap.newTitle == snap.title && snap.newContent == snap.content {
+			continue
+		}
+		notes[n].title, notes[n].content = snap.newTitle, snap.newContent
+		notes[n].touch()
+		snaps = append(snaps, snap)
+		changed = append(changed, n)
+	}
+	rd.status = ""
+	if len(snaps) > 0 {
+		rd.undo = snaps
+		rd.status = fmt.Sprintf("Replaced %s in %s", plural(count, "match"), plural(len(snaps), "note"))
+		rd.onChange(changed)
+	}
+	switch {
+	case skipped > 0 && rd.status == "":
+		rd.status = fmt.Sprintf("Skipped %s changed since the search", plural(skipped, "note"))
+	case skipped > 0:
+		rd.status += fmt.Sprintf(", skipped %s changed since the search", plural(skipped, "note"))
+	}
+	rd.search()
+}
+
+// undoLast reverts the last apply. Notes edited or deleted since then are
+// left alone.
+func (rd *replaceDialog) undoLast() {
+	notes := *rd.notes
+	var changed []int
+	for _, s := range rd.undo {
+		i := slices.IndexFunc(notes, func(n note) bool { return n.id == s.id })
+		if i < 0 || notes[i].title != s.newTitle || notes[i].content != s.newContent {
+			continue
+		}
+		notes[i].title, notes[i].content = s.title, s.content
+		notes[i].touch()
+		changed = append(changed, i)
+	}
+	rd.undo = nil
+	rd.status = "Restored " + plural(len(changed), "note")
+	rd.onChange(changed)
+	rd.search()
+}
+
+func (rd *replaceDialog) layout(gtx C) D {
+	// Handle keys and clicks outside the box
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Name: key.NameEscape},
+			pointer.Filter{Target: &rd.backdropTag, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		if e, ok := ev.(key.Event); ok && e.State != key.Press {
+			continue
+		}
+		rd.close()
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	if rd.needFocus {
+		gtx.Execute(key.FocusCmd{Tag: &rd.findEditor})
+		rd.needFocus = false
+	}
+	// Update results
+	if rd.findEditor.Text() != rd.query || rd.caseSensitive.Value != rd.wasCase || rd.useRegex.Value != rd.wasRegex {
+		rd.search()
+	}
+	rd.applyBtn.onClick = rd.apply
+	rd.undoBtn.onClick = rd.undoLast
+	rd.closeBtn.onClick = rd.close
+	rd.applyBtn.isDisabled = len(rd.matches) == 0
+	rd.undoBtn.isDisabled = len(rd.undo) == 0
+
+	return layoutModal(gtx, &rd.backdropTag, 700, 500, rd.layoutContent)
+}
+
+func (rd *replaceDialog) layoutContent(gtx C) D {
+	spacer := layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout)
+	vspacer := layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout)
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		// Title
+		layout.Rigid(func(gtx C) D {
+			lbl := material.Label(rd.th, unit.Sp(16), "Replace in all notes")
+			lbl.Font.Weight = font.Medium
+			return lbl.Layout(gtx)
+		}),
+		vspacer,
+		// Find and replace entries
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(0.5, entry(rd.th, &rd.findEditor, "Find")),
+				spacer,
+				layout.Flexed(0.5, entry(rd.th, &rd.replaceEditor, "Replace with")),
+				spacer,
+				layout.Rigid(material.CheckBox(rd.th, &rd.caseSensitive, "Aa").Layout),
+				layout.Rigid(material.CheckBox(rd.th, &rd.useRegex, ".*").Layout),
+			)
+		}),
+		vspacer,
+		// Matches grouped by note
+		layout.Flexed(0.5, func(gtx C) D {
+			return layout.Background{}.Layout(gtx,
+				func(gtx C) D {
+					sz := gtx.Constraints.Min
+					defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 7).Push(gtx.Ops).Pop()
+					paint.ColorOp{Color: pal.Well}.Add(gtx.Ops)
+					paint.PaintOp{}.Add(gtx.Ops)
+					return layout.Dimensions{Size: sz}
+				},
+				func(gtx C) D {
+					gtx.Constraints.Min = gtx.Constraints.Max
+					return layout.UniformInset(unit.Dp(6)).Layout(gtx, func(gtx C) D {
+						return material.List(rd.th, &rd.listW).Layout(gtx, len(rd.rows), rd.layoutRow)
+					})
+				},
+			)
+		}),
+		vspacer,
+		// Status and actions
+		layout.Rigid(func(gtx C) D {
+			status := rd.status
+			switch {
+			case rd.err != nil:
+				status = "Bad regex"
+			case status == "" && rd.query != "":
+				status = fmt.Sprintf("%d matches", len(rd.matches))
+			}
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(0.5, func(gtx C) D {
+					lbl := material.Label(rd.th, unit.Sp(13), status)
+					lbl.Font.Style = font.Italic
+					return lbl.Layout(gtx)
+				}),
+				layout.Rigid(rd.applyBtn.layout),
+				spacer,
+				layout.Rigid(rd.undoBtn.layout),
+				spacer,
+				layout.Rigid(rd.closeBtn.layout),
+			)
+		}),
+	)
+}
+
+func (rd *replaceDialog) layoutRow(gtx C, i int) D {
+	row := rd.rows[i]
+	notes := *rd.notes
+	if row.note >= len(notes) {
+		return D{}
+	}
+	n := notes[row.note]
+	if row.match == nil {
+		// Note header
+		return layout.Inset{Top: unit.Dp(6), Bottom: unit.Dp(2)}.Layout(gtx, func(gtx C) D {
+			lbl := material.Label(rd.th, unit.Sp(14), n.title)
+			lbl.Font.Weight = font.Bold
+			lbl.MaxLines = 1
+			return lbl.Layout(gtx)
+		})
+	}
+	m := row.match
+	text := n.content
+	if m.inTitle {
+		text = n.title
+	}
+	if m.submatches[1] > len(text) {
+		return D{}
+	}
+	before, after := matchContext(text, m.submatches[0], m.submatches[1])
+	label := func(s string, c color.NRGBA) layout.FlexChild {
+		return layout.Rigid(func(gtx C) D {
+			lbl := material.Label(rd.th, unit.Sp(13), s)
+			lbl.MaxLines = 1
+			if c != (color.NRGBA{}) {
+				lbl.Color = c
+			}
+			return lbl.Layout(gtx)
+		})
+	}
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(material.CheckBox(rd.th, &m.include, "").Layout),
+		label(before, color.NRGBA{}),
+		label(text[m.submatches[0]:m.submatches[1]], pal.Danger),
+		label(" → "+rd.replacement(text, m)+" ", pal.Success),
+		label(after, color.NRGBA{}),
+	)
+}
+
+// matchContext returns a little of the line around a match.
+func matchContext(text string, start, end int) (before, after string) {
+	const n = 30
+	lineStart := strings.LastIndexByte(text[:start], '\n') + 1
+	lineEnd := len(text)
+	if i := strings.IndexByte(text[end:], '\n'); i >= 0 {
+		lineEnd = end + i
+	}
+	before, after = text[lineStart:start], text[end:lineEnd]
+	if r := []rune(before); len(r) > n {
+		before = "…" + string(r[len(r)-n:])
+	}
+	if r := []rune(after); len(r) > n {
+		after = string(r[:n]) + "…"
+	}
+	return before, after
+}
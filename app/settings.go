@@ -0,0 +1,344 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deoxyimran/keeper/app/store"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// SETTINGS_FILE always lives in DATA_DIR, even when notes are kept in
+// another directory.
+const SETTINGS_FILE = store.SETTINGS_FILE
+
+const (
+	MIN_FONT_SIZE = 10
+	MAX_FONT_SIZE = 28
+)
+
+// settings are the user preferences kept in DATA_DIR/SETTINGS_FILE.
+type settings struct {
+	Theme      string  `json:"theme"`
+	FontSize   float32 `json:"fontSize"`   // Editor font size in sp
+	FontFamily string  `json:"fontFamily"` // Editor font, empty for the default one
+	// Seconds between automatic saves, 0 only saves on changes made
+	// outside the editor and on exit
+	Autosave int `json:"autosave"`
+	// Directory of the notes, templates and attachments
+	DataDir string `json:"dataDir"`
+	// Minutes without input before the notes are hidden, 0 never locks
+	LockTimeout int `json:"lockTimeout"`
+	// Whether the notes are served to local scripts, and where: a loopback
+	// address or API_UNIX_PREFIX and the path of a Unix socket
+	API     bool   `json:"api"`
+	APIAddr string `json:"apiAddr,omitempty"`
+	// Shared folder the notes are synced through, such as a synced
+	// directory or a NAS
+	SyncDir string `json:"syncDir,omitempty"`
+}
+
+var defaultSettings = settings{
+	Theme:    THEME_SYSTEM,
+	FontSize: 14,
+	Autosave: 30,
+	DataDir:  DATA_DIR,
+}
+
+func (a *App) loadSettings() error {
+	a.settings = defaultSettings
+	data, err := os.ReadFile(DATA_DIR + "/" + SETTINGS_FILE)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	err = json.Unmarshal(data, &a.settings)
+	if a.settings.DataDir == "" {
+		a.settings.DataDir = DATA_DIR
+	}
+	a.settings.FontSize = max(min(a.settings.FontSize, MAX_FONT_SIZE), MIN_FONT_SIZE)
+	return err
+}
+
+func (a *App) saveSettings() error {
+	data, err := json.MarshalIndent(a.settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(DATA_DIR, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(DATA_DIR+"/"+SETTINGS_FILE, data, 0600)
+}
+
+// settingsDialog edits the settings, applying changes right away.
+type settingsDialog struct {
+	// Widgets
+	th            *material.Theme
+	listW         widget.List
+	theme         widget.Enum
+	fontSize      widget.Float
+	fontEditor    widget.Editor
+	autosaveEd    widget.Editor
+	lockEd        widget.Editor
+	dataDirEditor widget.Editor
+	dataDirBtn    button
+	apiCheck      widget.Bool
+	apiAddrEditor widget.Editor
+	syncDirEditor widget.Editor
+	closeBtn      button
+	backdropTag   int
+	// States
+	isOpen bool
+	themes []string
+	err    error // Error of the last data directory change
+	// States refs
+	settings *settings
+	// Callbacks
+	onChange  func()
+	onDataDir func(dir string) error
+}
+
+func newSettingsDialog(th *material.Theme, s *settings, onChange func(), onDataDir func(dir string) error) settingsDialog {
+	return settingsDialog{
+		th:            th,
+		settings:      s,
+		onChange:      onChange,
+		onDataDir:     onDataDir,
+		listW:         widget.List{List: layout.List{Axis: layout.Vertical}},
+		fontEditor:    widget.Editor{SingleLine: true},
+		autosaveEd:    widget.Editor{SingleLine: true, Filter: "0123456789"},
+		lockEd:        widget.Editor{SingleLine: true, Filter: "0123456789"},
+		dataDirEditor: widget.Editor{SingleLine: true, Submit: true},
+		apiAddrEditor: widget.Editor{SingleLine: true, Submit: true},
+		syncDirEditor: widget.Editor{SingleLine: true},
+		dataDirBtn:    button{th: th, label: "Use directory"},
+		closeBtn:      button{th: th, label: "Close"},
+	}
+}
+
+// open shows the dialog with themes listing the available theme names.
+func (sd *settingsDialog) open(themes []string) {
+	sd.isOpen = true
+	sd.themes = themes
+	sd.err = nil
+	s := sd.settings
+	sd.theme.Value = s.Theme
+	sd.fontSize.Value = (s.FontSize - MIN_FONT_SIZE) / (MAX_FONT_SIZE - MIN_FONT_SIZE)
+	sd.fontEditor.SetText(s.FontFamily)
+	sd.autosaveEd.SetText(strconv.Itoa(s.Autosave))
+	sd.lockEd.SetText(strconv.Itoa(s.LockTimeout))
+	sd.dataDirEditor.SetText(s.DataDir)
+	sd.apiCheck.Value = s.API
+	sd.apiAddrEditor.SetText(s.APIAddr)
+	sd.syncDirEditor.SetText(s.SyncDir)
+}
+
+func (sd *settingsDialog) close() {
+	sd.isOpen = false
+}
+
+// update applies the edited values to the settings.
+func (sd *settingsDialog) update(gtx C) {
+	s := *sd.settings
+	if sd.theme.Update(gtx) {
+		s.Theme = sd.theme.Value
+	}
+	if sd.fontSize.Update(gtx) {
+		s.FontSize = float32(math.Round(float64(MIN_FONT_SIZE + sd.fontSize.Value*(MAX_FONT_SIZE-MIN_FONT_SIZE))))
+	}
+	s.FontFamily = strings.TrimSpace(sd.fontEditor.Text())
+	if n, err := strconv.Atoi(sd.autosaveEd.Text()); err == nil {
+		s.Autosave = n
+	}
+	if n, err := strconv.Atoi(sd.lockEd.Text()); err == nil {
+		s.LockTimeout = n
+	}
+	s.SyncDir = strings.TrimSpace(sd.syncDirEditor.Text())
+	// Like the data directory, the API address only changes on request
+	if sd.apiCheck.Update(gtx) {
+		s.API = sd.apiCheck.Value
+		s.APIAddr = strings.TrimSpace(sd.apiAddrEditor.Text())
+	}
+	for {
+		ev, ok := sd.apiAddrEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			s.APIAddr = strings.TrimSpace(sd.apiAddrEditor.Text())
+		}
+	}
+	if s != *sd.settings {
+		*sd.settings = s
+		sd.onChange()
+	}
+	// The data directory only changes on request since every keystroke
+	// would be a different directory
+	applyDir := func() {
+		dir := strings.TrimSpace(sd.dataDirEditor.Text())
+		if dir == "" || dir == sd.settings.DataDir {
+			return
+		}
+		sd.err = sd.onDataDir(dir)
+	}
+	for {
+		ev, ok := sd.dataDirEditor.Update(gtx)
+		if !ok {
+			break
+		}
+		if _, ok := ev.(widget.SubmitEvent); ok {
+			applyDir()
+		}
+	}
+	sd.dataDirBtn.onClick = applyDir
+}
+
+func (sd *settingsDialog) layout(gtx C) D {
+	// Handle keys and clicks outside the box
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Name: key.NameEscape},
+			pointer.Filter{Target: &sd.backdropTag, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		if e, ok := ev.(key.Event); ok && e.State != key.Press {
+			continue
+		}
+		sd.close()
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	sd.update(gtx)
+	sd.closeBtn.onClick = sd.close
+	return layoutModal(gtx, &sd.backdropTag, 460, 560, sd.layoutContent)
+}
+
+func (sd *settingsDialog) layoutContent(gtx C) D {
+	vspacer := layout.Spacer{Height: unit.Dp(7)}.Layout
+	heading := func(s string) layout.Widget {
+		return func(gtx C) D {
+			return layout.Inset{Top: unit.Dp(10), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+				lbl := material.Label(sd.th, unit.Sp(14), s)
+				lbl.Font.Weight = font.Bold
+				return lbl.Layout(gtx)
+			})
+		}
+	}
+	hint := func(s string) layout.Widget {
+		return func(gtx C) D {
+			lbl := material.Label(sd.th, unit.Sp(12), s)
+			lbl.Font.Style = font.Italic
+			return lbl.Layout(gtx)
+		}
+	}
+	// field lays out a label next to an entry
+	field := func(label string, ed *widget.Editor, placeholder string) layout.Widget {
+		return func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					gtx.Constraints.Min.X = gtx.Dp(170)
+					return material.Body2(sd.th, label).Layout(gtx)
+				}),
+				layout.Flexed(1, entry(sd.th, ed, placeholder)),
+			)
+		}
+	}
+
+	var rows []layout.Widget
+	rows = append(rows,
+		heading("Editor"),
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx C) D {
+					gtx.Constraints.Min.X = gtx.Dp(170)
+					return material.Body2(sd.th, fmt.Sprintf("Font size: %g", sd.settings.FontSize)).Layout(gtx)
+				}),
+				layout.Flexed(1, material.Slider(sd.th, &sd.fontSize).Layout),
+			)
+		},
+		vspacer,
+		field("Font family", &sd.fontEditor, "Default"),
+		heading("Theme"),
+	)
+	for _, name := range sd.themes {
+		name := name
+		rows = append(rows, material.RadioButton(sd.th, &sd.theme, name, name).Layout)
+	}
+	rows = append(rows,
+		hint("More themes can be added as JSON files to "+DATA_DIR+"/"+THEMES_DIR),
+		heading("Behavior"),
+		field("Autosave every (seconds)", &sd.autosaveEd, "0 to turn off"),
+		vspacer,
+		field("Lock after (minutes)", &sd.lockEd, "0 to never lock"),
+		heading("Storage"),
+		func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Flexed(1, entry(sd.th, &sd.dataDirEditor, DATA_DIR)),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout),
+				layout.Rigid(sd.dataDirBtn.layout),
+			)
+		},
+		vspacer,
+		func(gtx C) D {
+			if sd.err != nil {
+				lbl := material.Label(sd.th, unit.Sp(12), sd.err.Error())
+				lbl.Color = pal.Danger
+				return lbl.Layout(gtx)
+			}
+			return hint("Notes are loaded from the directory, or moved there if it has none")(gtx)
+		},
+		heading("Sync"),
+		field("Shared folder", &sd.syncDirEditor, "Synced directory or NAS"),
+		vspacer,
+		hint("Notes are synced there encrypted with a passphrase, the same on every device, with the "+
+			"\"Sync with the shared folder\" command or keeper sync."),
+		heading("Local API"),
+		material.CheckBox(sd.th, &sd.apiCheck, "Let local scripts and editors read and change the notes").Layout,
+		vspacer,
+		field("Address", &sd.apiAddrEditor, API_ADDR),
+		vspacer,
+		hint("A loopback address, or "+API_UNIX_PREFIX+"/path for a Unix socket. Requests need the token of "+
+			DATA_DIR+"/"+API_TOKEN_FILE+" in an Authorization: Bearer header."),
+	)
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		// Title
+		layout.Rigid(func(gtx C) D {
+			lbl := material.Label(sd.th, unit.Sp(16), "Settings")
+			lbl.Font.Weight = font.Medium
+			return lbl.Layout(gtx)
+		}),
+		layout.Flexed(1, func(gtx C) D {
+			return material.List(sd.th, &sd.listW).Layout(gtx, len(rows), func(gtx C, i int) D {
+				return rows[i](gtx)
+			})
+		}),
+		layout.Rigid(vspacer),
+		// Actions
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Flexed(1, func(gtx C) D {
+					return D{Size: image.Pt(gtx.Constraints.Max.X, 0)}
+				}),
+				layout.Rigid(sd.closeBtn.layout),
+			)
+		}),
+	)
+}
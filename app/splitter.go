@@ -0,0 +1,60 @@
+package app
+
+import (
+	"image"
+
+	"gioui.org/gesture"
+	"gioui.org/io/pointer"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+)
+
+const (
+	MIN_NOTES_WIDTH  unit.Dp = 180
+	MIN_EDITOR_WIDTH unit.Dp = 300
+	// Windows narrower than this show the notes list in a drawer
+	NARROW_WIDTH unit.Dp = 600
+)
+
+// splitter is the draggable handle between the notes pane and the editor
+// pane.
+type splitter struct {
+	drag  gesture.Drag
+	grabX float32
+}
+
+// layout draws the handle and applies drags to width, keeping it between
+// minW and maxW.
+func (s *splitter) layout(gtx C, width *unit.Dp, minW, maxW unit.Dp) D {
+	for {
+		e, ok := s.drag.Update(gtx.Metric, gtx.Source, gesture.Horizontal)
+		if !ok {
+			break
+		}
+		switch e.Kind {
+		case pointer.Press:
+			s.grabX = e.Position.X
+		case pointer.Drag:
+			// Positions are relative to the handle, which moves with the width
+			*width += unit.Dp((e.Position.X - s.grabX) / gtx.Metric.PxPerDp)
+		}
+	}
+	*width = max(min(*width, maxW), minW)
+
+	sz := image.Pt(gtx.Dp(7), gtx.Constraints.Max.Y)
+	defer clip.Rect{Max: sz}.Push(gtx.Ops).Pop()
+	pointer.CursorColResize.Add(gtx.Ops)
+	s.drag.Add(gtx.Ops)
+	// Draw a thin line in the middle of the handle
+	col := pal.Fg
+	col.A = 20
+	if s.drag.Dragging() {
+		col.A = 60
+	}
+	line := image.Rect(sz.X/2-1, gtx.Dp(10), sz.X/2+1, sz.Y-gtx.Dp(10))
+	defer clip.UniformRRect(line, 1).Push(gtx.Ops).Pop()
+	paint.ColorOp{Color: col}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	return D{Size: sz}
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+
+	"gioui.org/unit"
+)
+
+const STATE_FILE = "state.json"
+
+// uiState is the layout of the window that is restored on the next launch.
+type uiState struct {
+	NotesWidth unit.Dp `json:"notesWidth"`
+	// Notes open in the editor
+	Tabs      []tabState `json:"tabs"`
+	ActiveTab int        `json:"activeTab"`
+}
+
+func (a *App) loadState() error {
+	a.state = uiState{NotesWidth: 230}
+	data, err := os.ReadFile(DATA_DIR + "/" + STATE_FILE)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &a.state)
+}
+
+func (a *App) saveState() error {
+	data, err := json.MarshalIndent(a.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(DATA_DIR, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(DATA_DIR+"/"+STATE_FILE, data, 0600)
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package store
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether the process pid runs, and whether that can
+// be told.
+func processAlive(pid int) (alive, known bool) {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM), true
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// ERROR_INVALID_PARAMETER is what opening a process which doesn't exist
+// fails with.
+const ERROR_INVALID_PARAMETER = syscall.Errno(87)
+
+// processAlive reports whether the process pid runs, and whether that can
+// be told.
+func processAlive(pid int) (alive, known bool) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		// Processes which can't be opened otherwise still run
+		return !errors.Is(err, ERROR_INVALID_PARAMETER), true
+	}
+	p.Release()
+	return true, true
+}
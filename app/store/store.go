@@ -0,0 +1,558 @@
+// Package store keeps notes on disk. The GUI and the command line share it,
+// so both read and write the same encrypted files.
+package store
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	SECRET_FILE     = "secret"
+	NOTES_FILE      = "notes.bin"
+	LOCK_FILE       = "notes.lock"
+	DATA_DIR        = "data"
+	SETTINGS_FILE   = "settings.json"
+	ATTACHMENTS_DIR = "attachments"
+)
+
+// Record is how a note is stored in the notes file.
+type Record struct {
+	ID       string    `json:"id,omitempty"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	Journal  string    `json:"journal,omitempty"`
+	Folder   string    `json:"folder,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	Pinned   bool      `json:"pinned,omitempty"`
+	Modified time.Time `json:"modified,omitempty"`
+}
+
+// Writers wait LOCK_TIMEOUT at most for the lock, and take over locks left
+// by processes which are gone. Those of other hosts, which can't be checked,
+// are taken over once older than LOCK_STALE.
+const (
+	LOCK_TIMEOUT = 5 * time.Second
+	LOCK_STALE   = 30 * time.Second
+)
+
+var ErrLocked = errors.New("the notes are locked by another process")
+
+// Store is a data directory: the notes file, the secret they are encrypted
+// with and the attachments.
+type Store struct {
+	Dir    string
+	secret string
+	// Notes file as of the last load or write
+	stamp stamp
+}
+
+// stamp identifies a version of the notes file.
+type stamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func NewID() string {
+	b := make([]byte, 8)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// DataDir returns the data directory set in the settings, the notes can be
+// kept out of DATA_DIR.
+func DataDir() string {
+	if dir := readSettings().DataDir; dir != "" {
+		return dir
+	}
+	return DATA_DIR
+}
+
+// SyncDir returns the folder the settings sync the notes with, if any.
+func SyncDir() string {
+	return readSettings().SyncDir
+}
+
+// readSettings reads the settings shared with the command line.
+func readSettings() (s struct {
+	DataDir string `json:"dataDir"`
+	SyncDir string `json:"syncDir"`
+}) {
+	if data, err := os.ReadFile(filepath.Join(DATA_DIR, SETTINGS_FILE)); err == nil {
+		json.Unmarshal(data, &s)
+	}
+	return s
+}
+
+var ErrSecret = errors.New("the secret of the notes is empty")
+
+// Open opens the data directory dir, creating its secret if it has none.
+func Open(dir string) (*Store, error) {
+	s := &Store{Dir: dir}
+	secretPath := filepath.Join(dir, SECRET_FILE)
+	data, err := os.ReadFile(secretPath)
+	if os.IsNotExist(err) {
+		// Another process opening dir meanwhile may create the secret too,
+		// the first one linked wins
+		if err = createSecret(secretPath, genSecret(32)); err == nil || os.IsExist(err) {
+			data, err = os.ReadFile(secretPath)
+		}
+	}
+	if err != nil {
+		return s, err
+	}
+	if len(data) == 0 {
+		return s, fmt.Errorf("%s: %w", secretPath, ErrSecret)
+	}
+	s.secret = string(data)
+	return s, nil
+}
+
+// createSecret writes secret to a temporary file and links it to path, so
+// that the secret is never seen empty. It fails if path exists.
+func createSecret(path, secret string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), SECRET_FILE+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(secret); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Link(f.Name(), path)
+}
+
+// Secret returns the secret, to bring it along when moving the notes.
+func (s *Store) Secret() string {
+	return s.secret
+}
+
+// Exists reports whether dir has notes.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, NOTES_FILE))
+	return err == nil
+}
+
+// Load loads the notes, there are none if the notes file doesn't exist.
+// Notes missing an ID get one.
+func (s *Store) Load() ([]Record, error) {
+	s.stamp = s.current()
+	data, err := os.ReadFile(filepath.Join(s.Dir, NOTES_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data = s.Crypt(data) // Decrypt notes
+	var records []Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		// Notes used to be saved as a map of index to a title/content pair
+		v := map[int]map[string]string{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(v); i++ {
+			for title, content := range v[i] {
+				records = append(records, Record{Title: title, Content: content})
+				break
+			}
+		}
+	}
+	for i := range records {
+		if records[i].ID == "" {
+			records[i].ID = NewID()
+		}
+	}
+	return records, nil
+}
+
+// Marshal returns the notes file content of records, before encryption.
+func Marshal(records []Record) ([]byte, error) {
+	return json.Marshal(records)
+}
+
+// Save saves records.
+func (s *Store) Save(records []Record) error {
+	data, err := Marshal(records)
+	if err != nil {
+		return err
+	}
+	return s.Write(data)
+}
+
+// Write encrypts and writes data, the marshaled notes, to the notes file.
+// The file is replaced at once, so readers never see half of it.
+func (s *Store) Write(data []byte) error {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(s.Dir, NOTES_FILE), s.Crypt(data)); err != nil { // Encrypt notes
+		return err
+	}
+	s.stamp = s.current()
+	return nil
+}
+
+// current returns the stamp of the notes file.
+func (s *Store) current() stamp {
+	info, err := os.Stat(filepath.Join(s.Dir, NOTES_FILE))
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{info.Size(), info.ModTime()}
+}
+
+// Changed reports whether another process wrote the notes file since they
+// were last loaded or written.
+func (s *Store) Changed() bool {
+	return s.current() != s.stamp
+}
+
+// Lock locks the notes file against other processes, and returns the
+// function unlocking it. Every read, change and write of the notes by
+// several processes should happen while they are locked.
+func (s *Store) Lock() (func(), error) {
+	return s.lockFile(LOCK_FILE, LOCK_TIMEOUT)
+}
+
+// TryLock is Lock without waiting, it returns ErrLocked right away if another
+// process has the notes locked.
+func (s *Store) TryLock() (func(), error) {
+	return s.lockFile(LOCK_FILE, 0)
+}
+
+// LockFile locks against other processes with the lock file name of the data
+// directory, and returns the function unlocking it.
+func (s *Store) LockFile(name string) (func(), error) {
+	return s.lockFile(name, LOCK_TIMEOUT)
+}
+
+func (s *Store) lockFile(name string, timeout time.Duration) (func(), error) {
+	if err := os.MkdirAll(s.Dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(s.Dir, name)
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			// The owner, for others to tell whether it is still there
+			_, err = f.WriteString(lockOwner())
+			if err = errors.Join(err, f.Close()); err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if owner, stale := isStale(path); stale {
+			// Unless another process took it over meanwhile
+			if data, err := os.ReadFile(path); err == nil && string(data) == owner {
+				os.Remove(path)
+			}
+			continue
+		}
+		if !time.Now().Before(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// lockOwner returns what lock files hold: the process id and host name of
+// their owner.
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%d %s\n", os.Getpid(), host)
+}
+
+// isStale reports whether the owner of the lock file path is gone, and
+// returns what the file holds.
+func isStale(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	var pid int
+	var host string
+	if _, err := fmt.Sscan(string(data), &pid, &host); err == nil && pid > 0 {
+		if h, _ := os.Hostname(); h == host {
+			if alive, known := processAlive(pid); known {
+				return string(data), !alive
+			}
+		}
+	}
+	// Locks of other hosts, or being written
+	return string(data), time.Since(info.ModTime()) > LOCK_STALE
+}
+
+// Update locks the notes, loads them, saves what f changes them to and
+// returns it.
+func (s *Store) Update(f func(records []Record) ([]Record, error)) ([]Record, error) {
+	unlock, err := s.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	records, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	if records, err = f(records); err != nil {
+		return nil, err
+	}
+	return records, s.Save(records)
+}
+
+// Matches reports whether r matches the lowercase search query. Like in the
+// notes list, #tag matches tags and /folder folders, other queries match
+// titles and contents.
+func (r Record) Matches(query string) bool {
+	switch {
+	case query == "":
+		return true
+	case strings.HasPrefix(query, "#"):
+		return slices.ContainsFunc(r.Tags, func(t string) bool { return strings.HasPrefix(strings.ToLower(t), query[1:]) })
+	case strings.HasPrefix(query, "/"):
+		return strings.HasPrefix(strings.ToLower(r.Folder), query[1:])
+	}
+	return strings.Contains(strings.ToLower(r.Title), query) || strings.Contains(strings.ToLower(r.Content), query)
+}
+
+// CAPTURE_INBOX is the title of the note captured text is added to.
+const CAPTURE_INBOX = "Inbox"
+
+// CAPTURE_TITLE_LEN is the length of the title of new captured notes.
+const CAPTURE_TITLE_LEN = 60
+
+// Capture adds text under the time to the note titled inbox, creating it if
+// there is none. With an empty inbox, text becomes a new note titled after
+// its first line. It returns the note.
+func (s *Store) Capture(text, inbox string) (Record, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Record{}, errors.New("there is nothing to capture")
+	}
+	var captured Record
+	_, err := s.Update(func(records []Record) ([]Record, error) {
+		now := time.Now()
+		if inbox == "" {
+			title, _, _ := strings.Cut(text, "\n")
+			title = strings.TrimSpace(strings.TrimLeft(title, "# "))
+			if runes := []rune(title); len(runes) > CAPTURE_TITLE_LEN {
+				title = string(runes[:CAPTURE_TITLE_LEN-1]) + "…"
+			}
+			captured = Record{ID: NewID(), Title: title, Content: text, Modified: now}
+			return append(records, captured), nil
+		}
+		entry := "### " + now.Format("2006-01-02 15:04") + "\n" + text + "\n"
+		for i, r := range records {
+			if r.Journal == "" && strings.EqualFold(strings.TrimSpace(r.Title), inbox) {
+				if content := strings.TrimRight(r.Content, "\n"); content != "" {
+					entry = content + "\n\n" + entry
+				}
+				records[i].Content, records[i].Modified = entry, now
+				captured = records[i]
+				return records, nil
+			}
+		}
+		captured = Record{ID: NewID(), Title: inbox, Content: entry, Modified: now}
+		return append(records, captured), nil
+	})
+	return captured, err
+}
+
+// Merge merges the notes changed by two processes since base: mine, and
+// theirs written meanwhile. Notes changed by only one of them keep its
+// change, notes changed by both keep the last one. Deleting a note wins over
+// leaving it unchanged. Notes keep the order of mine, the ones only theirs
+// has follow.
+func Merge(base, mine, theirs []Record) []Record {
+	index := func(records []Record) map[string]Record {
+		m := make(map[string]Record, len(records))
+		for _, r := range records {
+			m[r.ID] = r
+		}
+		return m
+	}
+	baseByID, mineByID, theirsByID := index(base), index(mine), index(theirs)
+	var merged []Record
+	for _, r := range mine {
+		b, inBase := baseByID[r.ID]
+		t, inTheirs := theirsByID[r.ID]
+		switch {
+		case !inTheirs:
+			// New in mine, or deleted by them unless changed in mine
+			if !inBase || !r.Equal(b) {
+				merged = append(merged, r)
+			}
+		case inBase && r.Equal(b):
+			merged = append(merged, t)
+		case inBase && t.Equal(b) || !t.Modified.After(r.Modified):
+			merged = append(merged, r)
+		default:
+			merged = append(merged, t)
+		}
+	}
+	for _, t := range theirs {
+		if _, ok := mineByID[t.ID]; ok {
+			continue
+		}
+		// New in theirs, or deleted in mine unless changed in theirs
+		if b, inBase := baseByID[t.ID]; !inBase || !t.Equal(b) {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+// Equal reports whether r and o are the same version of a note.
+func (r Record) Equal(o Record) bool {
+	return r.ID == o.ID && r.Title == o.Title && r.Content == o.Content && r.Journal == o.Journal &&
+		r.Folder == o.Folder && slices.Equal(r.Tags, o.Tags) && r.Pinned == o.Pinned && r.Modified.Equal(o.Modified)
+}
+
+// writeFile writes data to a temporary file it then renames to path.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Crypt encrypts or decrypts input with the secret.
+func (s *Store) Crypt(input []byte) []byte {
+	output := make([]byte, len(input))
+	for i := range input {
+		output[i] = input[i] ^ s.secret[i%len(s.secret)]
+	}
+	return output
+}
+
+var attachmentExtRe = regexp.MustCompile(`^\.[a-z0-9]+$`)
+
+// AttachmentRefRe matches the references to attachments in note contents,
+// ![name](attachment:id) for images and [name](attachment:id) for other
+// files. The id is the third submatch.
+var AttachmentRefRe = regexp.MustCompile(`(!?)\[([^\]\n]*)\]\(attachment:([0-9a-f]+(?:\.[A-Za-z0-9]+)?)\)`)
+
+// AttachmentIDRe matches the ids of attachments.
+var AttachmentIDRe = regexp.MustCompile(`^[0-9a-f]+(?:\.[a-z0-9]+)?$`)
+
+// ReadAttachment returns the decrypted attachment id.
+func (s *Store) ReadAttachment(id string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.Dir, ATTACHMENTS_DIR, filepath.Base(id)))
+	if err != nil {
+		return nil, err
+	}
+	return s.Crypt(data), nil
+}
+
+// AddAttachment stores data, the content of the file name, as a new
+// attachment and returns its id.
+func (s *Store) AddAttachment(name string, data []byte) (string, error) {
+	id, err := AttachmentID(filepath.Ext(name))
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(s.Dir, ATTACHMENTS_DIR)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	return id, os.WriteFile(filepath.Join(dir, id), s.Crypt(data), 0600)
+}
+
+// Attachments returns the ids of the attachments.
+func (s *Store) Attachments() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, ATTACHMENTS_DIR))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && AttachmentIDRe.MatchString(e.Name()) {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// WriteAttachment stores data as the attachment id, unless there is one
+// already.
+func (s *Store) WriteAttachment(id string, data []byte) error {
+	if !AttachmentIDRe.MatchString(id) {
+		return errors.New("invalid attachment id: " + id)
+	}
+	dir := filepath.Join(s.Dir, ATTACHMENTS_DIR)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(s.Crypt(data))
+	return errors.Join(err, f.Close())
+}
+
+// AttachmentID returns a new attachment id for a file with the extension
+// ext.
+func AttachmentID(ext string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	// Only keep extensions that are safe to use inside a reference
+	ext = strings.ToLower(ext)
+	if !attachmentExtRe.MatchString(ext) {
+		ext = ""
+	}
+	return hex.EncodeToString(b) + ext, nil
+}
+
+func genSecret(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	r := rand.New(rand.NewSource(time.Now().UnixNano() ^ int64(os.Getpid())))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[r.Intn(len(letters))]
+	}
+	return string(b)
+}
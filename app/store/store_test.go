@@ -0,0 +1,164 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// holdLock writes a lock file as if the process pid held it since at.
+func holdLock(t *testing.T, s *Store, pid int, at time.Time) {
+	t.Helper()
+	host, _ := os.Hostname()
+	path := filepath.Join(s.Dir, LOCK_FILE)
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d %s\n", pid, host)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockOfLiveProcess(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Held for long, by a process which still runs
+	holdLock(t, s, os.Getpid(), time.Now().Add(-time.Hour))
+	start := time.Now()
+	if _, err := s.TryLock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, want %v", err, ErrLocked)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("TryLock waited %v", d)
+	}
+}
+
+func TestLockOfDeadProcess(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	holdLock(t, s, cmd.Process.Pid, time.Now())
+	unlock, err := s.TryLock()
+	if err != nil {
+		t.Fatalf("got %v, want the lock taken over", err)
+	}
+	if _, err := s.TryLock(); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v, want the lock held", err)
+	}
+	unlock()
+	if _, err := os.Stat(filepath.Join(s.Dir, LOCK_FILE)); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the lock file removed", err)
+	}
+}
+
+func TestLockOfUnknownOwner(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without an owner, or of another host, only old locks are stale
+	path := filepath.Join(s.Dir, LOCK_FILE)
+	os.WriteFile(path, []byte("1 some-other-host\n"), 0600)
+	if _, err := s.TryLock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, want %v", err, ErrLocked)
+	}
+	old := time.Now().Add(-2 * LOCK_STALE)
+	os.Chtimes(path, old, old)
+	if _, err := s.TryLock(); err != nil {
+		t.Errorf("got %v, want the lock taken over", err)
+	}
+}
+
+func TestLoadOldFormat(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Notes of versions before journal notes, a map of index to a
+	// title/content pair
+	old := `{"0":{"Groceries":"milk"},"1":{"Ideas":""}}`
+	if err := os.WriteFile(filepath.Join(s.Dir, NOTES_FILE), s.Crypt([]byte(old)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Title != "Groceries" || records[0].Content != "milk" || records[1].Title != "Ideas" {
+		t.Fatalf("got %+v, want both notes in order", records)
+	}
+
+	// Saved again in the current format, with the journal day kept
+	records[1].Journal = "2024-05-01"
+	if err := s.Save(records); err != nil {
+		t.Fatal(err)
+	}
+	records, err = s.Load()
+	if err != nil || len(records) != 2 || records[1].Journal != "2024-05-01" {
+		t.Errorf("got %+v, %v, want the journal day kept", records, err)
+	}
+}
+
+func TestOpenBadSecret(t *testing.T) {
+	dir := t.TempDir()
+	// Left by a process which died while creating the secret
+	if err := os.WriteFile(filepath.Join(dir, SECRET_FILE), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := Open(dir)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrSecret) {
+			t.Errorf("got %v, want %v", err, ErrSecret)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Open doesn't return")
+	}
+
+	// A secret which can't be read
+	dir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, SECRET_FILE), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); err == nil {
+		t.Error("got no error for a secret which can't be read")
+	}
+}
+
+func TestOpenConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	stores := make(chan *Store)
+	for i := 0; i < 8; i++ {
+		go func() {
+			s, err := Open(dir)
+			if err != nil {
+				t.Error(err)
+			}
+			stores <- s
+		}()
+	}
+	secret := (<-stores).Secret()
+	for i := 1; i < 8; i++ {
+		if s := <-stores; s.Secret() != secret {
+			t.Error("the stores got different secrets")
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("got %d files, want only the secret", len(entries))
+	}
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/notesync"
+)
+
+// syncNotes syncs the notes with the sync folder of the settings. The
+// passphrase is asked for once per run of the app.
+func (a *App) syncNotes() {
+	if a.settings.SyncDir == "" {
+		a.toasts.show(SEVERITY_WARNING, "Set a sync folder in the settings first")
+		return
+	}
+	if a.syncPass != "" {
+		a.syncWith(a.syncPass)
+		return
+	}
+	a.dialog.ask("Sync", "Sync the notes with "+a.settings.SyncDir+", encrypted with the passphrase every device syncing there uses:",
+		"Passphrase", "", true, func(pass string) {
+			if pass != "" {
+				a.syncWith(pass)
+			}
+		})
+}
+
+// syncWith saves the notes and syncs them in the background, the shared
+// folder may be slow. The changes of the other devices are then merged like
+// those of any other process.
+func (a *App) syncWith(pass string) {
+	if a.isSyncing {
+		return
+	}
+	if err := a.save(); err != nil {
+		a.toasts.showError("Couldn't save the notes", err)
+		return
+	}
+	a.isSyncing = true
+	dir, folder := a.settings.DataDir, a.settings.SyncDir
+	go func() {
+		// A store of its own, this one belongs to the UI
+		st, err := store.Open(dir)
+		var res notesync.Result
+		if err == nil {
+			res, err = notesync.Sync(st, folder, pass)
+		}
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.isSyncing = false
+		if errors.Is(err, notesync.ErrPassphrase) {
+			a.syncPass = ""
+		}
+		if err != nil {
+			a.toasts.showError("Couldn't sync", err)
+		} else if err := a.saveSoon(); err != nil {
+			a.toasts.showError("Couldn't load the synced notes", err)
+		} else {
+			a.syncPass = pass
+			a.toasts.show(SEVERITY_SUCCESS, fmt.Sprintf("Synced: %s sent, %s received, %s deleted",
+				plural(res.Sent, "change"), plural(res.Received, "note"), plural(res.Deleted, "note")))
+		}
+		a.invalidateWindows()
+	}()
+}
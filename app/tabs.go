@@ -0,0 +1,286 @@
+package app
+
+import (
+	"image"
+	"slices"
+
+	"gioui.org/font"
+	"gioui.org/io/event"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+// noteTab is a note open in the editor. Every tab has editors of its own so
+// the caret, scroll position and undo history survive switching tabs.
+type noteTab struct {
+	id          string // ID of the note
+	titleEditor widget.Editor
+	noteEditor  widget.Editor
+	closeBtn    widget.Clickable
+	// Reordering by dragging
+	grabX float32
+	width int // As of the last frame
+}
+
+// tabState is an open tab as kept in STATE_FILE.
+type tabState struct {
+	ID    string `json:"id"`
+	Caret int    `json:"caret"`
+}
+
+func newNoteTab(n *note) *noteTab {
+	t := &noteTab{id: n.id}
+	t.titleEditor.SetText(n.title)
+	t.noteEditor.SetText(n.content)
+	return t
+}
+
+// tab returns the active tab, or an empty one when no note is open.
+func (e *editorPane) tab() *noteTab {
+	if e.active < 0 || e.active >= len(e.tabs) {
+		return &e.noTab
+	}
+	return e.tabs[e.active]
+}
+
+// current returns the index of the note of the active tab, -1 if none.
+func (e *editorPane) current() int {
+	if e.active < 0 || e.active >= len(e.tabs) {
+		return -1
+	}
+	return e.noteIndex(e.tabs[e.active].id)
+}
+
+func (e *editorPane) noteIndex(id string) int {
+	return slices.IndexFunc(*e.notes, func(n note) bool { return n.id == id })
+}
+
+func (e *editorPane) tabIndex(id string) int {
+	return slices.IndexFunc(e.tabs, func(t *noteTab) bool { return t.id == id })
+}
+
+// open shows note i in the active tab, or switches to the tab already
+// showing it.
+func (e *editorPane) open(i int) {
+	n := &(*e.notes)[i]
+	if k := e.tabIndex(n.id); k >= 0 {
+		e.activate(k)
+		return
+	}
+	if len(e.tabs) == 0 {
+		e.openTab(i)
+		return
+	}
+	e.tabs[e.active] = newNoteTab(n)
+	e.activate(e.active)
+}
+
+// openTab shows note i in a new tab next to the active one, or switches to
+// the tab already showing it.
+func (e *editorPane) openTab(i int) {
+	n := &(*e.notes)[i]
+	if k := e.tabIndex(n.id); k >= 0 {
+		e.activate(k)
+		return
+	}
+	k := min(e.active+1, len(e.tabs))
+	e.tabs = slices.Insert(e.tabs, k, newNoteTab(n))
+	e.activate(k)
+}
+
+func (e *editorPane) activate(k int) {
+	e.active = k
+	*e.isEditorOpen = len(e.tabs) > 0
+	if e.onActivate != nil {
+		e.onActivate(e.current())
+	}
+}
+
+func (e *editorPane) closeTab(k int) {
+	if k < 0 || k >= len(e.tabs) {
+		return
+	}
+	e.tabs = slices.Delete(e.tabs, k, k+1)
+	if e.active > k || e.active == len(e.tabs) {
+		e.active--
+	}
+	e.activate(max(e.active, 0))
+}
+
+func (e *editorPane) closeAll() {
+	e.tabs = nil
+	e.activate(0)
+}
+
+// cycleTab switches to the tab dir places away, wrapping around.
+func (e *editorPane) cycleTab(dir int) {
+	if len(e.tabs) == 0 {
+		return
+	}
+	e.activate(((e.active+dir)%len(e.tabs) + len(e.tabs)) % len(e.tabs))
+}
+
+// refresh reloads the tabs of the changed notes.
+func (e *editorPane) refresh(changed []int) {
+	for _, t := range e.tabs {
+		i := e.noteIndex(t.id)
+		if i >= 0 && slices.Contains(changed, i) {
+			t.titleEditor.SetText((*e.notes)[i].title)
+			t.noteEditor.SetText((*e.notes)[i].content)
+		}
+	}
+}
+
+// tabStates returns the open tabs and the index of the active one to save
+// them.
+func (e *editorPane) tabStates() ([]tabState, int) {
+	var states []tabState
+	for _, t := range e.tabs {
+		caret, _ := t.noteEditor.Selection()
+		states = append(states, tabState{ID: t.id, Caret: caret})
+	}
+	return states, e.active
+}
+
+// restoreTabs opens the saved tabs whose notes still exist.
+func (e *editorPane) restoreTabs(states []tabState, active int) {
+	e.tabs = nil
+	for k, s := range states {
+		i := e.noteIndex(s.ID)
+		if i < 0 || e.tabIndex(s.ID) >= 0 {
+			if k < active {
+				active--
+			}
+			continue
+		}
+		t := newNoteTab(&(*e.notes)[i])
+		t.noteEditor.SetCaret(s.Caret, s.Caret)
+		e.tabs = append(e.tabs, t)
+	}
+	if len(e.tabs) > 0 {
+		e.activate(max(min(active, len(e.tabs)-1), 0))
+	}
+}
+
+// updateTabs handles clicks and drags on the tabs. A click switches tabs,
+// a middle click closes them and dragging reorders them.
+func (e *editorPane) updateTabs(gtx C) {
+	closeAt := -1
+	for k := 0; k < len(e.tabs); k++ {
+		t := e.tabs[k]
+		if t.closeBtn.Clicked(gtx) {
+			closeAt = k
+		}
+		moved := false
+		for {
+			ev, ok := gtx.Event(pointer.Filter{
+				Target: t,
+				Kinds:  pointer.Press | pointer.Drag | pointer.Release | pointer.Cancel,
+			})
+			if !ok {
+				break
+			}
+			x, ok := ev.(pointer.Event)
+			if !ok {
+				continue
+			}
+			switch x.Kind {
+			case pointer.Press:
+				if x.Buttons == pointer.ButtonTertiary {
+					closeAt = e.tabIndex(t.id)
+					continue
+				}
+				e.activate(e.tabIndex(t.id))
+				t.grabX = x.Position.X
+			case pointer.Drag:
+				if moved || x.Buttons != pointer.ButtonPrimary {
+					continue
+				}
+				// Swap with a neighbor once the tab was dragged past half
+				// of it, only once a frame since positions are relative to
+				// the tab as it was laid out
+				pos := e.tabIndex(t.id)
+				dx := x.Position.X - t.grabX
+				if pos+1 < len(e.tabs) && dx > float32(e.tabs[pos+1].width)/2 {
+					e.tabs[pos], e.tabs[pos+1] = e.tabs[pos+1], e.tabs[pos]
+					moved = true
+				} else if pos > 0 && -dx > float32(e.tabs[pos-1].width)/2 {
+					e.tabs[pos], e.tabs[pos-1] = e.tabs[pos-1], e.tabs[pos]
+					moved = true
+				}
+				if moved {
+					e.active = e.tabIndex(t.id)
+					gtx.Execute(op.InvalidateCmd{})
+				}
+			}
+		}
+	}
+	if closeAt >= 0 {
+		e.closeTab(closeAt)
+		gtx.Execute(op.InvalidateCmd{})
+	}
+}
+
+func (e *editorPane) layoutTabs(gtx C) D {
+	e.updateTabs(gtx)
+	return e.tabsListW.Layout(gtx, len(e.tabs), func(gtx C, k int) D {
+		t := e.tabs[k]
+		isActive := k == e.active
+		macro := op.Record(gtx.Ops)
+		dims := layout.Background{}.Layout(gtx,
+			func(gtx C) D {
+				sz := gtx.Constraints.Min
+				defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+				c := pal.Hover
+				if isActive {
+					c = pal.Selected
+				}
+				paint.ColorOp{Color: c}.Add(gtx.Ops)
+				paint.PaintOp{}.Add(gtx.Ops)
+				return layout.Dimensions{Size: sz}
+			},
+			func(gtx C) D {
+				return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4), Left: unit.Dp(8), Right: unit.Dp(4)}.Layout(gtx,
+					func(gtx C) D {
+						return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+							layout.Rigid(func(gtx C) D {
+								gtx.Constraints.Max.X = min(gtx.Constraints.Max.X, gtx.Dp(160))
+								title := t.titleEditor.Text()
+								if title == "" {
+									title = "Untitled"
+								}
+								lbl := material.Label(e.th, unit.Sp(13), title)
+								lbl.MaxLines = 1
+								if isActive {
+									lbl.Font.Weight = font.Bold
+								}
+								return lbl.Layout(gtx)
+							}),
+							layout.Rigid(layout.Spacer{Width: unit.Dp(4)}.Layout),
+							layout.Rigid(func(gtx C) D {
+								return material.Clickable(gtx, &t.closeBtn, func(gtx C) D {
+									return layout.UniformInset(unit.Dp(2)).Layout(gtx, material.Label(e.th, unit.Sp(13), "×").Layout)
+								})
+							}),
+						)
+					})
+			},
+		)
+		call := macro.Stop()
+		t.width = dims.Size.X
+		// The tab area is below its close button so both get presses
+		area := clip.Rect{Max: dims.Size}.Push(gtx.Ops)
+		event.Op(gtx.Ops, t)
+		call.Add(gtx.Ops)
+		area.Pop()
+		return layout.Inset{Right: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+			return D{Size: dims.Size}
+		})
+	})
+}
@@ -0,0 +1,267 @@
+package app
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"strings"
+	"time"
+
+	"gioui.org/font"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+const TEMPLATES_FILE = "templates.bin"
+
+type noteTemplate struct {
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// Journal marks the template used for daily notes
+	Journal bool `json:"journal,omitempty"`
+}
+
+var defaultTemplates = []noteTemplate{
+	{
+		Name:    "Meeting notes",
+		Title:   "Meeting {{date}}",
+		Content: "# {{title}}\n\nDate: {{date}} {{time}}\nAttendees:\n\n## Agenda\n\n## Notes\n\n## Action items\n- [ ] ",
+	},
+	{
+		Name:    "Incident report",
+		Title:   "Incident {{date}} {{time}}",
+		Content: "# {{title}}\n\nDetected: {{date}} {{time}}\nSeverity:\nAffected systems:\n\n## Timeline\n\n## Root cause\n\n## Follow-ups\n- [ ] ",
+	},
+	{
+		Name:    "Daily log",
+		Title:   "{{date}}",
+		Content: "# {{title}}\n\n## Done\n\n## Doing\n\n## Blocked\n",
+		Journal: true,
+	},
+}
+
+// expandTemplate creates a note from t, filling in the placeholders.
+// {{title}} refers to the expanded title of the note.
+func expandTemplate(t noteTemplate, now time.Time) note {
+	r := strings.NewReplacer(
+		"{{date}}", now.Format("2006-01-02"),
+		"{{time}}", now.Format("15:04"),
+	)
+	title := r.Replace(t.Title)
+	if title == "" {
+		title = "Untitled"
+	}
+	content := strings.ReplaceAll(r.Replace(t.Content), "{{title}}", title)
+	return note{title: title, content: content}
+}
+
+func (a *App) loadTemplates() error {
+	data, err := os.ReadFile(a.settings.DataDir + "/" + TEMPLATES_FILE)
+	if err != nil {
+		if os.IsNotExist(err) {
+			a.templates = append([]noteTemplate(nil), defaultTemplates...)
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(a.xorEncryptDecrypt(data), &a.templates) // Decrypt templates
+}
+
+func (a *App) saveTemplates() error {
+	data, err := json.Marshal(a.templates)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(a.settings.DataDir, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(a.settings.DataDir+"/"+TEMPLATES_FILE, a.xorEncryptDecrypt(data), 0600) // Encrypt templates
+}
+
+// templatesDialog lets users add, edit and remove templates.
+type templatesDialog struct {
+	// Widgets
+	th            *material.Theme
+	listW         widget.List
+	items         []widget.Clickable
+	nameEditor    widget.Editor
+	titleEditor   widget.Editor
+	contentEditor widget.Editor
+	journalCheck  widget.Bool
+	newBtn        button
+	deleteBtn     button
+	closeBtn      button
+	backdropTag   int
+	// States
+	isOpen   bool
+	selected int
+	// States refs
+	templates *[]noteTemplate
+	// Callbacks
+	onClose func()
+}
+
+func newTemplatesDialog(th *material.Theme, templates *[]noteTemplate, onClose func()) templatesDialog {
+	return templatesDialog{
+		th:          th,
+		templates:   templates,
+		onClose:     onClose,
+		listW:       widget.List{List: layout.List{Axis: layout.Vertical}},
+		nameEditor:  widget.Editor{SingleLine: true},
+		titleEditor: widget.Editor{SingleLine: true},
+		newBtn:      button{th: th, label: "New"},
+		deleteBtn:   button{th: th, label: "Delete"},
+		closeBtn:    button{th: th, label: "Close"},
+	}
+}
+
+func (td *templatesDialog) open() {
+	td.isOpen = true
+	td.selectTemplate(0)
+}
+
+func (td *templatesDialog) close() {
+	td.isOpen = false
+	if td.onClose != nil {
+		td.onClose()
+	}
+}
+
+// selectTemplate loads the template at index i into the editors.
+func (td *templatesDialog) selectTemplate(i int) {
+	td.selected = -1
+	td.nameEditor.SetText("")
+	td.titleEditor.SetText("")
+	td.contentEditor.SetText("")
+	if i < 0 || i >= len(*td.templates) {
+		return
+	}
+	td.selected = i
+	t := (*td.templates)[i]
+	td.nameEditor.SetText(t.Name)
+	td.titleEditor.SetText(t.Title)
+	td.contentEditor.SetText(t.Content)
+	td.journalCheck.Value = t.Journal
+}
+
+func (td *templatesDialog) layout(gtx C) D {
+	// Handle keys and clicks outside the box
+	for {
+		ev, ok := gtx.Event(
+			key.Filter{Name: key.NameEscape},
+			pointer.Filter{Target: &td.backdropTag, Kinds: pointer.Press},
+		)
+		if !ok {
+			break
+		}
+		if e, ok := ev.(key.Event); ok && e.State != key.Press {
+			continue
+		}
+		td.close()
+		gtx.Execute(op.InvalidateCmd{})
+	}
+	// Apply edits to the selected template
+	if td.selected >= 0 && td.selected < len(*td.templates) {
+		t := &(*td.templates)[td.selected]
+		t.Name, t.Title, t.Content = td.nameEditor.Text(), td.titleEditor.Text(), td.contentEditor.Text()
+		// Only one template can be used for daily notes
+		if td.journalCheck.Value && !t.Journal {
+			for i := range *td.templates {
+				(*td.templates)[i].Journal = false
+			}
+		}
+		(*td.templates)[td.selected].Journal = td.journalCheck.Value
+	}
+	td.newBtn.onClick = func() {
+		*td.templates = append(*td.templates, noteTemplate{Name: "New template", Title: "{{date}}"})
+		td.selectTemplate(len(*td.templates) - 1)
+	}
+	td.deleteBtn.onClick = func() {
+		*td.templates = append((*td.templates)[:td.selected], (*td.templates)[td.selected+1:]...)
+		td.selectTemplate(min(td.selected, len(*td.templates)-1))
+	}
+	td.closeBtn.onClick = td.close
+	td.deleteBtn.isDisabled = td.selected < 0
+	if len(td.items) < len(*td.templates) {
+		td.items = make([]widget.Clickable, len(*td.templates))
+	}
+	return layoutModal(gtx, &td.backdropTag, 700, 480, td.layoutContent)
+}
+
+func (td *templatesDialog) layoutContent(gtx C) D {
+	vspacer := layout.Rigid(layout.Spacer{Height: unit.Dp(7)}.Layout)
+	spacer := layout.Rigid(layout.Spacer{Width: unit.Dp(5)}.Layout)
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		// Title
+		layout.Rigid(func(gtx C) D {
+			lbl := material.Label(td.th, unit.Sp(16), "Templates")
+			lbl.Font.Weight = font.Medium
+			return lbl.Layout(gtx)
+		}),
+		vspacer,
+		layout.Flexed(0.5, func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				// Templates list
+				layout.Rigid(func(gtx C) D {
+					w := gtx.Dp(180)
+					gtx.Constraints.Min.X, gtx.Constraints.Max.X = w, w
+					return material.List(td.th, &td.listW).Layout(gtx, len(*td.templates), func(gtx C, i int) D {
+						if td.items[i].Clicked(gtx) {
+							td.selectTemplate(i)
+						}
+						return material.Clickable(gtx, &td.items[i], func(gtx C) D {
+							return layout.UniformInset(unit.Dp(5)).Layout(gtx, func(gtx C) D {
+								lbl := material.Label(td.th, unit.Sp(14), (*td.templates)[i].Name)
+								lbl.MaxLines = 1
+								if i == td.selected {
+									lbl.Font.Weight = font.Bold
+								}
+								return lbl.Layout(gtx)
+							})
+						})
+					})
+				}),
+				spacer,
+				// Selected template
+				layout.Flexed(1, func(gtx C) D {
+					if td.selected < 0 {
+						return material.Body2(td.th, "No template selected").Layout(gtx)
+					}
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Rigid(entry(td.th, &td.nameEditor, "Name")),
+						vspacer,
+						layout.Rigid(entry(td.th, &td.titleEditor, "Note title")),
+						vspacer,
+						layout.Flexed(1, entry(td.th, &td.contentEditor, "Note content")),
+						vspacer,
+						layout.Rigid(material.CheckBox(td.th, &td.journalCheck, "Use for daily notes").Layout),
+						layout.Rigid(func(gtx C) D {
+							lbl := material.Label(td.th, unit.Sp(12), "Placeholders: {{date}}, {{time}}, {{title}}")
+							lbl.Font.Style = font.Italic
+							return lbl.Layout(gtx)
+						}),
+					)
+				}),
+			)
+		}),
+		vspacer,
+		// Actions
+		layout.Rigid(func(gtx C) D {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+				layout.Rigid(td.newBtn.layout),
+				spacer,
+				layout.Rigid(td.deleteBtn.layout),
+				layout.Flexed(1, func(gtx C) D {
+					return D{Size: image.Pt(gtx.Constraints.Max.X, 0)}
+				}),
+				layout.Rigid(td.closeBtn.layout),
+			)
+		}),
+	)
+}
@@ -0,0 +1,257 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/deoxyimran/keeper/app/utils/highlight"
+
+	"gioui.org/widget/material"
+)
+
+const THEMES_DIR = "themes"
+
+// Theme names besides the ones of user theme files
+const (
+	THEME_SYSTEM = "System"
+	THEME_DARK   = "Dark"
+	THEME_LIGHT  = "Light"
+)
+
+// palette holds every color the app draws with.
+type palette struct {
+	Bg       color.NRGBA // Window background
+	Fg       color.NRGBA // Text and icons
+	Accent   color.NRGBA // Buttons, checkboxes, etc.
+	AccentFg color.NRGBA
+	Surface  color.NRGBA // Dialogs, prompts and menus
+	Well     color.NRGBA // Lists
+	Editor   color.NRGBA
+	CodeBg   color.NRGBA
+	Hover    color.NRGBA // Drawn over entries, tabs and hovered things
+	Selected color.NRGBA // Selected note and journal days
+	Hovered  color.NRGBA // Hovered note
+	Disabled color.NRGBA // Drawn over disabled buttons
+	Backdrop color.NRGBA // Behind dialogs
+	Info     color.NRGBA
+	Success  color.NRGBA
+	Warning  color.NRGBA
+	OnStatus color.NRGBA // Text on info, success, warning and error colors
+	Danger   color.NRGBA
+	Match    color.NRGBA // Find results
+	Current  color.NRGBA // Current find result
+	// Code highlighting
+	Keyword, Type, String, Number, Comment, Operator, Name color.NRGBA
+}
+
+var darkPalette = palette{
+	Bg:       color.NRGBA{40, 40, 43, 255},
+	Fg:       color.NRGBA{250, 249, 246, 255},
+	Accent:   color.NRGBA{63, 81, 181, 255},
+	AccentFg: color.NRGBA{255, 255, 255, 255},
+	Surface:  color.NRGBA{60, 60, 63, 255},
+	Well:     color.NRGBA{27, 27, 30, 255},
+	Editor:   color.NRGBA{23, 23, 26, 255},
+	CodeBg:   color.NRGBA{13, 13, 15, 255},
+	Hover:    color.NRGBA{255, 255, 255, 20},
+	Selected: color.NRGBA{B: 155, A: 155},
+	Hovered:  color.NRGBA{B: 155, A: 90},
+	Disabled: color.NRGBA{B: 200, A: 190},
+	Backdrop: color.NRGBA{A: 180},
+	Info:     color.NRGBA{110, 160, 240, 255},
+	Success:  color.NRGBA{70, 219, 88, 255},
+	Warning:  color.NRGBA{240, 190, 80, 255},
+	OnStatus: color.NRGBA{23, 27, 23, 255},
+	Danger:   color.NRGBA{240, 110, 110, 255},
+	Match:    color.NRGBA{R: 255, G: 200, A: 70},
+	Current:  color.NRGBA{R: 255, G: 140, A: 130},
+	Keyword:  color.NRGBA{198, 120, 221, 255},
+	Type:     color.NRGBA{86, 182, 194, 255},
+	String:   color.NRGBA{152, 195, 121, 255},
+	Number:   color.NRGBA{209, 154, 102, 255},
+	Comment:  color.NRGBA{127, 132, 142, 255},
+	Operator: color.NRGBA{171, 178, 191, 255},
+	Name:     color.NRGBA{97, 175, 239, 255},
+}
+
+var lightPalette = palette{
+	Bg:       color.NRGBA{238, 238, 240, 255},
+	Fg:       color.NRGBA{28, 28, 30, 255},
+	Accent:   color.NRGBA{63, 81, 181, 255},
+	AccentFg: color.NRGBA{255, 255, 255, 255},
+	Surface:  color.NRGBA{250, 250, 252, 255},
+	Well:     color.NRGBA{255, 255, 255, 255},
+	Editor:   color.NRGBA{255, 255, 255, 255},
+	CodeBg:   color.NRGBA{244, 244, 246, 255},
+	Hover:    color.NRGBA{0, 0, 0, 15},
+	Selected: color.NRGBA{63, 81, 181, 70},
+	Hovered:  color.NRGBA{63, 81, 181, 35},
+	Disabled: color.NRGBA{230, 230, 235, 190},
+	Backdrop: color.NRGBA{A: 110},
+	Info:     color.NRGBA{110, 160, 240, 255},
+	Success:  color.NRGBA{70, 200, 88, 255},
+	Warning:  color.NRGBA{240, 180, 60, 255},
+	OnStatus: color.NRGBA{23, 27, 23, 255},
+	Danger:   color.NRGBA{200, 40, 40, 255},
+	Match:    color.NRGBA{R: 255, G: 200, A: 110},
+	Current:  color.NRGBA{R: 255, G: 140, A: 170},
+	Keyword:  color.NRGBA{166, 38, 164, 255},
+	Type:     color.NRGBA{1, 132, 188, 255},
+	String:   color.NRGBA{80, 161, 79, 255},
+	Number:   color.NRGBA{152, 104, 1, 255},
+	Comment:  color.NRGBA{160, 161, 167, 255},
+	Operator: color.NRGBA{56, 58, 66, 255},
+	Name:     color.NRGBA{64, 120, 242, 255},
+}
+
+// pal is the palette of the current theme. Widgets read it while laying
+// out, so switching themes applies on the next frame.
+var pal = darkPalette
+
+// tokenColor returns the color of highlighted code of kind k.
+func (p *palette) tokenColor(k highlight.Kind) (color.NRGBA, bool) {
+	switch k {
+	case highlight.Keyword:
+		return p.Keyword, true
+	case highlight.Type:
+		return p.Type, true
+	case highlight.String:
+		return p.String, true
+	case highlight.Number:
+		return p.Number, true
+	case highlight.Comment:
+		return p.Comment, true
+	case highlight.Operator:
+		return p.Operator, true
+	case highlight.Name:
+		return p.Name, true
+	}
+	return color.NRGBA{}, false
+}
+
+// colors maps the names used in theme files to the colors of p.
+func (p *palette) colors() map[string]*color.NRGBA {
+	return map[string]*color.NRGBA{
+		"bg": &p.Bg, "fg": &p.Fg, "accent": &p.Accent, "accentFg": &p.AccentFg,
+		"surface": &p.Surface, "well": &p.Well, "editor": &p.Editor, "codeBg": &p.CodeBg,
+		"hover": &p.Hover, "selected": &p.Selected, "hovered": &p.Hovered,
+		"disabled": &p.Disabled, "backdrop": &p.Backdrop, "info": &p.Info, "success": &p.Success,
+		"warning": &p.Warning, "onStatus": &p.OnStatus, "danger": &p.Danger, "match": &p.Match, "current": &p.Current,
+		"keyword": &p.Keyword, "type": &p.Type, "string": &p.String, "number": &p.Number,
+		"comment": &p.Comment, "operator": &p.Operator, "name": &p.Name,
+	}
+}
+
+// themeFile is a user theme in DATA_DIR/THEMES_DIR. Colors missing from it
+// are taken from its base theme, e.g.
+//
+//	{"name": "Solarized", "base": "Light", "colors": {"bg": "#fdf6e3", "fg": "#657b83"}}
+type themeFile struct {
+	Name   string            `json:"name"`
+	Base   string            `json:"base"`
+	Colors map[string]string `json:"colors"`
+}
+
+// parseColor parses #rrggbb or #rrggbbaa.
+func parseColor(s string) (color.NRGBA, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) == 6 {
+		h += "ff"
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil || len(h) != 8 {
+		return color.NRGBA{}, fmt.Errorf("bad color %q", s)
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+func (t themeFile) palette() (palette, error) {
+	p := darkPalette
+	if strings.EqualFold(t.Base, THEME_LIGHT) {
+		p = lightPalette
+	}
+	fields := p.colors()
+	for name, s := range t.Colors {
+		f, ok := fields[name]
+		if !ok {
+			return p, fmt.Errorf("unknown color %q", name)
+		}
+		c, err := parseColor(s)
+		if err != nil {
+			return p, err
+		}
+		*f = c
+	}
+	return p, nil
+}
+
+// loadThemes returns the user themes by name. Broken theme files are
+// skipped.
+func loadThemes(dir string) map[string]palette {
+	themes := map[string]palette{}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		var t themeFile
+		if json.Unmarshal(data, &t) != nil {
+			continue
+		}
+		if t.Name == "" {
+			t.Name = strings.TrimSuffix(filepath.Base(f), ".json")
+		}
+		if p, err := t.palette(); err == nil {
+			themes[t.Name] = p
+		}
+	}
+	return themes
+}
+
+// themeNames lists the built-in themes followed by the user themes.
+func themeNames(user map[string]palette) []string {
+	var names []string
+	for name := range user {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{THEME_SYSTEM, THEME_DARK, THEME_LIGHT}, names...)
+}
+
+// systemPrefersLight reports whether the desktop asks for a light theme.
+// Gio doesn't expose the system color scheme yet, so only the GTK_THEME
+// variable is consulted and dark is assumed otherwise.
+func systemPrefersLight() bool {
+	gtk := os.Getenv("GTK_THEME")
+	return gtk != "" && !strings.HasSuffix(strings.ToLower(gtk), ":dark")
+}
+
+// applyTheme switches to the theme called name, falling back to the
+// system theme for unknown names.
+func (a *App) applyTheme(name string) {
+	switch p, ok := a.themes[name]; {
+	case ok:
+		pal = p
+	case name == THEME_DARK:
+		pal = darkPalette
+	case name == THEME_LIGHT:
+		pal = lightPalette
+	case systemPrefersLight():
+		pal = lightPalette
+	default:
+		pal = darkPalette
+	}
+	setMaterialPalette(a.th)
+}
+
+// setMaterialPalette copies the current palette into th.
+func setMaterialPalette(th *material.Theme) {
+	th.Palette = material.Palette{Bg: pal.Bg, Fg: pal.Fg, ContrastBg: pal.Accent, ContrastFg: pal.AccentFg}
+}
@@ -0,0 +1,208 @@
+package app
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"time"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+type severity int
+
+const (
+	SEVERITY_INFO severity = iota
+	SEVERITY_SUCCESS
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+)
+
+const (
+	TOAST_DURATION        = 4 * time.Second
+	TOAST_ACTION_DURATION = 8 * time.Second // Longer to leave time for the action
+	TOAST_ANIMATION       = 200 * time.Millisecond
+	MAX_TOASTS            = 3 // Shown at once, the others wait in the queue
+	TOAST_WIDTH           = unit.Dp(340)
+)
+
+// toast is a short message shown in the corner of the window for a while.
+type toast struct {
+	message  string
+	severity severity
+	action   string // Label of the action button, empty for none
+	onAction func()
+	duration time.Duration
+	// Widgets
+	actionBtn widget.Clickable
+	closeBtn  widget.Clickable
+	// States
+	shownAt     time.Time // Zero while queued
+	dismissedAt time.Time // Zero until dismissed
+}
+
+// toasts shows toasts stacked above each other, queuing those that don't
+// fit.
+type toasts struct {
+	th       *material.Theme
+	closeIco image.Image
+	queue    []*toast // Shown ones first
+}
+
+func newToasts(th *material.Theme, closeIco image.Image) toasts {
+	return toasts{th: th, closeIco: closeIco}
+}
+
+// show queues a toast with message.
+func (ts *toasts) show(s severity, message string) {
+	ts.queue = append(ts.queue, &toast{message: message, severity: s, duration: TOAST_DURATION})
+}
+
+// showAction queues a toast with message and a button labeled action that
+// runs onAction.
+func (ts *toasts) showAction(s severity, message, action string, onAction func()) {
+	ts.queue = append(ts.queue, &toast{
+		message: message, severity: s, action: action, onAction: onAction, duration: TOAST_ACTION_DURATION,
+	})
+}
+
+// showError shows err if it isn't nil.
+func (ts *toasts) showError(message string, err error) {
+	if err != nil {
+		ts.show(SEVERITY_ERROR, message+": "+err.Error())
+	}
+}
+
+func (t *toast) color() color.NRGBA {
+	switch t.severity {
+	case SEVERITY_SUCCESS:
+		return pal.Success
+	case SEVERITY_WARNING:
+		return pal.Warning
+	case SEVERITY_ERROR:
+		return pal.Danger
+	}
+	return pal.Info
+}
+
+// visibility returns how far t slid in at now, from 0 to 1, easing out.
+func (t *toast) visibility(now time.Time) float32 {
+	p := float32(now.Sub(t.shownAt)) / float32(TOAST_ANIMATION)
+	if !t.dismissedAt.IsZero() {
+		p = 1 - float32(now.Sub(t.dismissedAt))/float32(TOAST_ANIMATION)
+	}
+	p = max(0, min(p, 1))
+	return 1 - (1-p)*(1-p)*(1-p)
+}
+
+// update handles the buttons and timer of t and returns when it needs the
+// next frame.
+func (t *toast) update(gtx C) time.Time {
+	if t.shownAt.IsZero() {
+		t.shownAt = gtx.Now
+	}
+	if t.dismissedAt.IsZero() {
+		if t.actionBtn.Clicked(gtx) {
+			t.dismissedAt = gtx.Now
+			t.onAction()
+		}
+		if t.closeBtn.Clicked(gtx) || !gtx.Now.Before(t.shownAt.Add(t.duration)) {
+			t.dismissedAt = gtx.Now
+		}
+	}
+	switch {
+	case !t.dismissedAt.IsZero():
+		return gtx.Now // Sliding out
+	case gtx.Now.Before(t.shownAt.Add(TOAST_ANIMATION)):
+		return gtx.Now // Sliding in
+	}
+	return t.shownAt.Add(t.duration)
+}
+
+func (ts *toasts) layout(gtx C) D {
+	// Drop the toasts done sliding out
+	ts.queue = slices.DeleteFunc(ts.queue, func(t *toast) bool {
+		return !t.dismissedAt.IsZero() && gtx.Now.Sub(t.dismissedAt) >= TOAST_ANIMATION
+	})
+	margin := gtx.Dp(12)
+	w := min(gtx.Dp(TOAST_WIDTH), gtx.Constraints.Max.X-2*margin)
+	y := gtx.Constraints.Max.Y - margin
+	for i, t := range ts.queue {
+		if i == MAX_TOASTS {
+			break
+		}
+		if next := t.update(gtx); !next.After(gtx.Now) {
+			gtx.Execute(op.InvalidateCmd{})
+		} else {
+			gtx.Execute(op.InvalidateCmd{At: next})
+		}
+		v := t.visibility(gtx.Now)
+		cgtx := gtx
+		cgtx.Constraints = layout.Exact(image.Pt(w, 0))
+		cgtx.Constraints.Max.Y = gtx.Constraints.Max.Y
+		macro := op.Record(gtx.Ops)
+		dims := ts.layoutToast(cgtx, t)
+		call := macro.Stop()
+		// Slide in from the right, the toasts above follow smoothly
+		y -= int(float32(dims.Size.Y+margin/2) * v)
+		x := gtx.Constraints.Max.X - margin - int(float32(w)*v) - int(float32(margin)*(v-1))
+		stack := op.Offset(image.Pt(x, y)).Push(gtx.Ops)
+		call.Add(gtx.Ops)
+		stack.Pop()
+	}
+	return D{Size: gtx.Constraints.Max}
+}
+
+func (ts *toasts) layoutToast(gtx C, t *toast) D {
+	return layout.Background{}.Layout(gtx,
+		func(gtx C) D {
+			sz := gtx.Constraints.Min
+			defer clip.UniformRRect(image.Rect(0, 0, sz.X, sz.Y), 5).Push(gtx.Ops).Pop()
+			paint.ColorOp{Color: t.color()}.Add(gtx.Ops)
+			paint.PaintOp{}.Add(gtx.Ops)
+			return D{Size: sz}
+		},
+		func(gtx C) D {
+			th := *ts.th
+			th.Fg = pal.OnStatus
+			return layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					// Message
+					layout.Flexed(1, func(gtx C) D {
+						lbl := material.Label(&th, unit.Sp(14), t.message)
+						lbl.Font.Weight = font.Bold
+						return lbl.Layout(gtx)
+					}),
+					// Action
+					layout.Rigid(func(gtx C) D {
+						if t.action == "" {
+							return D{}
+						}
+						return layout.Inset{Left: unit.Dp(6)}.Layout(gtx, func(gtx C) D {
+							btn := material.Button(&th, &t.actionBtn, t.action)
+							btn.Background = color.NRGBA{A: 0}
+							btn.Color = pal.OnStatus
+							btn.Inset = layout.UniformInset(unit.Dp(4))
+							return btn.Layout(gtx)
+						})
+					}),
+					layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+					// Close button
+					layout.Rigid(func(gtx C) D {
+						return material.Clickable(gtx, &t.closeBtn, func(gtx C) D {
+							img := widget.Image{Src: paint.NewImageOp(ts.closeIco)}
+							return img.Layout(gtx)
+						})
+					}),
+				)
+			})
+		},
+	)
+}
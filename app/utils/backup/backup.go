@@ -0,0 +1,220 @@
+// Package backup writes and reads encrypted backup archives. An archive is
+// a zip of files and a manifest of their hashes, encrypted with AES-256-GCM
+// under a key derived from a passphrase.
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	VERSION       = 1
+	MANIFEST_FILE = "manifest.json"
+	// PBKDF2 iterations deriving the key from the passphrase
+	ITERATIONS = 600_000
+	SALT_LEN   = 16
+)
+
+// MAGIC starts every archive.
+var MAGIC = []byte("KEEPERBACKUP")
+
+var (
+	ErrNotBackup  = errors.New("not a Keeper backup")
+	ErrPassphrase = errors.New("wrong passphrase, or the backup is damaged")
+	ErrCorrupt    = errors.New("the backup is damaged")
+)
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	// SHA-256 of the files by name
+	Files map[string]string `json:"files"`
+}
+
+// Backup is the content of an archive.
+type Backup struct {
+	Manifest Manifest
+	Files    map[string][]byte
+}
+
+// Write writes an archive of files, by slash separated name, encrypted
+// with passphrase.
+func Write(w io.Writer, passphrase string, files map[string][]byte) error {
+	if passphrase == "" {
+		return errors.New("the passphrase is empty")
+	}
+	m := Manifest{Version: VERSION, Created: time.Now(), Files: map[string]string{}}
+	var names []string
+	for name, data := range files {
+		if name == MANIFEST_FILE {
+			return fmt.Errorf("%s is reserved", name)
+		}
+		sum := sha256.Sum256(data)
+		m.Files[name] = hex.EncodeToString(sum[:])
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var plain bytes.Buffer
+	zw := zip.NewWriter(&plain)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, MANIFEST_FILE, manifest); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := writeZipFile(zw, name, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	// Header: magic, version, iterations, salt and nonce, authenticated
+	// along with the content
+	salt := make([]byte, SALT_LEN)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(passphrase, salt, ITERATIONS)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	header := append([]byte(nil), MAGIC...)
+	header = append(header, VERSION)
+	header = binary.BigEndian.AppendUint32(header, ITERATIONS)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(gcm.Seal(nil, nonce, plain.Bytes(), header))
+	return err
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+// Read reads the archive of r encrypted with passphrase. The files are
+// checked against the manifest, so a backup that reads fine is complete.
+func Read(r io.Reader, passphrase string) (*Backup, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	headerLen := len(MAGIC) + 1 + 4 + SALT_LEN + 12
+	if len(data) < headerLen || !bytes.HasPrefix(data, MAGIC) {
+		return nil, ErrNotBackup
+	}
+	if v := data[len(MAGIC)]; v != VERSION {
+		return nil, fmt.Errorf("unsupported backup version %d", v)
+	}
+	header := data[:headerLen]
+	iterations := int(binary.BigEndian.Uint32(header[len(MAGIC)+1:]))
+	salt := header[len(MAGIC)+5 : len(MAGIC)+5+SALT_LEN]
+	nonce := header[len(MAGIC)+5+SALT_LEN:]
+	if iterations <= 0 || iterations > 100*ITERATIONS {
+		return nil, ErrCorrupt
+	}
+	gcm, err := newGCM(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, data[headerLen:], header)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(plain), int64(len(plain)))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	b := &Backup{Files: map[string][]byte{}}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		b.Files[f.Name] = content
+	}
+	manifest, ok := b.Files[MANIFEST_FILE]
+	if !ok || json.Unmarshal(manifest, &b.Manifest) != nil {
+		return nil, ErrCorrupt
+	}
+	delete(b.Files, MANIFEST_FILE)
+	if len(b.Files) != len(b.Manifest.Files) {
+		return nil, ErrCorrupt
+	}
+	for name, content := range b.Files {
+		sum := sha256.Sum256(content)
+		if b.Manifest.Files[name] != hex.EncodeToString(sum[:]) {
+			return nil, fmt.Errorf("%w: %s doesn't match its hash", ErrCorrupt, name)
+		}
+	}
+	return b, nil
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(PBKDF2([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// PBKDF2 derives a key of keyLen bytes from password with PBKDF2-HMAC-SHA256
+// (RFC 8018).
+func PBKDF2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
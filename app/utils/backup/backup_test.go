@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+var testFiles = map[string][]byte{
+	"notes.json":               []byte(`[{"title":"Groceries"}]`),
+	"settings/settings.json":   []byte(`{"theme":"Dark"}`),
+	"attachments/0a1b2c3d.png": {0x89, 'P', 'N', 'G', 0, 1, 2},
+}
+
+func TestPBKDF2(t *testing.T) {
+	// Test vectors of PBKDF2-HMAC-SHA256 from RFC 7914, section 11
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc" +
+			"49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56" +
+			"a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		want, _ := hex.DecodeString(tt.want)
+		if got := PBKDF2([]byte(tt.password), []byte(tt.salt), tt.iterations, len(want)); !bytes.Equal(got, want) {
+			t.Errorf("PBKDF2(%q, %q, %d) = %x, want %x", tt.password, tt.salt, tt.iterations, got, want)
+		}
+	}
+	// Keys shorter than a block are its prefix
+	if got := PBKDF2([]byte("passwd"), []byte("salt"), 1, 20); hex.EncodeToString(got) != tests[0].want[:40] {
+		t.Errorf("got %x, want the prefix of the 64 bytes key", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "correct horse", testFiles); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), MAGIC) {
+		t.Error("the archive doesn't start with MAGIC")
+	}
+	if bytes.Contains(buf.Bytes(), []byte("Groceries")) {
+		t.Error("the archive isn't encrypted")
+	}
+	b, err := Read(bytes.NewReader(buf.Bytes()), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Manifest.Version != VERSION || len(b.Manifest.Files) != len(testFiles) {
+		t.Errorf("got manifest %+v", b.Manifest)
+	}
+	if len(b.Files) != len(testFiles) {
+		t.Errorf("got %d files, want %d", len(b.Files), len(testFiles))
+	}
+	for name, data := range testFiles {
+		if !bytes.Equal(b.Files[name], data) {
+			t.Errorf("%s: got %q, want %q", name, b.Files[name], data)
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, "", testFiles); err == nil {
+		t.Error("got no error for an empty passphrase")
+	}
+	if err := Write(&bytes.Buffer{}, "pass", map[string][]byte{MANIFEST_FILE: nil}); err == nil {
+		t.Error("got no error for a file named like the manifest")
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "correct horse", testFiles); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(&buf, "battery staple"); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("got %v, want %v", err, ErrPassphrase)
+	}
+}
+
+func TestDamaged(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "pass", testFiles); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+	headerLen := len(MAGIC) + 1 + 4 + SALT_LEN + 12
+	damage := func(f func(data []byte) []byte) []byte {
+		return f(append([]byte(nil), archive...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotBackup},
+		{"not a backup", []byte("PK\x03\x04 some zip file, or anything else really"), ErrNotBackup},
+		{"truncated header", archive[:headerLen-1], ErrNotBackup},
+		{"truncated content", archive[:len(archive)-10], ErrPassphrase},
+		{"tampered content", damage(func(d []byte) []byte { d[headerLen+5] ^= 1; return d }), ErrPassphrase},
+		{"tampered salt", damage(func(d []byte) []byte { d[len(MAGIC)+5] ^= 1; return d }), ErrPassphrase},
+		{"no iterations", damage(func(d []byte) []byte {
+			binary.BigEndian.PutUint32(d[len(MAGIC)+1:], 0)
+			return d
+		}), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		if _, err := Read(bytes.NewReader(tt.data), "pass"); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := Read(bytes.NewReader(damage(func(d []byte) []byte { d[len(MAGIC)] = VERSION + 1; return d })), "pass"); err == nil {
+		t.Error("got no error for an unknown version")
+	}
+}
+
+// seal encrypts plain as the content of an archive, so that archives which
+// decrypt fine but are damaged inside can be made.
+func seal(t *testing.T, plain []byte) []byte {
+	t.Helper()
+	const iterations = 1000
+	salt := make([]byte, SALT_LEN)
+	rand.Read(salt)
+	gcm, err := newGCM("pass", salt, iterations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	header := append([]byte(nil), MAGIC...)
+	header = append(header, VERSION)
+	header = binary.BigEndian.AppendUint32(header, iterations)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+	return gcm.Seal(header, nonce, plain, header)
+}
+
+func zipFiles(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		if err := writeZipFile(zw, name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCorruptContent(t *testing.T) {
+	const hash = "c1b3e4e3e7d8f6e0b7e0bb3b9d6e1f1c5d1e9b8a7c6d5e4f3a2b1c0d9e8f7a6b" // Hash of none of the files
+	tests := []struct {
+		name  string
+		plain []byte
+	}{
+		{"not a zip", []byte("plain text")},
+		{"no manifest", zipFiles(t, map[string]string{"notes.json": "[]"})},
+		{"bad manifest", zipFiles(t, map[string]string{MANIFEST_FILE: "{", "notes.json": "[]"})},
+		{"missing file", zipFiles(t, map[string]string{
+			MANIFEST_FILE: `{"version":1,"files":{"notes.json":"` + hash + `","other":"` + hash + `"}}`,
+			"notes.json":  "[]",
+		})},
+		{"wrong hash", zipFiles(t, map[string]string{
+			MANIFEST_FILE: `{"version":1,"files":{"notes.json":"` + hash + `"}}`,
+			"notes.json":  "[]",
+		})},
+	}
+	for _, tt := range tests {
+		if _, err := Read(bytes.NewReader(seal(t, tt.plain)), "pass"); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrCorrupt)
+		}
+	}
+}
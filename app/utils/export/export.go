@@ -0,0 +1,229 @@
+// Package export writes notes to formats other applications read: a zip of
+// Markdown files, a standalone HTML page, plain text and PDF.
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Note is a note to export.
+type Note struct {
+	Title    string
+	Content  string
+	Journal  string // Date of the day for journal notes
+	Folder   string
+	Tags     []string
+	Modified time.Time
+}
+
+type Format int
+
+const (
+	Markdown Format = iota // Zip of Markdown files
+	HTML                   // Standalone HTML page
+	Text                   // Plain text file
+	PDF
+)
+
+// Formats lists every format, in the order to offer them.
+var Formats = []Format{Markdown, HTML, Text, PDF}
+
+func (f Format) String() string {
+	switch f {
+	case Markdown:
+		return "Markdown (zip)"
+	case HTML:
+		return "HTML"
+	case Text:
+		return "Plain text"
+	case PDF:
+		return "PDF"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// Ext returns the extension of files of format f, dot included.
+func (f Format) Ext() string {
+	switch f {
+	case Markdown:
+		return ".zip"
+	case HTML:
+		return ".html"
+	case Text:
+		return ".txt"
+	case PDF:
+		return ".pdf"
+	}
+	return ""
+}
+
+// Attachments returns the content of the attachment id, it is nil when
+// attachments are left out.
+type Attachments func(id string) ([]byte, error)
+
+// attachmentRefRe matches references to attachments in note content, e.g.
+// ![name](attachment:id).
+var attachmentRefRe = regexp.MustCompile(`(!?)\[([^\]\n]*)\]\(attachment:([0-9a-f]+(?:\.[A-Za-z0-9]+)?)\)`)
+
+// Write writes notes to w in format f. Attachments referred to by the notes
+// are included by the formats that can hold them if attachments isn't nil.
+func Write(w io.Writer, f Format, notes []Note, attachments Attachments) error {
+	switch f {
+	case Markdown:
+		return WriteMarkdown(w, notes, attachments)
+	case HTML:
+		return WriteHTML(w, notes, attachments)
+	case Text:
+		return WriteText(w, notes)
+	case PDF:
+		return WritePDF(w, notes)
+	}
+	return errors.New("export: unknown format")
+}
+
+// WriteMarkdown writes a zip of a Markdown file for every note, in folders
+// named after their folder. The title, tags and dates of notes go into a
+// front matter. Attachments go into the attachments folder and the
+// references to them are rewritten to relative links.
+func WriteMarkdown(w io.Writer, notes []Note, attachments Attachments) error {
+	zw := zip.NewWriter(w)
+	used := map[string]bool{}
+	added := map[string]bool{}
+	for _, n := range notes {
+		dir := ""
+		if n.Journal != "" {
+			dir = "journal"
+		} else if n.Folder != "" {
+			dir = FileName(n.Folder)
+		}
+		name := uniqueName(used, path.Join(dir, FileName(n.Title)), ".md")
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: n.Modified})
+		if err != nil {
+			return err
+		}
+		content := n.Content
+		if attachments != nil {
+			// Links are relative to the note
+			up := strings.Repeat("../", strings.Count(name, "/"))
+			content = attachmentRefRe.ReplaceAllString(content, "$1[$2]("+up+"attachments/$3)")
+		}
+		if _, err := io.WriteString(fw, frontMatter(n)+content); err != nil {
+			return err
+		}
+		if attachments != nil {
+			for _, m := range attachmentRefRe.FindAllStringSubmatch(n.Content, -1) {
+				id := m[3]
+				if added[id] {
+					continue
+				}
+				added[id] = true
+				data, err := attachments(id)
+				if err != nil {
+					return err
+				}
+				aw, err := zw.Create("attachments/" + id)
+				if err != nil {
+					return err
+				}
+				if _, err := aw.Write(data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// frontMatter returns the YAML front matter holding the metadata of n.
+func frontMatter(n Note) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %q\n", n.Title)
+	if len(n.Tags) != 0 {
+		var tags []string
+		for _, t := range n.Tags {
+			tags = append(tags, fmt.Sprintf("%q", t))
+		}
+		fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(tags, ", "))
+	}
+	if n.Folder != "" {
+		fmt.Fprintf(&b, "folder: %q\n", n.Folder)
+	}
+	if n.Journal != "" {
+		fmt.Fprintf(&b, "journal: %s\n", n.Journal)
+	}
+	if !n.Modified.IsZero() {
+		fmt.Fprintf(&b, "modified: %s\n", n.Modified.Format(time.RFC3339))
+	}
+	b.WriteString("---\n\n")
+	return b.String()
+}
+
+// WriteText writes the notes one after the other as plain text.
+func WriteText(w io.Writer, notes []Note) error {
+	bw := bufio.NewWriter(w)
+	for i, n := range notes {
+		if i > 0 {
+			bw.WriteString("\n\n" + strings.Repeat("-", 72) + "\n\n")
+		}
+		bw.WriteString(n.Title + "\n")
+		bw.WriteString(strings.Repeat("=", max(len([]rune(n.Title)), 3)) + "\n")
+		if meta := metadata(n); meta != "" {
+			bw.WriteString(meta + "\n")
+		}
+		bw.WriteString("\n" + strings.TrimRight(n.Content, "\n") + "\n")
+	}
+	return bw.Flush()
+}
+
+// metadata describes the dates, folder and tags of n on one line.
+func metadata(n Note) string {
+	var parts []string
+	if n.Journal != "" {
+		parts = append(parts, "Journal of "+n.Journal)
+	}
+	if !n.Modified.IsZero() {
+		parts = append(parts, "Modified "+n.Modified.Format("2006-01-02 15:04"))
+	}
+	if n.Folder != "" {
+		parts = append(parts, "Folder "+n.Folder)
+	}
+	for _, t := range n.Tags {
+		parts = append(parts, "#"+t)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// FileName turns title into a name safe to use for files on every system.
+func FileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		name = "Untitled"
+	}
+	return name
+}
+
+// uniqueName returns base+ext, numbered if used already has it, and adds it
+// to used.
+func uniqueName(used map[string]bool, base, ext string) string {
+	name := base + ext
+	for k := 2; used[strings.ToLower(name)]; k++ {
+		name = fmt.Sprintf("%s (%d)%s", base, k, ext)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
@@ -0,0 +1,227 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNotes = []Note{
+	{Title: "Groceries", Content: "- milk\n- eggs", Tags: []string{"home"}, Modified: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)},
+	{Title: "Groceries", Content: "Second list"},
+	{Title: "a/b: c?", Content: "![cat](attachment:0a1b.png)", Folder: "Work"},
+	{Title: "Monday", Content: "Journal entry", Journal: "2024-03-04"},
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(b)
+	}
+	return files
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	attachments := func(id string) ([]byte, error) { return []byte("png of " + id), nil }
+	if err := WriteMarkdown(&buf, testNotes, attachments); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, buf.Bytes())
+	want := []string{"Groceries.md", "Groceries (2).md", "Work/a_b_ c_.md", "journal/Monday.md", "attachments/0a1b.png"}
+	if len(files) != len(want) {
+		t.Errorf("got %d files, want %d", len(files), len(want))
+	}
+	for _, name := range want {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	if got := files["Groceries.md"]; !strings.HasPrefix(got, "---\ntitle: \"Groceries\"\ntags: [\"home\"]\nmodified: 2024-03-01T10:00:00Z\n---\n\n- milk") {
+		t.Errorf("front matter: got %q", got)
+	}
+	if got := files["Work/a_b_ c_.md"]; !strings.HasSuffix(got, "![cat](../attachments/0a1b.png)") {
+		t.Errorf("attachment link not rewritten: %q", got)
+	}
+	if got := files["attachments/0a1b.png"]; got != "png of 0a1b.png" {
+		t.Errorf("attachment: got %q", got)
+	}
+}
+
+func TestWriteMarkdownWithoutAttachments(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, testNotes[2:3], nil); err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, buf.Bytes())
+	if len(files) != 1 || !strings.HasSuffix(files["Work/a_b_ c_.md"], "(attachment:0a1b.png)") {
+		t.Errorf("got %v", files)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	for title, want := range map[string]string{
+		"Plain":        "Plain",
+		"  ":           "Untitled",
+		"a/b\\c":       "a_b_c",
+		"..":           "Untitled",
+		"Notes.":       "Notes",
+		"tab\there":    "tab_here",
+		`<"what?">*|:`: "__what______",
+	} {
+		if got := FileName(title); got != want {
+			t.Errorf("FileName(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	notes := []Note{{
+		Title:   "<script>",
+		Content: "# Heading\nSome **bold** and *em* & `code`\n\n- one\n- two\n\n1. first\n\n> quote\n\n```\nif a < b {}\n```\n[link](https://example.com)",
+	}}
+	var buf bytes.Buffer
+	if err := WriteHTML(&buf, notes, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"<style>",
+		"<title>&lt;script&gt;</title>",
+		"<h1>&lt;script&gt;</h1>",
+		"<h2>Heading</h2>",
+		"<strong>bold</strong>",
+		"<em>em</em>",
+		"&amp;",
+		"<code>code</code>",
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>",
+		"<ol>\n<li>first</li>\n</ol>",
+		"<blockquote>quote</blockquote>",
+		"<pre><code>if a &lt; b {}\n</code></pre>",
+		`<a href="https://example.com">link</a>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script>") {
+		t.Error("title not escaped")
+	}
+}
+
+func TestWriteHTMLEmbedsAttachments(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteHTML(&buf, testNotes[2:3], func(id string) ([]byte, error) { return []byte("img"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<img src="data:image/png;base64,aW1n" alt="cat">`; !strings.Contains(buf.String(), want) {
+		t.Errorf("missing %q in\n%s", want, buf.String())
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteText(&buf, testNotes[:2]); err != nil {
+		t.Fatal(err)
+	}
+	want := "Groceries\n=========\nModified 2024-03-01 10:00 · #home\n\n- milk\n- eggs\n" +
+		"\n\n" + strings.Repeat("-", 72) + "\n\n" +
+		"Groceries\n=========\n\nSecond list\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	long := strings.Repeat("A line long enough to wrap (with parentheses) and a \\ backslash. ", 400)
+	notes := []Note{{Title: "Short", Content: "Hello — “world” ✓"}, {Title: "Long", Content: long}}
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, notes); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF")
+	}
+
+	// Every entry of the cross-reference table points to its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d doesn't point to the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(data[off:], []byte(want)) {
+			t.Errorf("object %d isn't at offset %d", i+1, off)
+		}
+	}
+
+	// The long note takes several pages, each note starts a page
+	count := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(data)
+	pages, _ := strconv.Atoi(string(count[1]))
+	if pages < 3 {
+		t.Errorf("got %d pages, want at least 3", pages)
+	}
+	if n := bytes.Count(data, []byte("/Type /Page ")); n != pages {
+		t.Errorf("got %d page objects, want %d", n, pages)
+	}
+	if !bytes.Contains(data, []byte("(Hello \x97 \x93world\x94 ?)")) {
+		t.Error("text not encoded in WinAnsiEncoding")
+	}
+	if !bytes.Contains(data, []byte(`\(with parentheses\)`)) || !bytes.Contains(data, []byte(`\\ backslash`)) {
+		t.Error("special characters not escaped")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	s := []byte("aaaa bbbb cccc")
+	w := textWidth([]byte("aaaa bbbb"), fontRegular, 10)
+	lines := wrap(s, fontRegular, 10, w)
+	if len(lines) != 2 || string(lines[0]) != "aaaa bbbb" || string(lines[1]) != "cccc" {
+		t.Errorf("got %q", lines)
+	}
+	// Words longer than a line are broken
+	lines = wrap([]byte("abcdefgh"), fontMono, 10, 30)
+	if len(lines) != 2 || string(lines[0]) != "abcde" {
+		t.Errorf("got %q", lines)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	for _, f := range Formats {
+		var buf bytes.Buffer
+		if err := Write(&buf, f, nil, nil); err != nil {
+			t.Errorf("%s: %v", f, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package export
+
+import (
+	"bufio"
+	"encoding/base64"
+	"html"
+	"io"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const htmlStyle = `body{font-family:-apple-system,"Segoe UI",Helvetica,Arial,sans-serif;max-width:46em;margin:2em auto;padding:0 1em;color:#222;line-height:1.5}
+article{border-bottom:1px solid #ddd;padding-bottom:2em;margin-bottom:2em}
+.meta{color:#777;font-size:.85em}
+pre{background:#f4f4f6;padding:.8em;overflow:auto;border-radius:4px}
+code{font-family:Menlo,Consolas,monospace;font-size:.9em}
+blockquote{border-left:3px solid #ccc;margin-left:0;padding-left:1em;color:#555}
+img{max-width:100%}`
+
+var (
+	codeSpanRe = regexp.MustCompile("`([^`]+)`")
+	boldRe     = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicRe   = regexp.MustCompile(`\*([^*]+)\*`)
+	imageRe    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkRe     = regexp.MustCompile(`\[([^\]]*)\]\(([^)\s]+)\)`)
+	orderedRe  = regexp.MustCompile(`^\d+[.)] `)
+)
+
+// WriteHTML writes the notes as a single HTML page with its styles
+// embedded. Image attachments are embedded too when attachments isn't nil.
+func WriteHTML(w io.Writer, notes []Note, attachments Attachments) error {
+	bw := bufio.NewWriter(w)
+	title := "Notes"
+	if len(notes) == 1 {
+		title = notes[0].Title
+	}
+	bw.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	bw.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	bw.WriteString("<style>\n" + htmlStyle + "\n</style>\n</head>\n<body>\n")
+	for _, n := range notes {
+		bw.WriteString("<article>\n<h1>" + html.EscapeString(n.Title) + "</h1>\n")
+		if meta := metadata(n); meta != "" {
+			bw.WriteString("<p class=\"meta\">" + html.EscapeString(meta) + "</p>\n")
+		}
+		content := n.Content
+		if attachments != nil {
+			content = attachmentRefRe.ReplaceAllStringFunc(content, func(ref string) string {
+				m := attachmentRefRe.FindStringSubmatch(ref)
+				data, err := attachments(m[3])
+				if err != nil {
+					return ref
+				}
+				typ := mime.TypeByExtension(path.Ext(m[3]))
+				if typ == "" {
+					typ = "application/octet-stream"
+				}
+				return m[1] + "[" + m[2] + "](data:" + typ + ";base64," + base64.StdEncoding.EncodeToString(data) + ")"
+			})
+		}
+		bw.WriteString(markdownToHTML(content))
+		bw.WriteString("</article>\n")
+	}
+	bw.WriteString("</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// markdownToHTML renders the Markdown the app understands: headings, lists,
+// quotes, fenced code, emphasis, links and images.
+func markdownToHTML(md string) string {
+	var b strings.Builder
+	var para []string
+	list := "" // Tag of the open list
+	inCode := false
+	flush := func() {
+		if len(para) != 0 {
+			b.WriteString("<p>" + strings.Join(para, "<br>\n") + "</p>\n")
+			para = nil
+		}
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			flush()
+			b.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			if inCode {
+				b.WriteString("</code></pre>\n")
+			} else {
+				flush()
+				b.WriteString("<pre><code>")
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			b.WriteString(html.EscapeString(line) + "\n")
+			continue
+		}
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "#"):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 || !strings.HasPrefix(trimmed[level:], " ") {
+				para = append(para, inline(trimmed))
+				continue
+			}
+			flush()
+			tag := "h" + string(rune('0'+min(level+1, 6))) // The title is the h1
+			b.WriteString("<" + tag + ">" + inline(strings.TrimSpace(trimmed[level:])) + "</" + tag + ">\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			openList("ul")
+			b.WriteString("<li>" + inline(trimmed[2:]) + "</li>\n")
+		case orderedRe.MatchString(trimmed):
+			openList("ol")
+			b.WriteString("<li>" + inline(trimmed[len(orderedRe.FindString(trimmed)):]) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			b.WriteString("<blockquote>" + inline(strings.TrimSpace(trimmed[1:])) + "</blockquote>\n")
+		default:
+			if list != "" {
+				flush()
+			}
+			para = append(para, inline(trimmed))
+		}
+	}
+	if inCode {
+		b.WriteString("</code></pre>\n")
+	}
+	flush()
+	return b.String()
+}
+
+// inline renders the emphasis, code spans, links and images of s.
+func inline(s string) string {
+	s = html.EscapeString(s)
+	s = codeSpanRe.ReplaceAllString(s, "<code>$1</code>")
+	s = boldRe.ReplaceAllString(s, "<strong>$1</strong>")
+	s = italicRe.ReplaceAllString(s, "<em>$1</em>")
+	s = imageRe.ReplaceAllString(s, `<img src="$2" alt="$1">`)
+	s = linkRe.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	return s
+}
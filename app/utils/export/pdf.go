@@ -0,0 +1,276 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Pages are A4 in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	pageMargin = 56
+)
+
+// PDF fonts, the standard ones every reader has so nothing gets embedded
+const (
+	fontRegular = iota
+	fontBold
+	fontMono
+)
+
+var fontNames = []string{"Helvetica", "Helvetica-Bold", "Courier"}
+
+// helveticaWidths are the widths of the printable ASCII characters of
+// Helvetica, in thousandths of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// winAnsi maps the runes outside of Latin-1 that WinAnsiEncoding has.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// encodePDF encodes s in WinAnsiEncoding, runes it hasn't become ?.
+func encodePDF(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b = append(b, ' ', ' ', ' ', ' ')
+		case r >= ' ' && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// textWidth returns the width of the encoded text s in points.
+func textWidth(s []byte, font int, size float64) float64 {
+	if font == fontMono {
+		return float64(len(s)) * 600 * size / 1000
+	}
+	w := 0
+	for _, c := range s {
+		if c >= ' ' && c < 0x7f {
+			w += helveticaWidths[c-' ']
+		} else {
+			w += 556
+		}
+	}
+	if font == fontBold {
+		// Bold is about 8% wider, close enough to wrap lines
+		w = w * 108 / 100
+	}
+	return float64(w) * size / 1000
+}
+
+// wrap splits the encoded text s into lines no wider than width.
+func wrap(s []byte, font int, size, width float64) [][]byte {
+	var lines [][]byte
+	for len(s) > 0 {
+		if textWidth(s, font, size) <= width {
+			lines = append(lines, s)
+			break
+		}
+		// Longest prefix that fits, broken after a space if there is one
+		n := 1
+		for n < len(s) && textWidth(s[:n+1], font, size) <= width {
+			n++
+		}
+		if s[n] != ' ' {
+			if k := bytes.LastIndexByte(s[:n], ' '); k > 0 {
+				n = k + 1
+			}
+		}
+		lines = append(lines, bytes.TrimRight(s[:n], " "))
+		s = bytes.TrimLeft(s[n:], " ")
+	}
+	if len(lines) == 0 {
+		lines = append(lines, nil)
+	}
+	return lines
+}
+
+// pdfWriter lays notes out into pages.
+type pdfWriter struct {
+	pages [][]byte
+	page  bytes.Buffer // Content stream of the current page
+	y     float64      // Baseline of the next line
+}
+
+func (p *pdfWriter) newPage() {
+	if p.page.Len() > 0 || len(p.pages) > 0 {
+		p.pages = append(p.pages, bytes.Clone(p.page.Bytes()))
+	}
+	p.page.Reset()
+	p.y = pageHeight - pageMargin
+}
+
+// text writes s wrapped at the width of the page, indented by indent, in the
+// gray level gray, with a line height of 1.4 times the size.
+func (p *pdfWriter) text(s string, font int, size, indent, gray float64) {
+	lead := size * 1.4
+	for _, line := range wrap(encodePDF(s), font, size, pageWidth-2*pageMargin-indent) {
+		if p.y-lead < pageMargin {
+			p.newPage()
+		}
+		p.y -= lead
+		fmt.Fprintf(&p.page, "BT %.2f g /F%d %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+			gray, font+1, size, pageMargin+indent, p.y, escapePDF(line))
+	}
+}
+
+func (p *pdfWriter) space(h float64) {
+	p.y -= h
+}
+
+// note lays n out starting on a new page.
+func (p *pdfWriter) note(n Note) {
+	p.newPage()
+	title := n.Title
+	if strings.TrimSpace(title) == "" {
+		title = "Untitled"
+	}
+	p.text(title, fontBold, 16, 0, 0)
+	if meta := metadata(n); meta != "" {
+		p.text(meta, fontRegular, 9, 0, 0.45)
+	}
+	p.space(8)
+	inCode := false
+	for _, line := range strings.Split(n.Content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			p.text(line, fontMono, 10, 12, 0.15)
+			continue
+		}
+		switch {
+		case trimmed == "":
+			p.space(6)
+		case strings.HasPrefix(trimmed, "#") && strings.HasPrefix(strings.TrimLeft(trimmed, "#"), " "):
+			p.space(4)
+			p.text(plainText(strings.TrimLeft(trimmed, "# ")), fontBold, 13, 0, 0)
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			p.text("• "+plainText(trimmed[2:]), fontRegular, 11, 12, 0)
+		case orderedRe.MatchString(trimmed):
+			p.text(plainText(trimmed), fontRegular, 11, 12, 0)
+		case strings.HasPrefix(trimmed, ">"):
+			p.text(plainText(strings.TrimSpace(trimmed[1:])), fontRegular, 11, 18, 0.35)
+		default:
+			p.text(plainText(trimmed), fontRegular, 11, 0, 0)
+		}
+	}
+}
+
+// plainText strips the inline Markdown of s, leaving the text it shows.
+func plainText(s string) string {
+	s = attachmentRefRe.ReplaceAllString(s, "[$2]")
+	s = imageRe.ReplaceAllString(s, "[$1]")
+	s = linkRe.ReplaceAllString(s, "$1 ($2)")
+	s = boldRe.ReplaceAllString(s, "$1")
+	s = italicRe.ReplaceAllString(s, "$1")
+	return codeSpanRe.ReplaceAllString(s, "$1")
+}
+
+// escapePDF escapes the characters of s special in PDF strings.
+func escapePDF(s []byte) []byte {
+	var b []byte
+	for _, c := range s {
+		if c == '(' || c == ')' || c == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// WritePDF writes the notes as a PDF document, every note starting on a
+// new page. Only the standard fonts are used, so runes outside of the
+// Windows Latin-1 code page show as question marks.
+func WritePDF(w io.Writer, notes []Note) error {
+	var p pdfWriter
+	for _, n := range notes {
+		p.note(n)
+	}
+	p.newPage()
+	if len(p.pages) == 0 {
+		p.pages = append(p.pages, nil)
+	}
+
+	// Objects: catalog, page tree, fonts, then a page and its content for
+	// every page
+	fontObj := 3
+	pageObj := func(i int) int { return fontObj + len(fontNames) + 2*i }
+	var objs []string
+	objs = append(objs, "<< /Type /Catalog /Pages 2 0 R >>")
+	var kids []string
+	for i := range p.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObj(i)))
+	}
+	objs = append(objs, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	var fonts []string
+	for i, name := range fontNames {
+		objs = append(objs, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i+1, fontObj+i))
+	}
+	for i, content := range p.pages {
+		objs = append(objs,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, strings.Join(fonts, " "), pageObj(i)+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		)
+	}
+
+	bw := &countingWriter{w: bufio.NewWriter(w)}
+	bw.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = bw.n
+		bw.WriteString(fmt.Sprintf("%d 0 obj\n%s\nendobj\n", i+1, obj))
+	}
+	xref := bw.n
+	bw.WriteString(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(objs)+1))
+	for _, off := range offsets {
+		bw.WriteString(fmt.Sprintf("%010d 00000 n \n", off))
+	}
+	bw.WriteString(fmt.Sprintf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref))
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+// countingWriter counts the bytes written to w for the cross-reference
+// table, and keeps the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int
+	err error
+}
+
+func (c *countingWriter) WriteString(s string) {
+	if c.err != nil {
+		return
+	}
+	n, err := c.w.WriteString(s)
+	c.n += n
+	c.err = err
+}
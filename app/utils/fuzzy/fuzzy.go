@@ -0,0 +1,64 @@
+// Package fuzzy matches queries against strings the way command palettes
+// do: the characters of the query must appear in order, not necessarily
+// next to each other.
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Match reports whether every rune of query appears in s in order, ignoring
+// case, and scores the match. Runs of consecutive runes and runes at the
+// start of words score higher. An empty query matches everything with a
+// score of 0.
+func Match(query, s string) (score int, ok bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+	runes := []rune(s)
+	qi, run := 0, 0
+	for i, r := range runes {
+		if qi == len(q) {
+			break
+		}
+		if unicode.ToLower(r) != q[qi] {
+			run = 0
+			continue
+		}
+		qi++
+		run++
+		score += run
+		if i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]) {
+			score += 3 // Start of a word
+		}
+	}
+	if qi != len(q) {
+		return 0, false
+	}
+	// Prefer shorter strings among equally good matches
+	return score*100 - len(runes), true
+}
+
+// Result is an item that matched a query.
+type Result struct {
+	Index int // Index in the list passed to Filter
+	Score int
+}
+
+// Filter returns the indices of the items matching query, best first.
+// Items scoring the same keep their order.
+func Filter(query string, items []string) []Result {
+	var results []Result
+	for i, s := range items {
+		if score, ok := Match(query, s); ok {
+			results = append(results, Result{Index: i, Score: score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
@@ -0,0 +1,51 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		query, s string
+		ok       bool
+	}{
+		{"", "anything", true},
+		{"", "", true},
+		{"abc", "a-b-c", true},
+		{"NO", "new note", true},
+		{"acb", "abc", false},
+		{"aa", "a", false},
+		{"é", "Éclair", true},
+	}
+	for _, tt := range tests {
+		if _, ok := Match(tt.query, tt.s); ok != tt.ok {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.query, tt.s, ok, tt.ok)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		items []string
+		want  []int
+	}{
+		{"starts of words first", "np", []string{"Snapshot", "Open", "New page"}, []int{2, 0}},
+		{"runs first", "note", []string{"no tea", "notebook"}, []int{1, 0}},
+		{"shorter first", "go", []string{"Go to note", "Go"}, []int{1, 0}},
+		{"ties keep their order", "x", []string{"x1", "x2", "x3"}, []int{0, 1, 2}},
+		{"empty query keeps everything", "", []string{"b", "a"}, []int{0, 1}},
+		{"no match", "zz", []string{"a", "b"}, nil},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, r := range Filter(tt.query, tt.items) {
+			got = append(got, r.Index)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package highlight
+
+type cacheKey struct {
+	lang, src string
+}
+
+type cacheEntry struct {
+	lines [][]Token
+	gen   int
+}
+
+// Cache remembers the tokens of already lexed sources, so that a note with
+// many code blocks only lexes the blocks that changed.
+type Cache struct {
+	entries map[cacheKey]*cacheEntry
+	gen     int
+}
+
+// Lines returns the tokens of src split into lines, lexing src only if it
+// hasn't been seen since the last Sweep.
+func (c *Cache) Lines(lang, src string) [][]Token {
+	if c.entries == nil {
+		c.entries = map[cacheKey]*cacheEntry{}
+	}
+	k := cacheKey{lang, src}
+	e, ok := c.entries[k]
+	if !ok {
+		e = &cacheEntry{lines: Lines(Tokenize(lang, src))}
+		c.entries[k] = e
+	}
+	e.gen = c.gen
+	return e.lines
+}
+
+// Sweep forgets every source that wasn't requested since the previous
+// Sweep.
+func (c *Cache) Sweep() {
+	for k, e := range c.entries {
+		if e.gen != c.gen {
+			delete(c.entries, k)
+		}
+	}
+	c.gen++
+}
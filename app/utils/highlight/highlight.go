@@ -0,0 +1,322 @@
+package highlight
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Kind int
+
+const (
+	Text Kind = iota
+	Keyword
+	Type
+	String
+	Number
+	Comment
+	Operator
+	// Name is used for keys, variables and decorators
+	Name
+)
+
+type Token struct {
+	Kind Kind
+	Text string
+}
+
+type language struct {
+	keywords        map[string]bool
+	types           map[string]bool
+	caseInsensitive bool
+	lineComments    []string
+	// Line comments that only start at the beginning of a word, like shell's #
+	wordComments bool
+	blockComment [2]string
+	// String delimiters, longest first
+	strings   []string
+	raw       map[string]bool
+	multiline map[string]bool
+	// Extra characters allowed inside identifiers
+	identChars string
+	// Identifiers and strings followed by ':' are keys
+	keys       bool
+	variables  bool
+	decorators bool
+}
+
+func set(words string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(words) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	golang = &language{
+		keywords: set(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var`),
+		types: set(`bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune
+			string uint uint8 uint16 uint32 uint64 uintptr any comparable true false nil iota append cap
+			clear close copy delete len make max min new panic print println recover`),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		strings:      []string{`"`, "'", "`"},
+		raw:          set("`"),
+		multiline:    set("`"),
+	}
+	shell = &language{
+		keywords: set(`if then else elif fi for while until do done case esac in function return
+			export local readonly unset shift exit break continue select time declare source alias`),
+		types:        set(`echo printf cd pwd test read eval exec set trap true false`),
+		lineComments: []string{"#"},
+		wordComments: true,
+		strings:      []string{`"`, "'"},
+		raw:          set("'"),
+		multiline:    set(`" '`),
+		identChars:   "-",
+		variables:    true,
+	}
+	jsonLang = &language{
+		keywords: set(`true false null`),
+		strings:  []string{`"`},
+		keys:     true,
+	}
+	yaml = &language{
+		keywords:     set(`true false null yes no on off True False Null`),
+		lineComments: []string{"#"},
+		wordComments: true,
+		strings:      []string{`"`, "'"},
+		raw:          set("'"),
+		identChars:   "-.",
+		keys:         true,
+	}
+	sql = &language{
+		keywords: set(`select from where and or not insert into values update set delete create table
+			drop alter add column index primary key foreign references join left right inner outer full
+			on as group by order having limit offset distinct union all exists in is null like between
+			case when then else end begin commit rollback transaction view default unique check with
+			asc desc returning if cascade constraint`),
+		types: set(`int integer bigint smallint serial text varchar char boolean bool date time
+			timestamp timestamptz real float double numeric decimal blob json jsonb uuid count sum avg min max
+			coalesce now`),
+		caseInsensitive: true,
+		lineComments:    []string{"--"},
+		blockComment:    [2]string{"/*", "*/"},
+		strings:         []string{"'", `"`},
+	}
+	python = &language{
+		keywords: set(`and as assert async await break class continue def del elif else except finally
+			for from global if import in is lambda nonlocal not or pass raise return try while with yield
+			match case True False None self`),
+		types: set(`int float str bool bytes list dict set tuple object type len range print open
+			enumerate zip map filter sorted isinstance super Exception ValueError TypeError KeyError`),
+		lineComments: []string{"#"},
+		strings:      []string{`"""`, `'''`, `"`, "'"},
+		multiline:    set(`""" '''`),
+		decorators:   true,
+	}
+)
+
+var languages = map[string]*language{
+	"go":     golang,
+	"golang": golang,
+	"sh":     shell,
+	"bash":   shell,
+	"shell":  shell,
+	"zsh":    shell,
+	"json":   jsonLang,
+	"yaml":   yaml,
+	"yml":    yaml,
+	"sql":    sql,
+	"python": python,
+	"py":     python,
+}
+
+// Supported reports whether lang can be highlighted.
+func Supported(lang string) bool {
+	_, ok := languages[strings.ToLower(lang)]
+	return ok
+}
+
+// Tokenize splits src into tokens. Concatenating the text of the tokens
+// gives back src. Unknown languages produce a single Text token.
+func Tokenize(lang, src string) []Token {
+	l, ok := languages[strings.ToLower(lang)]
+	if !ok {
+		return []Token{{Kind: Text, Text: src}}
+	}
+	var toks []Token
+	emit := func(k Kind, s string) {
+		if s == "" {
+			return
+		}
+		// Merge runs of the same kind
+		if n := len(toks); n > 0 && toks[n-1].Kind == k && (k == Text || k == Operator) {
+			toks[n-1].Text += s
+			return
+		}
+		toks = append(toks, Token{Kind: k, Text: s})
+	}
+	for i := 0; i < len(src); {
+		rest := src[i:]
+		if n := l.comment(src, i); n > 0 {
+			emit(Comment, rest[:n])
+			i += n
+			continue
+		}
+		if n := l.str(rest); n > 0 {
+			k := String
+			if l.keys && isKey(rest[n:]) {
+				k = Name
+			}
+			emit(k, rest[:n])
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case unicode.IsSpace(r):
+			n := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+			if n < 0 {
+				n = len(rest)
+			}
+			emit(Text, rest[:n])
+			i += n
+		case unicode.IsDigit(r) || (r == '.' && len(rest) > 1 && isDigit(rest[1])):
+			n := l.ident(rest, ".")
+			emit(Number, rest[:n])
+			i += n
+		case unicode.IsLetter(r) || r == '_':
+			n := l.ident(rest, l.identChars)
+			word := rest[:n]
+			key := word
+			if l.caseInsensitive {
+				key = strings.ToLower(word)
+			}
+			switch {
+			case l.keys && isKey(rest[n:]):
+				emit(Name, word)
+			case l.keywords[key]:
+				emit(Keyword, word)
+			case l.types[key]:
+				emit(Type, word)
+			default:
+				emit(Text, word)
+			}
+			i += n
+		case l.variables && r == '$' && len(rest) > 1:
+			n := 1
+			if rest[1] == '{' {
+				if end := strings.IndexByte(rest, '}'); end > 0 {
+					n = end + 1
+				}
+			} else {
+				n += l.ident(rest[1:], "")
+			}
+			if n == 1 && len(rest) > 1 && strings.IndexByte("?#@*!$0123456789", rest[1]) >= 0 {
+				n = 2
+			}
+			emit(Name, rest[:n])
+			i += n
+		case l.decorators && r == '@' && len(rest) > 1 && isIdentStart(rest[1]):
+			n := 1 + l.ident(rest[1:], ".")
+			emit(Name, rest[:n])
+			i += n
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			emit(Operator, rest[:size])
+			i += size
+		default:
+			emit(Text, rest[:size])
+			i += size
+		}
+	}
+	return toks
+}
+
+// comment returns the length of the comment starting at src[i], if any.
+func (l *language) comment(src string, i int) int {
+	rest := src[i:]
+	for _, c := range l.lineComments {
+		if !strings.HasPrefix(rest, c) {
+			continue
+		}
+		if l.wordComments && i > 0 && !unicode.IsSpace(rune(src[i-1])) {
+			continue
+		}
+		if n := strings.IndexByte(rest, '\n'); n >= 0 {
+			return n
+		}
+		return len(rest)
+	}
+	if open, close := l.blockComment[0], l.blockComment[1]; open != "" && strings.HasPrefix(rest, open) {
+		if n := strings.Index(rest[len(open):], close); n >= 0 {
+			return len(open) + n + len(close)
+		}
+		return len(rest)
+	}
+	return 0
+}
+
+// str returns the length of the string literal at the start of s, if any.
+func (l *language) str(s string) int {
+	for _, d := range l.strings {
+		if !strings.HasPrefix(s, d) {
+			continue
+		}
+		for i := len(d); i < len(s); i++ {
+			switch {
+			case s[i] == '\\' && !l.raw[d]:
+				i++
+			case s[i] == '\n' && !l.multiline[d]:
+				return i
+			case strings.HasPrefix(s[i:], d):
+				return i + len(d)
+			}
+		}
+		return len(s)
+	}
+	return 0
+}
+
+// ident returns the length of the identifier at the start of s.
+func (l *language) ident(s string, extra string) int {
+	n := strings.IndexFunc(s, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || strings.ContainsRune(extra, r))
+	})
+	if n < 0 {
+		return len(s)
+	}
+	return n
+}
+
+func isKey(s string) bool {
+	s = strings.TrimLeft(s, " \t")
+	return strings.HasPrefix(s, ":")
+}
+
+func isDigit(b byte) bool {
+	return '0' <= b && b <= '9'
+}
+
+func isIdentStart(b byte) bool {
+	return b == '_' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+}
+
+// Lines splits tokens at line breaks so each line can be laid out on its own.
+func Lines(toks []Token) [][]Token {
+	lines := [][]Token{nil}
+	for _, t := range toks {
+		parts := strings.Split(t.Text, "\n")
+		for i, p := range parts {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if p != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], Token{Kind: t.Kind, Text: p})
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,125 @@
+package highlight
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// visible trims the tokens and drops those left empty, so that tables
+// needn't spell out the spaces between tokens.
+func visible(toks []Token) []Token {
+	var out []Token
+	for _, t := range toks {
+		if t.Text = strings.TrimSpace(t.Text); t.Text != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		src  string
+		want []Token
+	}{
+		{"go keywords and comments", "go", "func main() int // hi", []Token{
+			{Keyword, "func"}, {Text, "main"}, {Operator, "()"}, {Type, "int"}, {Comment, "// hi"},
+		}},
+		{"go escapes", "go", `s = "a\"b"`, []Token{
+			{Text, "s"}, {Operator, "="}, {String, `"a\"b"`},
+		}},
+		{"go raw strings span lines", "go", "`a\\n\nb`", []Token{{String, "`a\\n\nb`"}}},
+		{"go strings end at line breaks", "go", "\"ab\ncd", []Token{{String, `"ab`}, {Text, "cd"}}},
+		{"go unterminated block comment", "go", "x /* a\nb", []Token{{Text, "x"}, {Comment, "/* a\nb"}}},
+		{"numbers", "go", "1.5e3 + .5", []Token{{Number, "1.5e3"}, {Operator, "+"}, {Number, ".5"}}},
+		{"language names ignore case", "GoLang", "nil", []Token{{Type, "nil"}}},
+		{"shell variables", "sh", "echo $HOME ${x-y} $? $", []Token{
+			{Type, "echo"}, {Name, "$HOME"}, {Name, "${x-y}"}, {Name, "$?"}, {Operator, "$"},
+		}},
+		{"shell comments start words", "bash", "a#b # c", []Token{
+			{Text, "a"}, {Operator, "#"}, {Text, "b"}, {Comment, "# c"},
+		}},
+		{"shell raw strings and dashes", "sh", `my-cmd 'a\' "b"`, []Token{
+			{Text, "my-cmd"}, {String, `'a\'`}, {String, `"b"`},
+		}},
+		{"json keys", "json", `{"a": 1, "b": "c", "d": true}`, []Token{
+			{Operator, "{"}, {Name, `"a"`}, {Operator, ":"}, {Number, "1"}, {Operator, ","},
+			{Name, `"b"`}, {Operator, ":"}, {String, `"c"`}, {Operator, ","},
+			{Name, `"d"`}, {Operator, ":"}, {Keyword, "true"}, {Operator, "}"},
+		}},
+		{"yaml keys and comments", "yml", "key-name: yes # c\nurl: a#b", []Token{
+			{Name, "key-name"}, {Operator, ":"}, {Keyword, "yes"}, {Comment, "# c"},
+			{Name, "url"}, {Operator, ":"}, {Text, "a"}, {Operator, "#"}, {Text, "b"},
+		}},
+		{"sql ignores case", "sql", "SELECT count(*) FROM t -- c", []Token{
+			{Keyword, "SELECT"}, {Type, "count"}, {Operator, "(*)"}, {Keyword, "FROM"}, {Text, "t"}, {Comment, "-- c"},
+		}},
+		{"python decorators and triple quotes", "py", "@app.route\ndef f(): return \"\"\"a\nb\"\"\"", []Token{
+			{Name, "@app.route"}, {Keyword, "def"}, {Text, "f"}, {Operator, "():"}, {Keyword, "return"}, {String, "\"\"\"a\nb\"\"\""},
+		}},
+		{"python single quotes end at line breaks", "python", "'a\nb", []Token{{String, "'a"}, {Text, "b"}}},
+		{"unknown language", "cobol", "MOVE 1 TO X.", []Token{{Text, "MOVE 1 TO X."}}},
+	}
+	for _, tt := range tests {
+		toks := Tokenize(tt.lang, tt.src)
+		var b strings.Builder
+		for _, tok := range toks {
+			b.WriteString(tok.Text)
+		}
+		if b.String() != tt.src {
+			t.Errorf("%s: tokens give back %q, want %q", tt.name, b.String(), tt.src)
+		}
+		if got := visible(toks); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for lang, want := range map[string]bool{"go": true, "Python": true, "YAML": true, "cobol": false, "": false} {
+		if got := Supported(lang); got != want {
+			t.Errorf("Supported(%q) = %v, want %v", lang, got, want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	got := Lines(Tokenize("go", "a /* x\ny */ b\n\nc"))
+	want := [][]Token{
+		{{Text, "a "}, {Comment, "/* x"}},
+		{{Comment, "y */"}, {Text, " b"}},
+		nil,
+		{{Text, "c"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var c Cache
+	a := c.Lines("go", "var a int")
+	b := c.Lines("go", "var b int")
+	if want := Lines(Tokenize("go", "var a int")); !reflect.DeepEqual(a, want) {
+		t.Fatalf("got %v, want %v", a, want)
+	}
+	if other := c.Lines("sh", "var a int"); reflect.DeepEqual(other, a) {
+		t.Error("the same source in another language shares its tokens")
+	}
+	c.Sweep()
+	// Both were requested before the sweep, so both are kept
+	if got := c.Lines("go", "var a int"); &got[0] != &a[0] {
+		t.Error("a source requested before the sweep was lexed again")
+	}
+	c.Sweep()
+	// b wasn't requested since the previous sweep
+	if len(c.entries) != 1 {
+		t.Errorf("got %d entries after the sweep, want 1", len(c.entries))
+	}
+	if got := c.Lines("go", "var b int"); &got[0] == &b[0] {
+		t.Error("a swept source wasn't lexed again")
+	}
+}
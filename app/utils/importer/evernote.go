@@ -0,0 +1,247 @@
+package importer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const ENEX_TIME = "20060102T150405Z"
+
+// enexNote is a note of an Evernote export.
+type enexNote struct {
+	Title     string   `xml:"title"`
+	Content   string   `xml:"content"`
+	Created   string   `xml:"created"`
+	Updated   string   `xml:"updated"`
+	Tags      []string `xml:"tag"`
+	Resources []struct {
+		Data     string `xml:"data"`
+		Mime     string `xml:"mime"`
+		FileName string `xml:"resource-attributes>file-name"`
+	} `xml:"resource"`
+}
+
+// readEvernote reads the notes of the .enex files of an Evernote export,
+// turning their content into Markdown.
+func readEvernote(fs files) ([]Note, error) {
+	var notes []Note
+	for _, name := range fs.names() {
+		if !strings.EqualFold(path.Ext(name), ".enex") {
+			continue
+		}
+		d := xml.NewDecoder(bytes.NewReader(fs[name].data))
+		d.Strict = false
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				break
+			}
+			start, ok := tok.(xml.StartElement)
+			if !ok || start.Name.Local != "note" {
+				continue
+			}
+			var e enexNote
+			if err := d.DecodeElement(&e, &start); err != nil {
+				return nil, err
+			}
+			n := Note{Title: e.Title, Tags: e.Tags}
+			n.Created, _ = time.Parse(ENEX_TIME, e.Created)
+			n.Modified, _ = time.Parse(ENEX_TIME, e.Updated)
+			if n.Modified.IsZero() {
+				n.Modified = n.Created
+			}
+			// Resources are referenced by the MD5 hash of their data
+			media := map[string]string{}
+			for i, r := range e.Resources {
+				data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(r.Data), ""))
+				if err != nil {
+					continue
+				}
+				sum := md5.Sum(data)
+				fileName := r.FileName
+				if fileName == "" {
+					fileName = fmt.Sprintf("attachment%d", i+1)
+					if exts, _ := mime.ExtensionsByType(r.Mime); len(exts) > 0 {
+						fileName += exts[0]
+					}
+				}
+				media[hex.EncodeToString(sum[:])] = n.attach(fileName, data)
+			}
+			n.Content = enmlToMarkdown(e.Content, media)
+			notes = append(notes, n)
+		}
+	}
+	return notes, nil
+}
+
+var blankLinesRe = regexp.MustCompile(`\n{3,}`)
+
+// enmlToMarkdown turns the ENML content of an Evernote note into Markdown.
+// media are the links to the attachments by hash.
+func enmlToMarkdown(enml string, media map[string]string) string {
+	d := xml.NewDecoder(strings.NewReader(enml))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	var b strings.Builder
+	var lists []string // Tags of the open lists
+	var hrefs []string // Targets of the open links
+	inPre := false
+	newline := func() {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	block := func() {
+		newline()
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+			b.WriteByte('\n')
+		}
+	}
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch tag := strings.ToLower(t.Name.Local); tag {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				block()
+				b.WriteString(strings.Repeat("#", int(tag[1]-'0')) + " ")
+			case "p", "div", "table", "blockquote":
+				if len(lists) == 0 {
+					newline()
+				}
+				if tag == "blockquote" {
+					b.WriteString("> ")
+				}
+			case "tr":
+				newline()
+			case "td", "th":
+				b.WriteString("| ")
+			case "br":
+				b.WriteByte('\n')
+			case "hr":
+				block()
+				b.WriteString("---\n")
+			case "ul", "ol":
+				if len(lists) == 0 {
+					block()
+				}
+				lists = append(lists, tag)
+			case "li":
+				newline()
+				b.WriteString(strings.Repeat("  ", max(len(lists)-1, 0)))
+				if len(lists) > 0 && lists[len(lists)-1] == "ol" {
+					b.WriteString("1. ")
+				} else {
+					b.WriteString("- ")
+				}
+			case "b", "strong":
+				b.WriteString("**")
+			case "i", "em":
+				b.WriteString("*")
+			case "code":
+				if !inPre {
+					b.WriteString("`")
+				}
+			case "pre":
+				block()
+				b.WriteString("```\n")
+				inPre = true
+			case "a":
+				href := ""
+				for _, at := range t.Attr {
+					if at.Name.Local == "href" {
+						href = at.Value
+					}
+				}
+				hrefs = append(hrefs, href)
+				b.WriteString("[")
+			case "en-todo":
+				box := "[ ] "
+				for _, at := range t.Attr {
+					if at.Name.Local == "checked" && at.Value == "true" {
+						box = "[x] "
+					}
+				}
+				if s := b.String(); s == "" || strings.HasSuffix(s, "\n") {
+					box = "- " + box
+				}
+				b.WriteString(box)
+			case "en-media":
+				for _, at := range t.Attr {
+					if link, ok := media[at.Value]; at.Name.Local == "hash" && ok {
+						b.WriteString(link)
+					}
+				}
+			}
+		case xml.EndElement:
+			switch tag := strings.ToLower(t.Name.Local); tag {
+			case "h1", "h2", "h3", "h4", "h5", "h6", "p", "blockquote":
+				if len(lists) == 0 {
+					block()
+				}
+			case "div", "li", "table":
+				newline()
+			case "ul", "ol":
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+				if len(lists) == 0 {
+					block()
+				}
+			case "b", "strong":
+				b.WriteString("**")
+			case "i", "em":
+				b.WriteString("*")
+			case "code":
+				if !inPre {
+					b.WriteString("`")
+				}
+			case "pre":
+				newline()
+				b.WriteString("```\n")
+				inPre = false
+			case "a":
+				if len(hrefs) > 0 {
+					b.WriteString("](" + hrefs[len(hrefs)-1] + ")")
+					hrefs = hrefs[:len(hrefs)-1]
+				}
+			}
+		case xml.CharData:
+			s := string(t)
+			if !inPre {
+				// Whitespace is collapsed like in HTML
+				s = strings.Join(strings.Fields(s), " ")
+				raw := string(t)
+				if strings.TrimLeftFunc(raw, unicode.IsSpace) != raw && !strings.HasSuffix(b.String(), "\n") {
+					s = " " + s
+				}
+				if strings.TrimRightFunc(raw, unicode.IsSpace) != raw && strings.TrimSpace(raw) != "" {
+					s += " "
+				}
+				if strings.TrimSpace(s) == "" && strings.HasSuffix(b.String(), " ") {
+					continue
+				}
+			}
+			b.WriteString(s)
+		}
+	}
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	return strings.TrimSpace(blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
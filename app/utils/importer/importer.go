@@ -0,0 +1,310 @@
+// Package importer reads notes exported by other note taking applications:
+// folders of Markdown and text files, Google Keep Takeout, Simplenote,
+// Evernote and Joplin exports.
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MAX_SIZE is the size above which exports are refused, they are read
+// into memory.
+const MAX_SIZE = 1 << 30
+
+// Note is an imported note. Its content references its attachments with
+// Markdown links to import:<index>, LinkAttachments rewrites them once the
+// attachments are stored.
+type Note struct {
+	Title       string
+	Content     string
+	Journal     string // Date of the day for journal notes
+	Folder      string
+	Tags        []string
+	Pinned      bool
+	Created     time.Time
+	Modified    time.Time
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an imported note.
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+type Kind int
+
+const (
+	Markdown Kind = iota // Markdown and text files
+	Keep                 // Google Keep Takeout
+	Simplenote
+	Evernote
+	Joplin
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Markdown:
+		return "Markdown"
+	case Keep:
+		return "Google Keep"
+	case Simplenote:
+		return "Simplenote"
+	case Evernote:
+		return "Evernote"
+	case Joplin:
+		return "Joplin"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// file is a file of an export.
+type file struct {
+	data     []byte
+	modified time.Time
+}
+
+// files are the files of an export by their slash separated path.
+type files map[string]file
+
+// names returns the paths of the files, sorted.
+func (fs files) names() []string {
+	var names []string
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Read reads the notes of the export at p, a file, a folder or a zip or tar
+// archive of one, and reports which application it comes from.
+func Read(p string) ([]Note, Kind, error) {
+	fs, err := load(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	kind := detect(fs)
+	var notes []Note
+	switch kind {
+	case Keep:
+		notes, err = readKeep(fs)
+	case Simplenote:
+		notes, err = readSimplenote(fs)
+	case Evernote:
+		notes, err = readEvernote(fs)
+	case Joplin:
+		notes, err = readJoplin(fs)
+	default:
+		notes, err = readMarkdown(fs)
+	}
+	return notes, kind, err
+}
+
+// load reads the files at p.
+func load(p string) (files, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadDir(p)
+	}
+	if info.Size() > MAX_SIZE {
+		return nil, errors.New("the export is too large")
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".zip":
+		return loadZip(data)
+	case ".jex", ".tar":
+		return loadTar(data)
+	}
+	return files{filepath.Base(p): {data, info.ModTime()}}, nil
+}
+
+func loadDir(dir string) (files, error) {
+	fs := files{}
+	size := int64(0)
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if size += info.Size(); size > MAX_SIZE {
+			return errors.New("the export is too large")
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		fs[filepath.ToSlash(rel)] = file{data, info.ModTime()}
+		return nil
+	})
+	return fs, err
+}
+
+func loadZip(data []byte) (files, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	fs := files{}
+	size := uint64(0)
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if size += f.UncompressedSize64; size > MAX_SIZE {
+			return nil, errors.New("the export is too large")
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		fs[path.Clean(f.Name)] = file{b, f.Modified}
+	}
+	return fs, nil
+}
+
+func loadTar(data []byte) (files, error) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	fs := files{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return fs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		fs[path.Clean(h.Name)] = file{b, h.ModTime}
+	}
+}
+
+var (
+	joplinTypeRe = regexp.MustCompile(`(?m)^type_: \d+$`)
+	joplinIDRe   = regexp.MustCompile(`(?m)^id: [0-9a-f]{32}$`)
+)
+
+// detect guesses which application the files come from.
+func detect(fs files) Kind {
+	kind := Markdown
+	for _, name := range fs.names() {
+		data := fs[name].data
+		switch strings.ToLower(path.Ext(name)) {
+		case ".enex":
+			return Evernote
+		case ".md":
+			if joplinTypeRe.Match(data) && joplinIDRe.Match(data) {
+				return Joplin
+			}
+		case ".json":
+			if bytes.Contains(data, []byte(`"activeNotes"`)) {
+				return Simplenote
+			}
+			if bytes.Contains(data, []byte(`"userEditedTimestampUsec"`)) {
+				kind = Keep
+			}
+		}
+	}
+	return kind
+}
+
+// Existing is a note the imported notes are compared with.
+type Existing struct {
+	ID, Title, Journal, Content string
+}
+
+// Match compares notes with the existing ones having their title. The
+// duplicates have the same content as them, the conflicts a different one
+// and map to the ID of the existing note.
+func Match(existing []Existing, notes []Note) (duplicates map[int]bool, conflicts map[int]string) {
+	duplicates, conflicts = map[int]bool{}, map[int]string{}
+	key := func(title, journal string) string {
+		return strings.ToLower(strings.TrimSpace(title)) + "\x00" + journal
+	}
+	byTitle := map[string]Existing{}
+	for _, e := range existing {
+		byTitle[key(e.Title, e.Journal)] = e
+	}
+	for k, n := range notes {
+		e, ok := byTitle[key(n.Title, n.Journal)]
+		switch {
+		case !ok:
+		case strings.TrimSpace(e.Content) == strings.TrimSpace(n.Content):
+			duplicates[k] = true
+		default:
+			conflicts[k] = e.ID
+		}
+	}
+	return duplicates, conflicts
+}
+
+// importRefRe matches the links to the attachments of imported notes.
+var importRefRe = regexp.MustCompile(`\]\(import:(\d+)\)`)
+
+// LinkAttachments replaces the links to the attachments of content, which
+// are import:<index>, with links to refs[index].
+func LinkAttachments(content string, refs []string) string {
+	return importRefRe.ReplaceAllStringFunc(content, func(m string) string {
+		k, _ := strconv.Atoi(importRefRe.FindStringSubmatch(m)[1])
+		if k >= len(refs) {
+			return m
+		}
+		return "](" + refs[k] + ")"
+	})
+}
+
+// attach adds the attachment name to n and returns the Markdown link to it.
+func (n *Note) attach(name string, data []byte) string {
+	n.Attachments = append(n.Attachments, Attachment{Name: name, Data: data})
+	link := fmt.Sprintf("[%s](import:%d)", strings.NewReplacer("[", "(", "]", ")").Replace(name), len(n.Attachments)-1)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp":
+		return "!" + link
+	}
+	return link
+}
+
+// splitTitle splits text into its first line, the title, and the rest.
+func splitTitle(text string) (string, string) {
+	text = strings.TrimLeft(text, "\n")
+	title, body, _ := strings.Cut(text, "\n")
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(title), "# ")), strings.TrimLeft(body, "\n")
+}
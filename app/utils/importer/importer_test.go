@@ -0,0 +1,388 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+// testFiles makes the files of an export from their contents.
+func testFiles(contents map[string]string) files {
+	fs := files{}
+	for name, data := range contents {
+		fs[name] = file{[]byte(data), t0}
+	}
+	return fs
+}
+
+const keepNoteJSON = `{
+	"title": "Groceries",
+	"textContent": "",
+	"listContent": [{"text": "milk", "isChecked": true}, {"text": "eggs", "isChecked": false}],
+	"labels": [{"name": "home"}],
+	"attachments": [{"filePath": "photo.jpeg"}],
+	"isPinned": true,
+	"isArchived": true,
+	"createdTimestampUsec": 1714554000000000,
+	"userEditedTimestampUsec": 1714557600000000
+}`
+
+const simplenoteJSON = `{"activeNotes": [
+	{"content": "Groceries\r\n\r\n- milk", "creationDate": "2024-05-01T09:00:00Z", "lastModified": "2024-05-02T09:00:00Z", "tags": ["home"], "pinned": true}
+], "trashedNotes": [{"content": "Gone"}]}`
+
+const joplinFolder = `Work
+
+id: 11111111111111111111111111111111
+parent_id:
+type_: 2`
+
+const joplinSubfolder = `Projects
+
+id: 22222222222222222222222222222222
+parent_id: 11111111111111111111111111111111
+type_: 2`
+
+const joplinNote = `Plan
+
+See ![diagram](:/33333333333333333333333333333333) and [it again](:/33333333333333333333333333333333).
+
+id: 44444444444444444444444444444444
+parent_id: 22222222222222222222222222222222
+is_todo: 1
+is_conflict: 0
+user_created_time: 2024-05-01T09:00:00.000Z
+user_updated_time: 2024-05-02T09:00:00.000Z
+deleted_time:
+type_: 1`
+
+const joplinResource = `diagram.png
+
+id: 33333333333333333333333333333333
+mime: image/png
+type_: 4`
+
+const joplinTag = `urgent
+
+id: 55555555555555555555555555555555
+type_: 5`
+
+const joplinNoteTag = `id: 66666666666666666666666666666666
+note_id: 44444444444444444444444444444444
+tag_id: 55555555555555555555555555555555
+type_: 6`
+
+const joplinConflict = `Plan
+
+id: 77777777777777777777777777777777
+is_conflict: 1
+type_: 1`
+
+const joplinDeleted = `Old
+
+id: 88888888888888888888888888888888
+deleted_time: 2024-05-03T09:00:00.000Z
+type_: 1`
+
+func enex(content string, resources ...[]byte) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export3.dtd">
+<en-export><note><title>Trip</title><content><![CDATA[<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-note SYSTEM "http://xml.evernote.com/pub/enml2.dtd">
+<en-note>` + content + `</en-note>]]></content>
+<created>20240501T090000Z</created><updated>20240502T090000Z</updated><tag>travel</tag>`)
+	for _, r := range resources {
+		b.WriteString(`<resource><data encoding="base64">` + base64.StdEncoding.EncodeToString(r) +
+			`</data><mime>image/png</mime><resource-attributes><file-name>map.png</file-name></resource-attributes></resource>`)
+	}
+	b.WriteString(`</note></en-export>`)
+	return b.String()
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  Kind
+	}{
+		{"markdown", map[string]string{"a.md": "# A", "b.txt": "B"}, Markdown},
+		{"keep", map[string]string{"Takeout/Keep/a.json": keepNoteJSON, "Takeout/Keep/a.html": "<html>"}, Keep},
+		{"simplenote", map[string]string{"source/notes.json": simplenoteJSON}, Simplenote},
+		{"evernote", map[string]string{"notes.enex": enex("<div>x</div>")}, Evernote},
+		{"joplin", map[string]string{"11111111111111111111111111111111.md": joplinFolder}, Joplin},
+		// Markdown files that only look a bit like Joplin items
+		{"markdown with fields", map[string]string{"a.md": "# A\n\ntype_: 1"}, Markdown},
+		{"other json", map[string]string{"data.json": `{"notes": []}`}, Markdown},
+	}
+	for _, tt := range tests {
+		if got := detect(testFiles(tt.files)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	fs := testFiles(map[string]string{
+		"Front.md":        "\ufeff---\r\ntitle: \"Front matter\"\r\ntags: [work, \"#plans\"]\r\nmodified: 2024-05-02T09:00:00Z\r\n---\r\n\r\nBody\r\n",
+		"Work/heading.md": "# Heading title\n\n![map](../img/map%20v2.png) [again](../img/map%20v2.png) [other](other.md) [web](https://example.com/a.png)",
+		"Work/plain.txt":  "No heading",
+		"journal.md":      "---\njournal: 2024-05-01\ntags:\n  - a\n  - b\n---\nDear diary",
+		"img/map v2.png":  "png",
+		"Work/other.md":   "Other",
+		"notes.pdf":       "not a note",
+	})
+	notes, err := readMarkdown(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byTitle := map[string]Note{}
+	for _, n := range notes {
+		byTitle[n.Title] = n
+	}
+	if len(notes) != 5 {
+		t.Fatalf("got %d notes, want 5", len(notes))
+	}
+
+	n := byTitle["Front matter"]
+	if n.Content != "Body\n" || !slices.Equal(n.Tags, []string{"work", "plans"}) || !n.Modified.Equal(t0.Add(24*time.Hour)) {
+		t.Errorf("got %+v, want the fields of the front matter", n)
+	}
+	n = byTitle["Heading title"]
+	want := "![map](import:0) [again](import:0) [other](other.md) [web](https://example.com/a.png)"
+	if n.Folder != "Work" || n.Content != want || len(n.Attachments) != 1 || n.Attachments[0].Name != "map v2.png" {
+		t.Errorf("got %+v, want content %q with one attachment", n, want)
+	}
+	if n := byTitle["plain"]; n.Content != "No heading" || n.Folder != "Work" || !n.Modified.Equal(t0) {
+		t.Errorf("got %+v, want the file name as title", n)
+	}
+	if n := byTitle["journal"]; n.Journal != "2024-05-01" || n.Folder != "" || !slices.Equal(n.Tags, []string{"a", "b"}) {
+		t.Errorf("got %+v, want a journal note", n)
+	}
+}
+
+func TestReadKeep(t *testing.T) {
+	fs := testFiles(map[string]string{
+		"Keep/groceries.json": keepNoteJSON,
+		// Takeout changed the extension of the photo
+		"Keep/photo.jpg":     "jpeg",
+		"Keep/untitled.json": `{"textContent": "First line\nSecond line", "userEditedTimestampUsec": 1714554000000000}`,
+		"Keep/trashed.json":  `{"title": "Trashed", "isTrashed": true, "userEditedTimestampUsec": 1714554000000000}`,
+		"Keep/broken.json":   `{"title": `,
+		"Keep/labels.json":   `[{"name": "home"}]`,
+	})
+	notes, err := readKeep(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("got %d notes, want 2", len(notes))
+	}
+	n := notes[0]
+	want := "- [x] milk\n- [ ] eggs\n\n![photo.jpg](import:0)"
+	if n.Title != "Groceries" || n.Content != want || !n.Pinned || n.Folder != "Archive" || !slices.Equal(n.Tags, []string{"home"}) {
+		t.Errorf("got %+v, want content %q", n, want)
+	}
+	if !n.Created.Equal(t0) || !n.Modified.Equal(t0.Add(time.Hour)) {
+		t.Errorf("got times %v %v", n.Created, n.Modified)
+	}
+	if len(n.Attachments) != 1 || string(n.Attachments[0].Data) != "jpeg" {
+		t.Errorf("got attachments %+v", n.Attachments)
+	}
+	if n := notes[1]; n.Title != "First line" || !n.Created.Equal(n.Modified) {
+		t.Errorf("got %+v, want the first line as title", n)
+	}
+}
+
+func TestReadSimplenote(t *testing.T) {
+	notes, err := readSimplenote(testFiles(map[string]string{"notes.json": simplenoteJSON}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("got %d notes, want 1", len(notes))
+	}
+	n := notes[0]
+	if n.Title != "Groceries" || n.Content != "- milk" || !n.Pinned || !slices.Equal(n.Tags, []string{"home"}) ||
+		!n.Created.Equal(t0) || !n.Modified.Equal(t0.Add(24*time.Hour)) {
+		t.Errorf("got %+v", n)
+	}
+	if _, err := readSimplenote(testFiles(map[string]string{"notes.json": `{"activeNotes": [`})); err == nil {
+		t.Error("got no error for a damaged export")
+	}
+}
+
+func TestReadEvernote(t *testing.T) {
+	png := []byte("png data")
+	sum := md5.Sum(png)
+	content := `<h1>Day one</h1><div>Took the <b>train</b> to <a href="https://example.com">Lyon</a>.</div>` +
+		`<ul><li>Museum</li><li>Food<ul><li>Cheese</li></ul></li></ul>` +
+		`<div><en-todo checked="true"/>Book hotel</div><div><en-todo/>Pack</div>` +
+		`<div><en-media type="image/png" hash="` + hex.EncodeToString(sum[:]) + `"/></div>` +
+		`<pre>a  b</pre><div>Caf&eacute;&nbsp;au lait</div>`
+	notes, err := readEvernote(testFiles(map[string]string{"trip.enex": enex(content, png)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("got %d notes, want 1", len(notes))
+	}
+	n := notes[0]
+	want := "# Day one\n\nTook the **train** to [Lyon](https://example.com).\n\n- Museum\n- Food\n  - Cheese\n\n" +
+		"- [x] Book hotel\n- [ ] Pack\n![map.png](import:0)\n\n```\na  b\n```\nCafé au lait"
+	if n.Content != want {
+		t.Errorf("got content\n%q\nwant\n%q", n.Content, want)
+	}
+	if n.Title != "Trip" || !slices.Equal(n.Tags, []string{"travel"}) || !n.Created.Equal(t0) || !n.Modified.Equal(t0.Add(24*time.Hour)) {
+		t.Errorf("got %+v", n)
+	}
+	if len(n.Attachments) != 1 || !bytes.Equal(n.Attachments[0].Data, png) {
+		t.Errorf("got attachments %+v", n.Attachments)
+	}
+}
+
+func TestReadJoplin(t *testing.T) {
+	fs := testFiles(map[string]string{
+		"11111111111111111111111111111111.md":            joplinFolder,
+		"22222222222222222222222222222222.md":            joplinSubfolder,
+		"33333333333333333333333333333333.md":            joplinResource,
+		"44444444444444444444444444444444.md":            joplinNote,
+		"55555555555555555555555555555555.md":            joplinTag,
+		"66666666666666666666666666666666.md":            joplinNoteTag,
+		"77777777777777777777777777777777.md":            joplinConflict,
+		"88888888888888888888888888888888.md":            joplinDeleted,
+		"resources/33333333333333333333333333333333.png": "png data",
+	})
+	notes, err := readJoplin(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 {
+		t.Fatalf("got %d notes, want only the one neither conflicting nor deleted", len(notes))
+	}
+	n := notes[0]
+	want := "See ![diagram](import:0) and [it again](import:0)."
+	if n.Title != "Plan" || n.Content != want || n.Folder != "Work/Projects" || !slices.Equal(n.Tags, []string{"urgent", "todo"}) {
+		t.Errorf("got %+v, want content %q", n, want)
+	}
+	if !n.Created.Equal(t0) || !n.Modified.Equal(t0.Add(24*time.Hour)) {
+		t.Errorf("got times %v %v", n.Created, n.Modified)
+	}
+	if len(n.Attachments) != 1 || n.Attachments[0].Name != "diagram.png" || string(n.Attachments[0].Data) != "png data" {
+		t.Errorf("got attachments %+v", n.Attachments)
+	}
+}
+
+func TestRead(t *testing.T) {
+	contents := map[string]string{"notes/a.md": "# A\n\nFrom an archive", "notes/b.txt": "B"}
+	dir := t.TempDir()
+
+	// A folder
+	for name, data := range contents {
+		p := filepath.Join(dir, "folder", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A zip of it
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	for name, data := range contents {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	if err := os.WriteFile(filepath.Join(dir, "export.zip"), zbuf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A tar of it
+	var tbuf bytes.Buffer
+	tw := tar.NewWriter(&tbuf)
+	for name, data := range contents {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	if err := os.WriteFile(filepath.Join(dir, "export.tar"), tbuf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"folder", "export.zip", "export.tar"} {
+		notes, kind, err := Read(filepath.Join(dir, p))
+		if err != nil {
+			t.Errorf("%s: %v", p, err)
+			continue
+		}
+		if kind != Markdown || len(notes) != 2 || notes[0].Title != "A" || notes[0].Folder != "notes" {
+			t.Errorf("%s: got %v %+v", p, kind, notes)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.zip"), []byte("PK not really"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Read(filepath.Join(dir, "broken.zip")); err == nil {
+		t.Error("got no error for a damaged zip")
+	}
+	if _, _, err := Read(filepath.Join(dir, "missing")); err == nil {
+		t.Error("got no error for a missing export")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	existing := []Existing{
+		{ID: "1", Title: "Groceries", Content: "- milk\n"},
+		{ID: "2", Title: "Ideas", Content: "Some"},
+		{ID: "3", Title: "2024-05-01", Journal: "2024-05-01", Content: "Dear diary"},
+	}
+	notes := []Note{
+		{Title: " groceries ", Content: "- milk"},
+		{Title: "Ideas", Content: "Others"},
+		{Title: "New", Content: "Some"},
+		{Title: "2024-05-01", Content: "Dear diary"},
+		{Title: "2024-05-01", Journal: "2024-05-01", Content: "Other day"},
+	}
+	duplicates, conflicts := Match(existing, notes)
+	if len(duplicates) != 1 || !duplicates[0] {
+		t.Errorf("got duplicates %v, want the first note", duplicates)
+	}
+	// A regular note doesn't conflict with the journal note of its title
+	if len(conflicts) != 2 || conflicts[1] != "2" || conflicts[4] != "3" {
+		t.Errorf("got conflicts %v, want the second and last notes", conflicts)
+	}
+}
+
+func TestLinkAttachments(t *testing.T) {
+	tests := []struct {
+		content string
+		refs    []string
+		want    string
+	}{
+		{"![a](import:0) [b](import:1)", []string{"attachment:0a.png", "attachment:1b"}, "![a](attachment:0a.png) [b](attachment:1b)"},
+		// Attachments which couldn't be stored keep their link
+		{"[a](import:2)", []string{"x"}, "[a](import:2)"},
+		{"[a](import:0) and [text](import:x)", []string{"attachment:0a"}, "[a](attachment:0a) and [text](import:x)"},
+		{"No links", nil, "No links"},
+	}
+	for _, tt := range tests {
+		if got := LinkAttachments(tt.content, tt.refs); got != tt.want {
+			t.Errorf("LinkAttachments(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package importer
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Types of Joplin items
+const (
+	JOPLIN_NOTE     = "1"
+	JOPLIN_FOLDER   = "2"
+	JOPLIN_RESOURCE = "4"
+	JOPLIN_TAG      = "5"
+	JOPLIN_NOTE_TAG = "6"
+)
+
+var (
+	joplinFieldRe = regexp.MustCompile(`^([a-z_]+): ?(.*)$`)
+	// Links to resources are :/<id>
+	joplinRefRe = regexp.MustCompile(`\]\(:/([0-9a-f]{32})\)`)
+)
+
+// joplinItem is an item of a Joplin export: notes, folders, tags and
+// resources all are Markdown files ending with their fields.
+type joplinItem struct {
+	title, body string
+	fields      map[string]string
+}
+
+// parseJoplinItem splits the text of an item into its title, body and
+// fields.
+func parseJoplinItem(text string) joplinItem {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	item := joplinItem{fields: map[string]string{}}
+	i := len(lines)
+	for i > 0 {
+		m := joplinFieldRe.FindStringSubmatch(lines[i-1])
+		if m == nil {
+			break
+		}
+		item.fields[m[1]] = m[2]
+		i--
+	}
+	item.title, item.body = splitTitle(strings.Join(lines[:i], "\n"))
+	item.body = strings.TrimRight(item.body, "\n")
+	return item
+}
+
+func (it joplinItem) time(field string) time.Time {
+	t, _ := time.Parse(time.RFC3339, it.fields[field])
+	return t
+}
+
+// readJoplin reads a Joplin export, RAW folders and JEX archives alike.
+// Folders are nested into paths like Work/Projects. Todos are tagged todo,
+// conflicting and deleted notes are left out.
+func readJoplin(fs files) ([]Note, error) {
+	items := map[string]joplinItem{}
+	var ids []string
+	for _, name := range fs.names() {
+		if path.Dir(name) != "." || !strings.EqualFold(path.Ext(name), ".md") {
+			continue
+		}
+		it := parseJoplinItem(string(fs[name].data))
+		if id := it.fields["id"]; id != "" {
+			items[id] = it
+			ids = append(ids, id)
+		}
+	}
+	// Resource files are named after their id
+	resources := map[string]string{}
+	for _, name := range fs.names() {
+		if path.Dir(name) == "resources" {
+			id := strings.TrimSuffix(path.Base(name), path.Ext(name))
+			resources[id] = name
+		}
+	}
+	folderPath := func(id string) string {
+		var parts []string
+		for seen := 0; id != "" && seen < 32; seen++ {
+			f, ok := items[id]
+			if !ok || f.fields["type_"] != JOPLIN_FOLDER {
+				break
+			}
+			parts = append([]string{strings.ReplaceAll(f.title, "/", "-")}, parts...)
+			id = f.fields["parent_id"]
+		}
+		return strings.Join(parts, "/")
+	}
+	tags := map[string][]string{}
+	for _, id := range ids {
+		if it := items[id]; it.fields["type_"] == JOPLIN_NOTE_TAG {
+			if tag, ok := items[it.fields["tag_id"]]; ok {
+				tags[it.fields["note_id"]] = append(tags[it.fields["note_id"]], tag.title)
+			}
+		}
+	}
+
+	var notes []Note
+	for _, id := range ids {
+		it := items[id]
+		if it.fields["type_"] != JOPLIN_NOTE || it.fields["is_conflict"] == "1" || !it.time("deleted_time").IsZero() {
+			continue
+		}
+		n := Note{
+			Title:    it.title,
+			Folder:   folderPath(it.fields["parent_id"]),
+			Tags:     tags[id],
+			Created:  it.time("user_created_time"),
+			Modified: it.time("user_updated_time"),
+		}
+		if n.Created.IsZero() {
+			n.Created = it.time("created_time")
+		}
+		if n.Modified.IsZero() {
+			n.Modified = it.time("updated_time")
+		}
+		if it.fields["is_todo"] == "1" {
+			n.Tags = append(n.Tags, "todo")
+		}
+		linked := map[string]string{}
+		n.Content = joplinRefRe.ReplaceAllStringFunc(it.body, func(m string) string {
+			rid := joplinRefRe.FindStringSubmatch(m)[1]
+			if link, ok := linked[rid]; ok {
+				return link
+			}
+			file, ok := resources[rid]
+			if !ok {
+				return m
+			}
+			name := items[rid].title
+			if name == "" {
+				name = path.Base(file)
+			}
+			link := n.attach(name, fs[file].data)
+			// Only the target changes, the text and ! stay
+			link = link[strings.Index(link, "]"):]
+			linked[rid] = link
+			return link
+		})
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
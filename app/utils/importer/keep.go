@@ -0,0 +1,95 @@
+package importer
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+)
+
+// keepNote is a note of a Google Keep Takeout, every note has a JSON file.
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Attachments []struct {
+		FilePath string `json:"filePath"`
+	} `json:"attachments"`
+	IsPinned                bool  `json:"isPinned"`
+	IsArchived              bool  `json:"isArchived"`
+	IsTrashed               bool  `json:"isTrashed"`
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+}
+
+// readKeep reads the JSON files of a Google Keep Takeout. Labels become tags,
+// lists become task lists and archived notes go to the Archive folder.
+// Trashed notes are left out.
+func readKeep(fs files) ([]Note, error) {
+	var notes []Note
+	for _, name := range fs.names() {
+		if !strings.EqualFold(path.Ext(name), ".json") {
+			continue
+		}
+		var k keepNote
+		if err := json.Unmarshal(fs[name].data, &k); err != nil || k.UserEditedTimestampUsec == 0 || k.IsTrashed {
+			continue
+		}
+		n := Note{
+			Title:    k.Title,
+			Content:  k.TextContent,
+			Pinned:   k.IsPinned,
+			Created:  time.UnixMicro(k.CreatedTimestampUsec),
+			Modified: time.UnixMicro(k.UserEditedTimestampUsec),
+		}
+		if k.CreatedTimestampUsec == 0 {
+			n.Created = n.Modified
+		}
+		if n.Title == "" {
+			n.Title, _ = splitTitle(n.Content)
+		}
+		var lines []string
+		for _, item := range k.ListContent {
+			box := "[ ]"
+			if item.IsChecked {
+				box = "[x]"
+			}
+			lines = append(lines, "- "+box+" "+item.Text)
+		}
+		if len(lines) != 0 {
+			n.Content = strings.Join(lines, "\n")
+		}
+		for _, l := range k.Labels {
+			n.Tags = append(n.Tags, l.Name)
+		}
+		if k.IsArchived {
+			n.Folder = "Archive"
+		}
+		for _, at := range k.Attachments {
+			// Files are next to the note, Takeout sometimes changes their
+			// extension
+			p := path.Join(path.Dir(name), at.FilePath)
+			f, ok := fs[p]
+			if !ok {
+				base := strings.TrimSuffix(p, path.Ext(p))
+				for _, ext := range []string{".jpg", ".jpeg", ".png", ".gif", ".webp"} {
+					if f, ok = fs[base+ext]; ok {
+						p = base + ext
+						break
+					}
+				}
+			}
+			if ok {
+				n.Content = strings.TrimRight(n.Content, "\n") + "\n\n" + n.attach(path.Base(p), f.data)
+			}
+		}
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
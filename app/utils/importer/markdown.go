@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localLinkRe matches Markdown links and images, the target is the second
+// group.
+var localLinkRe = regexp.MustCompile(`(!?\[[^\]\n]*\])\(([^)\s]+)\)`)
+
+// readMarkdown reads every .md and .txt file as a note. The title comes from
+// the front matter, the first line if it is a heading, or the name of the
+// file. Notes are put in folders named after the folders of the files.
+// Links to other files of the export become attachments.
+func readMarkdown(fs files) ([]Note, error) {
+	var notes []Note
+	for _, name := range fs.names() {
+		ext := strings.ToLower(path.Ext(name))
+		if ext != ".md" && ext != ".markdown" && ext != ".txt" {
+			continue
+		}
+		text := strings.ReplaceAll(strings.TrimPrefix(string(fs[name].data), "\ufeff"), "\r\n", "\n")
+		n := Note{}
+		meta, body := frontMatter(text)
+		n.Title, n.Folder, n.Journal = unquote(meta["title"]), unquote(meta["folder"]), meta["journal"]
+		n.Tags = meta.list("tags")
+		n.Modified = parseTime(meta["modified"])
+		n.Created = parseTime(meta["created"])
+		if n.Created.IsZero() {
+			n.Created = parseTime(meta["date"])
+		}
+		if n.Modified.IsZero() {
+			n.Modified = fs[name].modified
+		}
+		if n.Created.IsZero() {
+			n.Created = n.Modified
+		}
+		if n.Title == "" {
+			first, rest := splitTitle(body)
+			if strings.HasPrefix(strings.TrimSpace(body), "# ") {
+				n.Title, body = first, rest
+			} else {
+				n.Title = strings.TrimSuffix(path.Base(name), path.Ext(name))
+			}
+		}
+		if dir := path.Dir(name); n.Folder == "" && n.Journal == "" && dir != "." {
+			n.Folder = dir
+		}
+		// Keep the files the note links to
+		linked := map[string]string{}
+		n.Content = localLinkRe.ReplaceAllStringFunc(body, func(m string) string {
+			sub := localLinkRe.FindStringSubmatch(m)
+			target := sub[2]
+			if strings.Contains(target, ":") {
+				return m
+			}
+			if t, err := url.PathUnescape(target); err == nil {
+				target = t
+			}
+			p := path.Join(path.Dir(name), target)
+			f, ok := fs[p]
+			if !ok || strings.HasSuffix(p, ".md") {
+				return m
+			}
+			// Only the target changes, the text and ! stay
+			ref, ok := linked[p]
+			if !ok {
+				link := n.attach(path.Base(p), f.data)
+				ref = link[strings.Index(link, "]")+1:]
+				linked[p] = ref
+			}
+			return sub[1] + ref
+		})
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
+
+// metadata are the fields of a front matter.
+type metadata map[string]string
+
+// list returns the field key as a list, written [a, b] or as YAML items.
+func (m metadata) list(key string) []string {
+	v := strings.TrimSpace(m[key])
+	var items []string
+	switch {
+	case strings.HasPrefix(v, "["):
+		items = strings.Split(strings.Trim(v, "[]"), ",")
+	case strings.Contains(v, "\n"):
+		for _, line := range strings.Split(v, "\n") {
+			items = append(items, strings.TrimPrefix(strings.TrimSpace(line), "- "))
+		}
+	default:
+		items = strings.Fields(v)
+	}
+	var list []string
+	for _, item := range items {
+		if item = strings.TrimPrefix(unquote(item), "#"); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// frontMatter splits the YAML front matter of text from its body. Only
+// the simple key: value fields and lists of items exporters write are
+// understood.
+func frontMatter(text string) (metadata, string) {
+	meta := metadata{}
+	if !strings.HasPrefix(text, "---\n") {
+		return meta, text
+	}
+	end := strings.Index(text[4:], "\n---")
+	if end < 0 {
+		return meta, text
+	}
+	key := ""
+	for _, line := range strings.Split(text[4:4+end], "\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "-") {
+			key = strings.ToLower(strings.TrimSpace(k))
+			meta[key] = strings.TrimSpace(v)
+		} else if key != "" {
+			meta[key] += "\n" + line
+		}
+	}
+	return meta, strings.TrimLeft(text[4+end+4:], "\n")
+}
+
+// unquote removes the quotes around s, if any.
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return strings.Trim(s, `'"`)
+}
+
+// parseTime parses the dates exporters commonly write.
+func parseTime(s string) time.Time {
+	s = unquote(s)
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,47 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+)
+
+// simplenoteExport is the notes.json file of a Simplenote export.
+type simplenoteExport struct {
+	ActiveNotes []struct {
+		Content      string    `json:"content"`
+		CreationDate time.Time `json:"creationDate"`
+		LastModified time.Time `json:"lastModified"`
+		Tags         []string  `json:"tags"`
+		Pinned       bool      `json:"pinned"`
+	} `json:"activeNotes"`
+}
+
+// readSimplenote reads the notes.json file of a Simplenote export. The first
+// line of notes is their title, trashed notes are left out.
+func readSimplenote(fs files) ([]Note, error) {
+	var notes []Note
+	for _, name := range fs.names() {
+		if !strings.EqualFold(path.Ext(name), ".json") || !bytes.Contains(fs[name].data, []byte(`"activeNotes"`)) {
+			continue
+		}
+		var export simplenoteExport
+		if err := json.Unmarshal(fs[name].data, &export); err != nil {
+			return nil, err
+		}
+		for _, s := range export.ActiveNotes {
+			title, body := splitTitle(strings.ReplaceAll(s.Content, "\r\n", "\n"))
+			notes = append(notes, Note{
+				Title:    title,
+				Content:  body,
+				Tags:     s.Tags,
+				Pinned:   s.Pinned,
+				Created:  s.CreationDate,
+				Modified: s.LastModified,
+			})
+		}
+	}
+	return notes, nil
+}
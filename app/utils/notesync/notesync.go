@@ -0,0 +1,669 @@
+// Package notesync syncs the notes of several devices through a shared
+// folder, such as a synced directory or a NAS. Each device writes what it
+// changed in a note as an encrypted change record, and folds the records of
+// the others into its notes: the last writer of each field wins, deletes are
+// tombstones which win over older changes. The devices converge whatever the
+// order they sync in, and can edit offline in between.
+package notesync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+	"github.com/deoxyimran/keeper/app/utils/backup"
+)
+
+const (
+	VERSION = 1
+	// Folder of the sync in the shared folder
+	SYNC_DIR        = "keeper-sync"
+	KEY_FILE        = "key.json"
+	CHANGES_DIR     = "changes"
+	ATTACHMENTS_DIR = "attachments"
+	RECORD_EXT      = ".rec"
+	// Files of the sync in the data directory
+	STATE_FILE = "sync.json"
+	LOCK_FILE  = "sync.lock"
+	// Plain text of the key check
+	CHECK = "keeper-sync"
+)
+
+var (
+	ErrPassphrase = errors.New("wrong sync passphrase")
+	ErrNoFolder   = errors.New("no sync folder")
+)
+
+// iterations of PBKDF2 deriving the key of new sync folders.
+var iterations = backup.ITERATIONS
+
+// Note ids are file names in the shared folder.
+var noteIDRe = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// Result tells what a sync did.
+type Result struct {
+	// Change records written
+	Sent int `json:"sent"`
+	// Notes added or changed, and deleted, from the other devices
+	Received int `json:"received"`
+	Deleted  int `json:"deleted"`
+}
+
+// keyFile is the key file of a sync folder. The key is derived from the
+// passphrase, the check is CHECK encrypted with it.
+type keyFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Check      []byte `json:"check"`
+}
+
+// change is a change record: the fields a device changed in a note, or its
+// deletion.
+type change struct {
+	Note    string                     `json:"note"`
+	Device  string                     `json:"device"`
+	Time    time.Time                  `json:"time"`
+	Fields  map[string]json.RawMessage `json:"fields,omitempty"`
+	Deleted bool                       `json:"deleted,omitempty"`
+}
+
+// version is who changed a field or deleted a note, and when.
+type version struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	// Hash of the field value
+	Hash string `json:"hash,omitempty"`
+}
+
+// after reports whether v wins over o, the device breaks ties.
+func (v version) after(o version) bool {
+	return v.Time.After(o.Time) || v.Time.Equal(o.Time) && v.Device > o.Device
+}
+
+// noteState is a note as of the last sync.
+type noteState struct {
+	Fields  map[string]version `json:"fields"`
+	Deleted *version           `json:"deleted,omitempty"`
+	// Change records read
+	Records int `json:"records"`
+}
+
+// deleted reports whether the tombstone wins over every field.
+func (n *noteState) deleted() bool {
+	if n.Deleted == nil {
+		return false
+	}
+	for _, v := range n.Fields {
+		if !n.Deleted.after(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// state is the sync state of a data directory.
+type state struct {
+	Device string                `json:"device"`
+	Notes  map[string]*noteState `json:"notes"`
+}
+
+// syncer syncs a store with a sync folder.
+type syncer struct {
+	store *store.Store
+	dir   string
+	gcm   cipher.AEAD
+	state state
+	res   Result
+}
+
+// Sync syncs the notes and attachments of st with the shared folder dir,
+// encrypted with passphrase. The first sync sets the passphrase of the
+// folder.
+func Sync(st *store.Store, dir, passphrase string) (Result, error) {
+	if dir == "" {
+		return Result{}, ErrNoFolder
+	}
+	if passphrase == "" {
+		return Result{}, errors.New("the sync passphrase is empty")
+	}
+	unlock, err := st.LockFile(LOCK_FILE)
+	if err != nil {
+		return Result{}, err
+	}
+	defer unlock()
+
+	s := &syncer{store: st, dir: filepath.Join(dir, SYNC_DIR)}
+	if s.gcm, err = openKey(s.dir, passphrase); err != nil {
+		return Result{}, err
+	}
+	if err := s.loadState(); err != nil {
+		return Result{}, err
+	}
+	// Attachments first, so that notes never refer to missing ones
+	if err := s.sendAttachments(); err != nil {
+		return s.res, err
+	}
+	if err := s.send(); err != nil {
+		return s.res, err
+	}
+	if err := s.receive(); err != nil {
+		return s.res, err
+	}
+	return s.res, s.saveState()
+}
+
+// openKey derives the key of the sync folder dir from passphrase, making
+// the folder if there is none.
+func openKey(dir, passphrase string) (cipher.AEAD, error) {
+	if err := os.MkdirAll(filepath.Join(dir, CHANGES_DIR), os.ModePerm); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, KEY_FILE)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newKey(path, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var k keyFile
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if k.Version != VERSION {
+		return nil, fmt.Errorf("unsupported sync version %d", k.Version)
+	}
+	gcm, err := newGCM(passphrase, k.Salt, k.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := open(gcm, k.Check, KEY_FILE); err != nil || string(check) != CHECK {
+		return nil, ErrPassphrase
+	}
+	return gcm, nil
+}
+
+// newKey writes the key file path for passphrase. If another device wrote
+// one meanwhile, that one is used.
+func newKey(path, passphrase string) (cipher.AEAD, error) {
+	k := keyFile{Version: VERSION, Iterations: iterations, Salt: make([]byte, backup.SALT_LEN)}
+	if _, err := rand.Read(k.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, k.Salt, k.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if k.Check, err = seal(gcm, []byte(CHECK), KEY_FILE); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		return openKey(filepath.Dir(path), passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(data)
+	if err = errors.Join(err, f.Close()); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return gcm, nil
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if len(salt) == 0 || iterations <= 0 {
+		return nil, errors.New("the sync key file is damaged")
+	}
+	block, err := aes.NewCipher(backup.PBKDF2([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts data, bound to name so that files can't be swapped.
+func seal(gcm cipher.AEAD, data []byte, name string) ([]byte, error) {
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, []byte(name)), nil
+}
+
+func open(gcm cipher.AEAD, data []byte, name string) ([]byte, error) {
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("too short")
+	}
+	n := gcm.NonceSize()
+	return gcm.Open(nil, data[:n], data[n:], []byte(name))
+}
+
+func (s *syncer) loadState() error {
+	data, err := os.ReadFile(filepath.Join(s.store.Dir, STATE_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			return fmt.Errorf("%s: %w", STATE_FILE, err)
+		}
+	}
+	if s.state.Device == "" {
+		s.state.Device = store.NewID()
+	}
+	if s.state.Notes == nil {
+		s.state.Notes = map[string]*noteState{}
+	}
+	return nil
+}
+
+func (s *syncer) saveState() error {
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.store.Dir, STATE_FILE)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// values returns the fields of r, merged one by one, encoded.
+func values(r store.Record) map[string]json.RawMessage {
+	tags := r.Tags
+	if len(tags) == 0 {
+		tags = nil
+	}
+	vals := map[string]json.RawMessage{}
+	for f, v := range map[string]any{
+		"title":   r.Title,
+		"content": r.Content,
+		"journal": r.Journal,
+		"folder":  r.Folder,
+		"tags":    tags,
+		"pinned":  r.Pinned,
+	} {
+		vals[f], _ = json.Marshal(v)
+	}
+	return vals
+}
+
+// setField sets the field f of r to the encoded value.
+func setField(r *store.Record, f string, value json.RawMessage) error {
+	switch f {
+	case "title":
+		return json.Unmarshal(value, &r.Title)
+	case "content":
+		return json.Unmarshal(value, &r.Content)
+	case "journal":
+		return json.Unmarshal(value, &r.Journal)
+	case "folder":
+		return json.Unmarshal(value, &r.Folder)
+	case "tags":
+		r.Tags = nil
+		return json.Unmarshal(value, &r.Tags)
+	case "pinned":
+		return json.Unmarshal(value, &r.Pinned)
+	}
+	return nil
+}
+
+func hash(value json.RawMessage) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:16])
+}
+
+// send writes the change records of what changed in the notes since the
+// last sync.
+func (s *syncer) send() error {
+	records, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+	local := map[string]bool{}
+	for _, r := range records {
+		if !noteIDRe.MatchString(r.ID) {
+			continue
+		}
+		local[r.ID] = true
+		n := s.state.Notes[r.ID]
+		c := change{Note: r.ID, Device: s.state.Device, Time: r.Modified, Fields: map[string]json.RawMessage{}}
+		for f, v := range values(r) {
+			if n != nil && n.Fields[f].Hash == hash(v) && !n.deleted() {
+				continue
+			}
+			c.Fields[f] = v
+			// A change wins over what it changed, whatever the clocks say
+			if n != nil && !c.Time.After(n.Fields[f].Time) {
+				c.Time = n.Fields[f].Time.Add(time.Nanosecond)
+			}
+		}
+		if len(c.Fields) == 0 {
+			continue
+		}
+		if n != nil && n.Deleted != nil && !c.Time.After(n.Deleted.Time) {
+			c.Time = n.Deleted.Time.Add(time.Nanosecond)
+		}
+		if err := s.write(c); err != nil {
+			return err
+		}
+	}
+	for id, n := range s.state.Notes {
+		if local[id] || n.deleted() {
+			continue
+		}
+		c := change{Note: id, Device: s.state.Device, Time: time.Now(), Deleted: true}
+		for _, v := range n.Fields {
+			if !c.Time.After(v.Time) {
+				c.Time = v.Time.Add(time.Nanosecond)
+			}
+		}
+		if err := s.write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes the change record c.
+func (s *syncer) write(c change) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(s.dir, CHANGES_DIR, c.Note)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	name := strconv.FormatInt(c.Time.UnixNano(), 10) + "-" + c.Device + RECORD_EXT
+	sealed, err := seal(s.gcm, data, c.Note+"/"+name)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path+".tmp", sealed, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	s.res.Sent++
+	return nil
+}
+
+// receive folds the change records of the notes with new ones into the
+// notes.
+func (s *syncer) receive() error {
+	entries, err := os.ReadDir(filepath.Join(s.dir, CHANGES_DIR))
+	if err != nil {
+		return err
+	}
+	merged := map[string]*noteState{}
+	mergedValues := map[string]map[string]json.RawMessage{}
+	for _, e := range entries {
+		id := e.Name()
+		if !e.IsDir() || !noteIDRe.MatchString(id) {
+			continue
+		}
+		names, err := s.recordNames(id)
+		if err != nil {
+			return err
+		}
+		if n := s.state.Notes[id]; n != nil && n.Records == len(names) {
+			continue
+		}
+		if merged[id], mergedValues[id], err = s.fold(id, names); err != nil {
+			return err
+		}
+	}
+	if len(merged) == 0 {
+		// Attachments of notes received before may have reached the sync
+		// folder since
+		records, err := s.store.Load()
+		if err != nil {
+			return err
+		}
+		return s.receiveAttachments(records)
+	}
+
+	_, err = s.store.Update(func(records []store.Record) ([]store.Record, error) {
+		index := map[string]int{}
+		for i, r := range records {
+			index[r.ID] = i
+		}
+		deleted := map[string]bool{}
+		for id, m := range merged {
+			prev := s.state.Notes[id]
+			s.state.Notes[id] = m
+			i, ok := index[id]
+			if !ok {
+				if m.deleted() {
+					continue
+				}
+				r := store.Record{ID: id}
+				for f, v := range mergedValues[id] {
+					if err := setField(&r, f, v); err != nil {
+						return nil, err
+					}
+					r.Modified = latest(r.Modified, m.Fields[f].Time)
+				}
+				records = append(records, r)
+				s.res.Received++
+				continue
+			}
+
+			// A field changed here since the last sync is a change of this
+			// device as of the note modification, still to be sent
+			r := &records[i]
+			local := map[string]version{}
+			for f, v := range values(*r) {
+				if prev != nil && prev.Fields[f].Hash == hash(v) {
+					local[f] = prev.Fields[f]
+				} else {
+					local[f] = version{Time: r.Modified, Device: s.state.Device}
+				}
+			}
+			changed := false
+			for f, v := range m.Fields {
+				if v.after(local[f]) && v.Hash != hash(values(*r)[f]) {
+					if err := setField(r, f, mergedValues[id][f]); err != nil {
+						return nil, err
+					}
+					local[f] = v
+					r.Modified = latest(r.Modified, v.Time)
+					changed = true
+				}
+			}
+			if m.Deleted != nil && (&noteState{Fields: local, Deleted: m.Deleted}).deleted() {
+				deleted[id] = true
+				s.res.Deleted++
+			} else if changed {
+				s.res.Received++
+			}
+		}
+		kept := records[:0]
+		for _, r := range records {
+			if !deleted[r.ID] {
+				kept = append(kept, r)
+			}
+		}
+		return kept, s.receiveAttachments(kept)
+	})
+	return err
+}
+
+// recordNames returns the names of the change records of the note id.
+func (s *syncer) recordNames(id string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, CHANGES_DIR, id))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), RECORD_EXT) {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// fold folds the change records names of the note id into the last version
+// and value of each field, and the last tombstone.
+func (s *syncer) fold(id string, names []string) (*noteState, map[string]json.RawMessage, error) {
+	n := &noteState{Fields: map[string]version{}, Records: len(names)}
+	vals := map[string]json.RawMessage{}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(s.dir, CHANGES_DIR, id, name))
+		if err != nil {
+			return nil, nil, err
+		}
+		plain, err := open(s.gcm, data, id+"/"+name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("change record %s/%s is damaged", id, name)
+		}
+		var c change
+		if err := json.Unmarshal(plain, &c); err != nil || c.Note != id {
+			return nil, nil, fmt.Errorf("change record %s/%s is damaged", id, name)
+		}
+		v := version{Time: c.Time, Device: c.Device}
+		if c.Deleted {
+			if n.Deleted == nil || v.after(*n.Deleted) {
+				n.Deleted = &v
+			}
+			continue
+		}
+		for f, value := range c.Fields {
+			if old, ok := n.Fields[f]; ok && !v.after(old) {
+				continue
+			}
+			v.Hash = hash(value)
+			n.Fields[f] = v
+			vals[f] = value
+		}
+	}
+	return n, vals, nil
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// sharedAttachments returns the ids of the attachments in the sync folder.
+func (s *syncer) sharedAttachments() (map[string]bool, error) {
+	dir := filepath.Join(s.dir, ATTACHMENTS_DIR)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	shared := map[string]bool{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && store.AttachmentIDRe.MatchString(e.Name()) {
+			shared[e.Name()] = true
+		}
+	}
+	return shared, nil
+}
+
+// sendAttachments copies the attachments missing from the sync folder to
+// it. Copying each once is enough because attachments never change and
+// their ids are random, never reused for other content. The ids aren't
+// hashes of the content, equal files have different ids.
+func (s *syncer) sendAttachments() error {
+	shared, err := s.sharedAttachments()
+	if err != nil {
+		return err
+	}
+	ids, err := s.store.Attachments()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(s.dir, ATTACHMENTS_DIR)
+	for _, id := range ids {
+		if shared[id] {
+			continue
+		}
+		data, err := s.store.ReadAttachment(id)
+		if err != nil {
+			return err
+		}
+		sealed, err := seal(s.gcm, data, ATTACHMENTS_DIR+"/"+id)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, id)
+		if err := os.WriteFile(path+".tmp", sealed, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveAttachments copies the attachments records refer to from the sync
+// folder, if they are missing here. Others aren't, those the app removed
+// since nothing referred to them would come back on every sync. Those not
+// in the sync folder yet come with a later sync.
+func (s *syncer) receiveAttachments(records []store.Record) error {
+	shared, err := s.sharedAttachments()
+	if err != nil {
+		return err
+	}
+	ids, err := s.store.Attachments()
+	if err != nil {
+		return err
+	}
+	local := map[string]bool{}
+	for _, id := range ids {
+		local[id] = true
+	}
+	dir := filepath.Join(s.dir, ATTACHMENTS_DIR)
+	for _, r := range records {
+		for _, m := range store.AttachmentRefRe.FindAllStringSubmatch(r.Content, -1) {
+			id := m[3]
+			if !shared[id] || local[id] {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, id))
+			if err != nil {
+				return err
+			}
+			plain, err := open(s.gcm, data, ATTACHMENTS_DIR+"/"+id)
+			if err != nil {
+				return fmt.Errorf("attachment %s is damaged", id)
+			}
+			if err := s.store.WriteAttachment(id, plain); err != nil {
+				return err
+			}
+			local[id] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package notesync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/deoxyimran/keeper/app/store"
+)
+
+const testPassphrase = "correct horse"
+
+func init() {
+	iterations = 1000
+}
+
+// device is a data directory syncing with a shared folder.
+type device struct {
+	t      *testing.T
+	store  *store.Store
+	shared string
+}
+
+func newDevices(t *testing.T, n int) []*device {
+	shared := t.TempDir()
+	var devices []*device
+	for i := 0; i < n; i++ {
+		st, err := store.Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		devices = append(devices, &device{t: t, store: st, shared: shared})
+	}
+	return devices
+}
+
+func (d *device) sync() Result {
+	d.t.Helper()
+	res, err := Sync(d.store, d.shared, testPassphrase)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return res
+}
+
+func (d *device) load() []store.Record {
+	d.t.Helper()
+	records, err := d.store.Load()
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return records
+}
+
+// change changes the note id with f, as edited at the time at.
+func (d *device) change(id string, at time.Time, f func(r *store.Record)) {
+	d.t.Helper()
+	_, err := d.store.Update(func(records []store.Record) ([]store.Record, error) {
+		for i := range records {
+			if records[i].ID == id {
+				f(&records[i])
+				records[i].Modified = at
+				return records, nil
+			}
+		}
+		r := store.Record{ID: id, Modified: at}
+		f(&r)
+		return append(records, r), nil
+	})
+	if err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+func (d *device) remove(id string) {
+	d.t.Helper()
+	_, err := d.store.Update(func(records []store.Record) ([]store.Record, error) {
+		return slices.DeleteFunc(records, func(r store.Record) bool { return r.ID == id }), nil
+	})
+	if err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+func (d *device) note(id string) (store.Record, bool) {
+	d.t.Helper()
+	for _, r := range d.load() {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return store.Record{}, false
+}
+
+// converged checks that the devices have the same notes.
+func converged(t *testing.T, devices []*device) {
+	t.Helper()
+	want := devices[0].load()
+	for _, d := range devices[1:] {
+		got := d.load()
+		if len(got) != len(want) {
+			t.Fatalf("got %d notes, want %d", len(got), len(want))
+		}
+		for _, w := range want {
+			r, ok := d.note(w.ID)
+			if !ok || r.Title != w.Title || r.Content != w.Content || r.Folder != w.Folder || r.Pinned != w.Pinned || !slices.Equal(r.Tags, w.Tags) {
+				t.Errorf("note %s: got %+v, want %+v", w.ID, r, w)
+			}
+		}
+	}
+}
+
+var t0 = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+
+func TestDifferentNotes(t *testing.T) {
+	devices := newDevices(t, 2)
+	a, b := devices[0], devices[1]
+	a.change("a1", t0, func(r *store.Record) { r.Title, r.Content = "From A", "written on A" })
+	a.sync()
+	b.sync()
+
+	// Both edit offline, then sync in turn
+	a.change("a2", t0.Add(time.Minute), func(r *store.Record) { r.Title = "Another from A" })
+	b.change("b1", t0.Add(time.Minute), func(r *store.Record) { r.Title, r.Tags = "From B", []string{"b"} })
+	b.change("a1", t0.Add(2*time.Minute), func(r *store.Record) { r.Content = "edited on B" })
+	a.sync()
+	if res := b.sync(); res.Received != 1 {
+		t.Errorf("B received %d notes, want 1", res.Received)
+	}
+	a.sync()
+
+	converged(t, devices)
+	if r, _ := a.note("a1"); r.Content != "edited on B" {
+		t.Errorf("got content %q, want the one of B", r.Content)
+	}
+	if len(a.load()) != 3 {
+		t.Errorf("got %d notes, want 3", len(a.load()))
+	}
+}
+
+func TestFieldsMerge(t *testing.T) {
+	devices := newDevices(t, 2)
+	a, b := devices[0], devices[1]
+	a.change("n", t0, func(r *store.Record) { r.Title, r.Content = "Note", "first" })
+	a.sync()
+	b.sync()
+
+	// A renames the note later than B edits it, both are kept
+	b.change("n", t0.Add(time.Minute), func(r *store.Record) { r.Content = "second" })
+	a.change("n", t0.Add(2*time.Minute), func(r *store.Record) { r.Title = "Renamed" })
+	a.sync()
+	b.sync()
+	a.sync()
+
+	converged(t, devices)
+	if r, _ := b.note("n"); r.Title != "Renamed" || r.Content != "second" {
+		t.Errorf("got %q %q, want both changes", r.Title, r.Content)
+	}
+}
+
+func TestLastWriterWins(t *testing.T) {
+	devices := newDevices(t, 2)
+	a, b := devices[0], devices[1]
+	a.change("n", t0, func(r *store.Record) { r.Content = "first" })
+	a.sync()
+	b.sync()
+
+	// B writes last but syncs first
+	a.change("n", t0.Add(time.Minute), func(r *store.Record) { r.Content = "from A" })
+	b.change("n", t0.Add(2*time.Minute), func(r *store.Record) { r.Content = "from B" })
+	b.sync()
+	a.sync()
+	b.sync()
+
+	converged(t, devices)
+	if r, _ := a.note("n"); r.Content != "from B" {
+		t.Errorf("got %q, want the last write", r.Content)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	devices := newDevices(t, 3)
+	a, b, c := devices[0], devices[1], devices[2]
+	a.change("n", t0, func(r *store.Record) { r.Title = "Doomed" })
+	a.change("m", t0, func(r *store.Record) { r.Title = "Kept" })
+	for _, d := range devices {
+		d.sync()
+	}
+
+	b.remove("n")
+	b.sync()
+	if res := a.sync(); res.Deleted != 1 {
+		t.Errorf("A deleted %d notes, want 1", res.Deleted)
+	}
+	c.sync()
+	for _, d := range devices {
+		if _, ok := d.note("n"); ok {
+			t.Error("the note was not deleted")
+		}
+	}
+
+	// A tombstone is final for older changes, the note doesn't come back
+	for _, d := range devices {
+		d.sync()
+	}
+	converged(t, devices)
+	if len(c.load()) != 1 {
+		t.Errorf("got %d notes, want 1", len(c.load()))
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	devices := newDevices(t, 2)
+	a, b := devices[0], devices[1]
+	id, err := a.store.AddAttachment("cat.png", []byte("png data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused, err := a.store.AddAttachment("dog.png", []byte("other png data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.change("n", t0, func(r *store.Record) { r.Content = "![cat](attachment:" + id + ")" })
+	a.sync()
+	b.sync()
+	data, err := b.store.ReadAttachment(id)
+	if err != nil || string(data) != "png data" {
+		t.Errorf("got %q, %v, want the attachment", data, err)
+	}
+	// Only those notes refer to are received, others were removed since
+	// nothing referred to them
+	if _, err := b.store.ReadAttachment(unused); err == nil {
+		t.Error("got an attachment no note refers to")
+	}
+
+	// Attachments reaching the sync folder after their note are received
+	// with a later sync
+	late, err := a.store.AddAttachment("bird.png", []byte("bird"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.change("m", t0, func(r *store.Record) { r.Content = "![bird](attachment:" + late + ")" })
+	a.sync()
+	path := filepath.Join(a.shared, SYNC_DIR, ATTACHMENTS_DIR, late)
+	if err := os.Rename(path, path+".away"); err != nil {
+		t.Fatal(err)
+	}
+	b.sync()
+	if err := os.Rename(path+".away", path); err != nil {
+		t.Fatal(err)
+	}
+	b.sync()
+	if data, err := b.store.ReadAttachment(late); err != nil || string(data) != "bird" {
+		t.Errorf("got %q, %v, want the attachment", data, err)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	devices := newDevices(t, 2)
+	devices[0].sync()
+	if _, err := Sync(devices[1].store, devices[1].shared, "wrong"); !errors.Is(err, ErrPassphrase) {
+		t.Errorf("got %v, want %v", err, ErrPassphrase)
+	}
+}
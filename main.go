@@ -8,16 +8,34 @@ import (
 	"gioui.org/op"
 	"gioui.org/unit"
 	myapp "github.com/deoxyimran/keeper/app"
+	"github.com/deoxyimran/keeper/app/cli"
 )
 
 func main() {
-	w, h := 900, 600
+	// The capture window runs alone, subcommands without a window
+	if len(os.Args) > 1 && os.Args[1] == "--capture" {
+		go func() {
+			window := new(app.Window)
+			window.Option(
+				app.Title("Keeper capture"),
+				app.Size(unit.Dp(420), unit.Dp(220)),
+			)
+			if err := myapp.RunCapture(window); err != nil {
+				log.Fatal(err)
+			}
+			os.Exit(0)
+		}()
+		app.Main()
+	}
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
 	go func() {
 		window := new(app.Window)
 		window.Option(
 			app.Title("Keeper"),
-			app.MinSize(unit.Dp(w), unit.Dp(h)),
-			app.MaxSize(unit.Dp(w), unit.Dp(h)),
+			app.Size(unit.Dp(900), unit.Dp(600)),
+			app.MinSize(unit.Dp(360), unit.Dp(400)),
 		)
 		err := run(window)
 		if err != nil {
@@ -30,7 +48,7 @@ func main() {
 
 func run(window *app.Window) error {
 	// Init app and load resources
-	a := myapp.NewApp()
+	a := myapp.NewApp(window)
 	// Run loop
 	var ops op.Ops
 	for {